@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// completeUser returns the -u credentials with a password, prompting for it
+// on the terminal without echo when only the user name was given
+func completeUser(user string) (string, error) {
+	if user == "" || strings.Contains(user, ":") {
+		return user, nil
+	}
+	password, err := readPassword(fmt.Sprintf("Enter host password for user '%s':", user))
+	if err != nil {
+		return "", err
+	}
+	return user + ":" + password, nil
+}
+
+// readPassword prints the prompt and reads one line from the controlling
+// terminal with echo turned off
+func readPassword(prompt string) (string, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return "", fmt.Errorf("cannot prompt for a password without a terminal: %v", err)
+	}
+	defer tty.Close()
+
+	fmt.Fprint(tty, prompt)
+	if err := stty(tty, "-echo"); err != nil {
+		return "", fmt.Errorf("error disabling terminal echo: %v", err)
+	}
+	line, err := bufio.NewReader(tty).ReadString('\n')
+	stty(tty, "echo")
+	fmt.Fprintln(tty)
+	if err != nil {
+		return "", fmt.Errorf("error reading password: %v", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// stty changes the settings of the terminal tty
+func stty(tty *os.File, setting string) error {
+	cmd := exec.Command("stty", setting)
+	cmd.Stdin = tty
+	return cmd.Run()
+}
+
+// sameHost reports whether target points at the host and port of the URL
+// given on the command line
+func sameHost(opts *requestOptions, target urlOptions) bool {
+	original, err := parseURL(opts.URL)
+	return err == nil && original.Host == target.Host && original.Port == target.Port
+}
+
+// credentials returns the user:password pair for the request, or "" when it
+// carries none. Like curl, -u is only sent to the host named on the command
+// line, so a redirect elsewhere does not leak it, while credentials embedded
+// in a URL apply to that URL. The .netrc entry for the host comes last
+func credentials(opts *requestOptions, target urlOptions) string {
+	if opts.User != "" && sameHost(opts, target) {
+		return opts.User
+	}
+	if target.User != nil {
+		password, _ := target.User.Password()
+		return target.User.Username() + ":" + password
+	}
+	return netrcCredentials(opts.NetrcEntries, target.Host)
+}
+
+// loadSecret resolves a secret given on the command line, such as the
+// --oauth2-bearer token: "@file" reads it from a file and "env:NAME" from an
+// environment variable, so that it does not show up in the process list
+func loadSecret(value string, what string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, "@"):
+		content, err := os.ReadFile(value[1:])
+		if err != nil {
+			return "", fmt.Errorf("error reading %s: %v", what, err)
+		}
+		value = strings.TrimSpace(string(content))
+	case strings.HasPrefix(value, "env:"):
+		name := value[len("env:"):]
+		secret, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("error reading %s: environment variable %s is not set", what, name)
+		}
+		value = strings.TrimSpace(secret)
+	}
+	if value == "" {
+		return "", fmt.Errorf("error reading %s: it is empty", what)
+	}
+	return value, nil
+}
+
+// authorizationHeader returns the Authorization value for the request, or ""
+// when it carries no credentials or --digest, --ntlm or --anyauth ask for a
+// challenge first. A
+// --oauth2-bearer token takes precedence over -u, and like -u it is only
+// sent to the host named on the command line
+func authorizationHeader(opts *requestOptions, target urlOptions) string {
+	if opts.BearerToken != "" && sameHost(opts, target) {
+		return "Bearer " + opts.BearerToken
+	}
+	credentials := credentials(opts, target)
+	if credentials == "" || opts.Digest || opts.NTLM || opts.AnyAuth {
+		return ""
+	}
+	return basicAuthorization(credentials)
+}
+
+// basicAuthorization returns the Basic Authorization value for user:password.
+// Go strings are UTF-8 already, which is what RFC 7617 asks for
+func basicAuthorization(credentials string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))
+}
+
+// authenticatedRequest performs doRequest with the authentication scheme the
+// options ask for: --ntlm runs its handshake, --digest answers the server's
+// challenge and --anyauth probes first to pick the scheme
+func authenticatedRequest(ctx context.Context, opts *requestOptions, target string, stats *transferStats) (*httpResponse, io.Reader, net.Conn, error) {
+	switch {
+	case opts.NTLM:
+		return ntlmRequest(ctx, opts, target, stats)
+	case opts.Digest:
+		return digestRequest(ctx, opts, target, stats)
+	case opts.AnyAuth:
+		return anyAuthRequest(ctx, opts, target, stats)
+	}
+	return doRequest(ctx, opts, target, stats)
+}
+
+// authSchemes lists the schemes --anyauth can use, strongest first
+var authSchemes = []string{"digest", "ntlm", "basic"}
+
+// strongestScheme returns the strongest supported scheme the server offers
+// in its WWW-Authenticate challenges, or "" when there is none
+func strongestScheme(resp *httpResponse) string {
+	offered := map[string]bool{}
+	for _, h := range resp.Headers {
+		if strings.EqualFold(h.Name, "WWW-Authenticate") {
+			scheme, _, _ := strings.Cut(strings.TrimSpace(h.Value), " ")
+			offered[strings.ToLower(scheme)] = true
+		}
+	}
+	for _, scheme := range authSchemes {
+		if offered[scheme] {
+			return scheme
+		}
+	}
+	return ""
+}
+
+// anyAuthRequest sends the request without credentials and, when the server
+// rejects it with a challenge, repeats it with the strongest scheme offered
+func anyAuthRequest(ctx context.Context, opts *requestOptions, target string, stats *transferStats) (*httpResponse, io.Reader, net.Conn, error) {
+	resp, body, conn, err := doRequest(ctx, opts, target, stats)
+	if err != nil || resp.StatusCode != 401 {
+		return resp, body, conn, err
+	}
+	options, err := parseURL(target)
+	scheme := strongestScheme(resp)
+	if err != nil || scheme == "" || credentials(opts, options) == "" {
+		return resp, body, conn, nil
+	}
+	out.Printf("Server offers %s authentication, using it\n", scheme)
+
+	chosen := *opts
+	chosen.AnyAuth = false
+	switch scheme {
+	case "digest":
+		chosen.Digest = true
+		return answerDigest(ctx, &chosen, target, resp, body, conn, stats)
+	case "ntlm":
+		out.printHead(resp)
+		conn.Close()
+		chosen.NTLM = true
+		return ntlmRequest(ctx, &chosen, target, stats)
+	}
+	out.printHead(resp)
+	conn.Close()
+	return doRequest(ctx, &chosen, target, stats)
+}
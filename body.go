@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/hex"
+	"hash"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// uploadBody is a request body produced on demand instead of held in
+// opts.Data, so that large files stream from disk. It is opened again for
+// every request that sends it: retries, redirects and authentication
+// handshakes each read it from the start
+type uploadBody interface {
+	// Size returns the length of the body in bytes
+	Size() int64
+	// ContentType returns the media type describing the body, or ""
+	ContentType() string
+	// Open returns a reader positioned at the start of the body
+	Open() (io.ReadCloser, error)
+}
+
+// needsWholeBody reports whether the body must be known in full before it is
+// sent, to sign it, or may have to be sent again: by an authentication
+// handshake, a retry, or a redirect that keeps the method. A stream read from
+// stdin or a pipe allows neither
+func (opts *requestOptions) needsWholeBody() bool {
+	return opts.AWSSigV4 != "" || opts.HMACSign.Algorithm != "" || opts.Digest || opts.NTLM || opts.AnyAuth || opts.Retry > 0 || opts.Location
+}
+
+// dropBody removes every source of the request body, for a request that goes
+// out without one: a probe ahead of the transfer, or a redirect switching to GET
+func (opts *requestOptions) dropBody() {
+	opts.Data = ""
+	opts.DataArgs = nil
+	opts.DataType = ""
+	opts.ContentEncoding = ""
+	opts.FormArgs = nil
+	opts.Upload = nil
+	opts.UploadFile = ""
+	opts.UploadOffset = 0
+}
+
+// requestBodySize returns the length of the body the request carries
+func requestBodySize(opts *requestOptions) int64 {
+	if opts.Upload != nil {
+		return opts.Upload.Size()
+	}
+	return int64(len(opts.Data))
+}
+
+// requestContentType returns the Content-Type sent with the body unless
+// the user set one: what the upload declares, the type sniffed from a
+// -d @file, or form encoding for other -d data
+func requestContentType(opts *requestOptions) string {
+	if opts.Upload != nil {
+		return opts.Upload.ContentType()
+	}
+	if opts.Data != "" && opts.DataType != "" {
+		return opts.DataType
+	}
+	if opts.Data != "" {
+		return "application/x-www-form-urlencoded"
+	}
+	return ""
+}
+
+// sniffContentType guesses the media type of a body read from a file, from
+// the file extension or else from the magic bytes at the start of its
+// content. Content that merely looks like text gives "", since a file with
+// an unknown extension may well hold form data
+func sniffContentType(path string, head []byte) string {
+	if extType := mime.TypeByExtension(filepath.Ext(path)); extType != "" {
+		return extType
+	}
+	detected := http.DetectContentType(head)
+	if strings.HasPrefix(detected, "text/plain") || detected == "application/octet-stream" {
+		return ""
+	}
+	return detected
+}
+
+// dataFileType returns the sniffed media type of a payload that is a whole
+// file, given as a lone -d @file or --data-binary @file, or "" for any other
+// payload. A gzip file, sent with Content-Encoding or decompressed, is typed
+// by the name it has without the .gz suffix
+func dataFileType(args dataList, data string, encoding string) string {
+	if len(args) != 1 || (args[0].kind != dataPlain && args[0].kind != dataBinary) {
+		return ""
+	}
+	path, ok := strings.CutPrefix(args[0].value, "@")
+	if !ok || path == "-" {
+		return ""
+	}
+	if encoding == "gzip" {
+		return mime.TypeByExtension(filepath.Ext(strings.TrimSuffix(path, ".gz")))
+	}
+	if !strings.HasPrefix(data, string(gzipMagic)) {
+		path = strings.TrimSuffix(path, ".gz")
+	}
+	return sniffContentType(path, []byte(data[:min(len(data), 512)]))
+}
+
+// openRequestBody returns a reader for the request body, or nil when the
+// request has none
+func openRequestBody(opts *requestOptions) (io.ReadCloser, error) {
+	if opts.Upload != nil {
+		return opts.Upload.Open()
+	}
+	if opts.Data == "" {
+		return nil, nil
+	}
+	return io.NopCloser(strings.NewReader(opts.Data)), nil
+}
+
+// payloadHash returns the hex digest of the request body for the signing
+// schemes, streaming an upload through the hash instead of loading it
+func payloadHash(opts *requestOptions, newHash func() hash.Hash) (string, error) {
+	h := newHash()
+	body, err := openRequestBody(opts)
+	if err != nil {
+		return "", err
+	}
+	if body != nil {
+		defer body.Close()
+		if _, err := io.Copy(h, body); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
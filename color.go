@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// ANSI escape sequences used for styled output
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiCyan   = "\x1b[36m"
+)
+
+// colorEnabled reports whether styled output should be used: stdout must be a
+// terminal and neither --no-color nor the NO_COLOR environment variable is set
+func colorEnabled(noColor bool) bool {
+	return !noColor && os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout)
+}
+
+// statusColor picks the color for a status line based on its class
+func statusColor(code int) string {
+	switch {
+	case code >= 200 && code < 300:
+		return ansiGreen
+	case code >= 300 && code < 400:
+		return ansiYellow
+	case code >= 400:
+		return ansiRed
+	}
+	return ansiCyan
+}
+
+// colorizeHead styles a raw response head: the status line by class and
+// header names in bold cyan, leaving values in the default color
+func colorizeHead(head string, code int) string {
+	var b strings.Builder
+	lines := strings.SplitAfter(head, "\n")
+	for i, line := range lines {
+		text := strings.TrimRight(line, "\r\n")
+		eol := line[len(text):]
+		if text == "" {
+			b.WriteString(line)
+			continue
+		}
+		if i == 0 {
+			b.WriteString(ansiBold + statusColor(code) + text + ansiReset + eol)
+			continue
+		}
+		name, value, ok := strings.Cut(text, ":")
+		if !ok {
+			b.WriteString(line)
+			continue
+		}
+		b.WriteString(ansiBold + ansiCyan + name + ansiReset + ":" + value + eol)
+	}
+	return b.String()
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// ifMatchHeader resolves --if-match into an If-Match header. With "auto" the
+// resource is fetched first so its current ETag can be sent with the write
+func ifMatchHeader(ctx context.Context, opts requestOptions) (string, error) {
+	etag := opts.IfMatch
+	if etag == "auto" {
+		out.Printf("Fetching the current ETag of %s\n", opts.URL)
+		// The probe goes out like the write itself, with its credentials,
+		// cookies, name resolution, source address, timeouts and --linger
+		// (-1 unless given, so the socket closes normally), but without
+		// its body
+		probe := opts
+		probe.Method = "GET"
+		probe.dropBody()
+		resp, body, conn, err := authenticatedRequest(ctx, &probe, probe.URL, newTransferStats())
+		if err != nil {
+			return "", err
+		}
+		defer conn.Close()
+		if _, err := io.Copy(io.Discard, body); err != nil {
+			return "", fmt.Errorf("error reading body: %v", err)
+		}
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return "", fmt.Errorf("error fetching ETag: GET %s returned %d", opts.URL, resp.StatusCode)
+		}
+		etag = resp.header("ETag")
+		if etag == "" {
+			return "", fmt.Errorf("error fetching ETag: GET %s returned no ETag header", opts.URL)
+		}
+		out.Printf("Current ETag: %s\n\n", etag)
+	}
+	return "If-Match: " + etag, nil
+}
+
+// preconditionError explains a 412 answer to a conditional write
+func preconditionError(opts requestOptions) error {
+	return fmt.Errorf("Precondition failed (412): %s %s was rejected because the resource changed since its ETag was read", opts.Method, opts.URL)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// etagHandler serves a resource versioned by its ETag, "v1" at first: GET
+// returns the current ETag unless hidden, and a PUT whose If-Match matches it
+// stores a new version
+func etagHandler(hidden bool) func(w http.ResponseWriter, r *http.Request, body string) {
+	var mu sync.Mutex
+	version := 1
+	return func(w http.ResponseWriter, r *http.Request, body string) {
+		mu.Lock()
+		defer mu.Unlock()
+		current := fmt.Sprintf(`"v%d"`, version)
+		switch r.Method {
+		case "GET":
+			if !hidden {
+				w.Header().Set("ETag", current)
+			}
+			w.Write([]byte("resource"))
+		case "PUT":
+			if r.Header.Get("If-Match") != current {
+				w.WriteHeader(412)
+				return
+			}
+			version++
+			w.WriteHeader(204)
+		}
+	}
+}
+
+func TestIfMatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		hidden     bool
+		ifMatch    string
+		wantErr    string
+		wantMethod []string
+	}{
+		{name: "auto", ifMatch: "auto", wantMethod: []string{"GET", "PUT"}},
+		{name: "given", ifMatch: `"v1"`, wantMethod: []string{"PUT"}},
+		{name: "stale", ifMatch: `"v0"`, wantErr: "Precondition failed (412)", wantMethod: []string{"PUT"}},
+		{name: "auto without an ETag", hidden: true, ifMatch: "auto", wantErr: "returned no ETag header", wantMethod: []string{"GET"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(t, etagHandler(tt.hidden))
+			result := runCLI(t, "", "-s", "-S", "-u", "user:pw", "-X", "PUT", "-d", "new content", "--if-match", tt.ifMatch, server.URL+"/doc")
+			if tt.wantErr != "" {
+				if result.code == 0 || !strings.Contains(result.stderr, tt.wantErr) {
+					t.Errorf("exit status %d, stderr:\n%s\nwant a failure mentioning %q", result.code, result.stderr, tt.wantErr)
+				}
+			} else if result.code != 0 {
+				t.Fatalf("exit status %d, stderr:\n%s", result.code, result.stderr)
+			}
+
+			requests := server.received()
+			var methods []string
+			for _, req := range requests {
+				methods = append(methods, req.Method)
+				if req.Header.Get("Authorization") == "" {
+					t.Errorf("%s went out without the credentials", req.Method)
+				}
+				if req.Method == "GET" && (req.Body != "" || req.Header.Get("Content-Type") != "") {
+					t.Errorf("the ETag probe carried the body %q with Content-Type %q", req.Body, req.Header.Get("Content-Type"))
+				}
+			}
+			if strings.Join(methods, " ") != strings.Join(tt.wantMethod, " ") {
+				t.Errorf("requests = %v, want %v", methods, tt.wantMethod)
+			}
+			if tt.name == "auto" {
+				if got := requests[1].Header.Get("If-Match"); got != `"v1"` || requests[1].Body != "new content" {
+					t.Errorf("PUT with If-Match %s and body %q", got, requests[1].Body)
+				}
+			}
+		})
+	}
+}
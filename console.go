@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// console routes informational output and error messages according to -s and -S
+type console struct {
+	Silent    bool
+	ShowError bool
+	Color     bool
+	Machine   bool // raw numbers instead of human-readable units
+}
+
+// out is the console used for everything printed besides the response body
+var out console
+
+// Printf prints informational output unless silent mode is enabled
+func (c console) Printf(format string, args ...any) {
+	if !c.Silent {
+		fmt.Printf(format, args...)
+	}
+}
+
+// Print prints informational output unless silent mode is enabled
+func (c console) Print(args ...any) {
+	if !c.Silent {
+		fmt.Print(args...)
+	}
+}
+
+// Println prints informational output unless silent mode is enabled
+func (c console) Println(args ...any) {
+	if !c.Silent {
+		fmt.Println(args...)
+	}
+}
+
+// Errorln prints an error message to stderr, unless silent mode is enabled without -S
+func (c console) Errorln(args ...any) {
+	if !c.Silent || c.ShowError {
+		fmt.Fprintln(os.Stderr, args...)
+	}
+}
+
+// printHead prints a response status line and headers, colorized when enabled
+func (c console) printHead(resp *httpResponse) {
+	if c.Color {
+		c.Print(colorizeHead(resp.Head, resp.StatusCode))
+	} else {
+		c.Print(resp.Head)
+	}
+}
+
+// exitError is an error that terminates the program with a specific exit status
+type exitError struct {
+	code int
+	err  error
+}
+
+// Error returns the message of the wrapped error
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+// fatal reports the error and exits with a failure status, using the
+// status carried by an exitError when there is one
+func (c console) fatal(err error) {
+	c.Errorln(err)
+	os.Exit(exitCode(err))
+}
+
+// exitCode returns the exit status for an error: the one carried by an
+// exitError, or 1
+func exitCode(err error) int {
+	var exitErr *exitError
+	if errors.As(err, &exitErr) {
+		return exitErr.code
+	}
+	return 1
+}
+
+// isTerminal reports whether the file is attached to a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
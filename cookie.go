@@ -0,0 +1,338 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cookie is one stored cookie with the attributes deciding where it is sent
+type cookie struct {
+	Domain            string // without a leading dot
+	IncludeSubdomains bool
+	Path              string
+	Secure            bool
+	HTTPOnly          bool
+	SameSite          string    // kept for display only, cookie files have no field for it
+	Expires           time.Time // zero for a session cookie
+	Name              string
+	Value             string
+}
+
+// cookieJar holds the cookies a transfer may send
+type cookieJar struct {
+	literal []string // name=value pairs given on the command line, sent on every request
+	cookies []cookie
+	debug   bool // explain every cookie sent, held back, accepted or rejected
+}
+
+// loadCookies builds the jar from -b arguments: one containing '=' is a
+// literal "name=value; other=2" string, anything else names a Netscape-format
+// cookie file, as with curl. With junkSession, cookies read from files
+// without an expiry are dropped, as if a new browser session started
+func loadCookies(args []string, junkSession bool) (*cookieJar, error) {
+	jar := &cookieJar{}
+	for _, arg := range args {
+		if strings.Contains(arg, "=") {
+			for _, pair := range strings.Split(arg, ";") {
+				if pair = strings.TrimSpace(pair); pair != "" {
+					jar.literal = append(jar.literal, pair)
+				}
+			}
+			continue
+		}
+		cookies, err := loadCookieFile(arg)
+		if err != nil {
+			return nil, err
+		}
+		if junkSession {
+			cookies = slices.DeleteFunc(cookies, func(c cookie) bool { return c.Expires.IsZero() })
+		}
+		jar.cookies = append(jar.cookies, cookies...)
+	}
+	return jar, nil
+}
+
+// loadCookieFile parses a Netscape-format cookie file: one cookie per line
+// with tab-separated domain, include-subdomains flag, path, secure flag,
+// expiry in Unix seconds, name and value. Lines starting with # are comments,
+// except for the #HttpOnly_ prefix marking HttpOnly cookies
+func loadCookieFile(path string) ([]cookie, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading cookie file: %v", err)
+	}
+
+	var cookies []cookie
+	for i, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimRight(line, "\r")
+		httpOnly := false
+		if rest, ok := strings.CutPrefix(line, "#HttpOnly_"); ok {
+			line, httpOnly = rest, true
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) == 6 {
+			fields = append(fields, "")
+		}
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("error reading cookie file %s: line %d has %d fields, expected 7", path, i+1, len(fields))
+		}
+		expiry, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("error reading cookie file %s: line %d has an invalid expiry %q", path, i+1, fields[4])
+		}
+		c := cookie{
+			Domain:            strings.ToLower(strings.TrimPrefix(fields[0], ".")),
+			IncludeSubdomains: strings.EqualFold(fields[1], "TRUE"),
+			Path:              fields[2],
+			Secure:            strings.EqualFold(fields[3], "TRUE"),
+			HTTPOnly:          httpOnly,
+			Name:              fields[5],
+			Value:             fields[6],
+		}
+		if expiry != 0 {
+			c.Expires = time.Unix(expiry, 0)
+		}
+		cookies = append(cookies, c)
+	}
+	return cookies, nil
+}
+
+// domainMatches reports whether the cookie may be sent to host
+func (c cookie) domainMatches(host string) bool {
+	host = strings.ToLower(host)
+	return host == c.Domain || c.IncludeSubdomains && strings.HasSuffix(host, "."+c.Domain)
+}
+
+// pathMatches reports whether the cookie path covers the request path (RFC 6265 section 5.1.4)
+func (c cookie) pathMatches(path string) bool {
+	if path == c.Path {
+		return true
+	}
+	return strings.HasPrefix(path, c.Path) && (strings.HasSuffix(c.Path, "/") || path[len(c.Path)] == '/')
+}
+
+// expired reports whether the cookie has run out at now; session cookies never do
+func (c cookie) expired(now time.Time) bool {
+	return !c.Expires.IsZero() && !now.Before(c.Expires)
+}
+
+// skipReason explains why the cookie must not be sent to target, or returns
+// "" when it may be
+func (c cookie) skipReason(target urlOptions, path string, now time.Time) string {
+	switch {
+	case !c.domainMatches(target.Host):
+		return fmt.Sprintf("domain %s does not cover %s", c.Domain, target.Host)
+	case !c.pathMatches(path):
+		return fmt.Sprintf("path %s does not cover %s", c.Path, path)
+	case c.expired(now):
+		return fmt.Sprintf("expired %s", c.Expires.UTC().Format(time.RFC3339))
+	case c.Secure && target.Protocol != "https":
+		return "secure-only cookie on http"
+	}
+	return ""
+}
+
+// header returns the Cookie header value for a request to target, or "" when
+// no cookie applies. Stored cookies must match the domain and path, must not
+// have expired, and secure ones are only sent over https. Longer paths come
+// first, as RFC 6265 recommends
+func (j *cookieJar) header(target urlOptions, now time.Time) string {
+	path, _, _ := strings.Cut(target.Path, "?")
+	var matched []cookie
+	for _, c := range j.cookies {
+		if reason := c.skipReason(target, path, now); reason != "" {
+			if j.debug {
+				out.Printf("Cookie held back: %s (%s)\n", c.Name, reason)
+			}
+			continue
+		}
+		if j.debug {
+			out.Printf("Cookie sent: %s for %s%s\n", c.Name, c.Domain, c.Path)
+		}
+		matched = append(matched, c)
+	}
+	sort.SliceStable(matched, func(a, b int) bool { return len(matched[a].Path) > len(matched[b].Path) })
+
+	pairs := append([]string{}, j.literal...)
+	for _, c := range matched {
+		pairs = append(pairs, c.Name+"="+c.Value)
+	}
+	return strings.Join(pairs, "; ")
+}
+
+// defaultCookiePath is the directory of the request path, the path a cookie
+// gets when Set-Cookie names none (RFC 6265 section 5.1.4)
+func defaultCookiePath(requestPath string) string {
+	if !strings.HasPrefix(requestPath, "/") {
+		return "/"
+	}
+	dir := requestPath[:strings.LastIndex(requestPath, "/")]
+	if dir == "" {
+		return "/"
+	}
+	return dir
+}
+
+// parseSetCookie reads one Set-Cookie value received from target. It returns
+// an error for a cookie the client must not store: one without a name, one
+// for a domain the host does not belong to or for a public suffix, or a
+// secure one set over plain HTTP
+func parseSetCookie(value string, target urlOptions, now time.Time) (cookie, error) {
+	parts := strings.Split(value, ";")
+	name, val, ok := strings.Cut(parts[0], "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return cookie{}, fmt.Errorf("no cookie name")
+	}
+	path, _, _ := strings.Cut(target.Path, "?")
+	host := strings.ToLower(target.Host)
+	c := cookie{Domain: host, Path: defaultCookiePath(path), Name: name, Value: strings.TrimSpace(val)}
+
+	maxAge := false
+	for _, attr := range parts[1:] {
+		key, attrValue, _ := strings.Cut(attr, "=")
+		key, attrValue = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(attrValue)
+		switch key {
+		case "expires":
+			// Max-Age takes precedence over Expires, whichever comes first
+			if t, err := http.ParseTime(attrValue); err == nil && !maxAge {
+				c.Expires = t
+			}
+		case "max-age":
+			seconds, err := strconv.ParseInt(attrValue, 10, 64)
+			if err != nil {
+				continue
+			}
+			maxAge = true
+			if seconds <= 0 {
+				c.Expires = time.Unix(1, 0)
+			} else {
+				c.Expires = now.Add(time.Duration(seconds) * time.Second)
+			}
+		case "domain":
+			domain := strings.ToLower(strings.TrimPrefix(attrValue, "."))
+			if domain == "" {
+				continue
+			}
+			if host != domain && !strings.HasSuffix(host, "."+domain) {
+				return c, fmt.Errorf("domain %s does not cover %s", domain, host)
+			}
+			// A host may not set cookies for a whole public suffix like co.uk;
+			// when the host is that suffix the cookie just stays host-only,
+			// and so does any cookie for an IP address, which has no subdomains
+			if net.ParseIP(host) == nil && isPublicSuffix(domain) {
+				if host != domain {
+					return c, fmt.Errorf("domain %s is a public suffix", domain)
+				}
+				continue
+			}
+			c.Domain, c.IncludeSubdomains = domain, net.ParseIP(host) == nil
+		case "path":
+			if strings.HasPrefix(attrValue, "/") {
+				c.Path = attrValue
+			}
+		case "secure":
+			c.Secure = true
+		case "httponly":
+			c.HTTPOnly = true
+		case "samesite":
+			c.SameSite = attrValue
+		}
+	}
+	if c.Secure && target.Protocol != "https" {
+		return c, fmt.Errorf("secure-only cookie set over http")
+	}
+	return c, nil
+}
+
+// store adds the cookies set by a response from target, replacing cookies
+// with the same name, domain and path. A cookie that arrives already expired
+// deletes the stored one, which is how servers clear cookies
+func (j *cookieJar) store(target urlOptions, resp *httpResponse, now time.Time) {
+	for _, h := range resp.Headers {
+		if !strings.EqualFold(h.Name, "Set-Cookie") {
+			continue
+		}
+		c, err := parseSetCookie(h.Value, target, now)
+		if err != nil {
+			if j.debug {
+				out.Printf("Set-Cookie rejected: %s (%v)\n", h.Value, err)
+			}
+			continue
+		}
+		j.cookies = slices.DeleteFunc(j.cookies, func(old cookie) bool {
+			return old.Name == c.Name && old.Domain == c.Domain && old.Path == c.Path
+		})
+		switch {
+		case c.expired(now):
+			if j.debug {
+				out.Printf("Set-Cookie deleted: %s for %s%s (expired on arrival)\n", c.Name, c.Domain, c.Path)
+			}
+		default:
+			j.cookies = append(j.cookies, c)
+			if j.debug {
+				out.Printf("Set-Cookie accepted: %s for %s%s (%s)\n", c.Name, c.Domain, c.Path, c.lifetime())
+			}
+		}
+	}
+}
+
+// lifetime describes when the cookie expires
+func (c cookie) lifetime() string {
+	if c.Expires.IsZero() {
+		return "session"
+	}
+	return "expires " + c.Expires.UTC().Format(time.RFC3339)
+}
+
+// save writes the stored cookies that have not expired to path in Netscape
+// format, or to stdout when path is "-". Session cookies are written with an
+// expiry of 0, like curl does, so the next run can still send them
+func (j *cookieJar) save(path string, now time.Time) error {
+	var b strings.Builder
+	b.WriteString("# Netscape HTTP Cookie File\n")
+	b.WriteString("# This file was generated by cccurl. Edit at your own risk.\n\n")
+	for _, c := range j.cookies {
+		if c.expired(now) {
+			continue
+		}
+		domain := c.Domain
+		if c.IncludeSubdomains {
+			domain = "." + domain
+		}
+		if c.HTTPOnly {
+			domain = "#HttpOnly_" + domain
+		}
+		var expiry int64
+		if !c.Expires.IsZero() {
+			expiry = c.Expires.Unix()
+		}
+		fmt.Fprintf(&b, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", domain, netscapeBool(c.IncludeSubdomains), c.Path, netscapeBool(c.Secure), expiry, c.Name, c.Value)
+	}
+	if path == "-" {
+		_, err := os.Stdout.WriteString(b.String())
+		return err
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0600); err != nil {
+		return fmt.Errorf("error writing cookie jar: %v", err)
+	}
+	return nil
+}
+
+// netscapeBool spells a flag the way Netscape cookie files do
+func netscapeBool(v bool) string {
+	if v {
+		return "TRUE"
+	}
+	return "FALSE"
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCookieDomainMatches(t *testing.T) {
+	tests := []struct {
+		domain     string
+		subdomains bool
+		host       string
+		want       bool
+	}{
+		{"example.com", false, "example.com", true},
+		{"example.com", false, "EXAMPLE.com", true},
+		{"example.com", false, "www.example.com", false},
+		{"example.com", true, "www.example.com", true},
+		{"example.com", true, "a.b.example.com", true},
+		{"example.com", true, "badexample.com", false},
+		{"example.com", true, "example.org", false},
+	}
+
+	for _, tt := range tests {
+		c := cookie{Domain: tt.domain, IncludeSubdomains: tt.subdomains}
+		if got := c.domainMatches(tt.host); got != tt.want {
+			t.Errorf("cookie for %s (subdomains %v) domainMatches(%q) = %v, want %v", tt.domain, tt.subdomains, tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestCookiePathMatches(t *testing.T) {
+	// RFC 6265 section 5.1.4
+	tests := []struct {
+		cookiePath  string
+		requestPath string
+		want        bool
+	}{
+		{"/", "/", true},
+		{"/", "/anything", true},
+		{"/docs", "/docs", true},
+		{"/docs", "/docs/page", true},
+		{"/docs/", "/docs/page", true},
+		{"/docs", "/docsearch", false},
+		{"/docs", "/", false},
+		{"/docs/page", "/docs", false},
+	}
+
+	for _, tt := range tests {
+		if got := (cookie{Path: tt.cookiePath}).pathMatches(tt.requestPath); got != tt.want {
+			t.Errorf("cookie path %s pathMatches(%q) = %v, want %v", tt.cookiePath, tt.requestPath, got, tt.want)
+		}
+	}
+}
+
+func TestDefaultCookiePath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"", "/"},
+		{"/", "/"},
+		{"/login", "/"},
+		{"/account/login", "/account"},
+		{"/a/b/", "/a/b"},
+		{"relative", "/"},
+	}
+
+	for _, tt := range tests {
+		if got := defaultCookiePath(tt.path); got != tt.want {
+			t.Errorf("defaultCookiePath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestParseSetCookie(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	plain := urlOptions{Protocol: "http", Host: "www.example.co.uk", Path: "/account/login?next=/"}
+
+	tests := []struct {
+		name     string
+		value    string
+		target   urlOptions
+		want     cookie
+		errorMsg string
+	}{
+		{
+			name:   "host-only with the default path",
+			value:  "sid=abc123",
+			target: plain,
+			want:   cookie{Domain: "www.example.co.uk", Path: "/account", Name: "sid", Value: "abc123"},
+		},
+		{
+			name:   "domain and attributes",
+			value:  "sid=abc; Domain=.Example.co.uk; Path=/; HttpOnly; SameSite=Lax",
+			target: plain,
+			want:   cookie{Domain: "example.co.uk", IncludeSubdomains: true, Path: "/", HTTPOnly: true, SameSite: "Lax", Name: "sid", Value: "abc"},
+		},
+		{
+			name:   "max-age wins over expires",
+			value:  "a=1; Expires=Wed, 21 Oct 2015 07:28:00 GMT; Max-Age=60",
+			target: plain,
+			want:   cookie{Domain: "www.example.co.uk", Path: "/account", Name: "a", Value: "1", Expires: now.Add(time.Minute)},
+		},
+		{
+			name:   "zero max-age deletes",
+			value:  "a=1; Max-Age=0",
+			target: plain,
+			want:   cookie{Domain: "www.example.co.uk", Path: "/account", Name: "a", Value: "1", Expires: time.Unix(1, 0)},
+		},
+		{
+			name:   "expires date",
+			value:  "a=1; Expires=Wed, 21 Oct 2015 07:28:00 GMT",
+			target: plain,
+			want:   cookie{Domain: "www.example.co.uk", Path: "/account", Name: "a", Value: "1", Expires: time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC)},
+		},
+		{
+			name:   "relative path attribute ignored",
+			value:  "a=1; Path=docs",
+			target: plain,
+			want:   cookie{Domain: "www.example.co.uk", Path: "/account", Name: "a", Value: "1"},
+		},
+		{
+			name:   "public suffix of the host itself stays host-only",
+			value:  "a=1; Domain=github.io",
+			target: urlOptions{Protocol: "http", Host: "github.io", Path: "/"},
+			want:   cookie{Domain: "github.io", Path: "/", Name: "a", Value: "1"},
+		},
+		{
+			name:   "ip address stays host-only",
+			value:  "a=1; Domain=127.0.0.1",
+			target: urlOptions{Protocol: "http", Host: "127.0.0.1", Path: "/"},
+			want:   cookie{Domain: "127.0.0.1", Path: "/", Name: "a", Value: "1"},
+		},
+		{name: "no name", value: "=value", target: plain, errorMsg: "no cookie name"},
+		{name: "no equals sign", value: "flag", target: plain, errorMsg: "no cookie name"},
+		{name: "foreign domain", value: "a=1; Domain=example.org", target: plain, errorMsg: "does not cover"},
+		{name: "public suffix", value: "a=1; Domain=co.uk", target: plain, errorMsg: "public suffix"},
+		{name: "secure over http", value: "a=1; Secure", target: plain, errorMsg: "secure-only"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSetCookie(tt.value, tt.target, now)
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("parseSetCookie(%q) error = %v, want one containing %q", tt.value, err, tt.errorMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseSetCookie(%q) error = %v", tt.value, err)
+			}
+			if !got.Expires.Equal(tt.want.Expires) {
+				t.Errorf("Expires = %v, want %v", got.Expires, tt.want.Expires)
+			}
+			got.Expires, tt.want.Expires = time.Time{}, time.Time{}
+			if got != tt.want {
+				t.Errorf("parseSetCookie(%q) = %+v, want %+v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCookieJarHeader(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	jar := &cookieJar{
+		literal: []string{"given=1"},
+		cookies: []cookie{
+			{Domain: "example.com", Path: "/", Name: "root", Value: "r"},
+			{Domain: "example.com", Path: "/docs", Name: "docs", Value: "d"},
+			{Domain: "example.com", IncludeSubdomains: true, Path: "/", Name: "wide", Value: "w"},
+			{Domain: "other.com", Path: "/", Name: "other", Value: "o"},
+			{Domain: "example.com", Path: "/", Name: "old", Value: "x", Expires: now.Add(-time.Second)},
+			{Domain: "example.com", Path: "/", Name: "secure", Value: "s", Secure: true},
+		},
+	}
+
+	tests := []struct {
+		target urlOptions
+		want   string
+	}{
+		{urlOptions{Protocol: "http", Host: "example.com", Path: "/docs/page?x=1"}, "given=1; docs=d; root=r; wide=w"},
+		{urlOptions{Protocol: "http", Host: "www.example.com", Path: "/docs"}, "given=1; wide=w"},
+		{urlOptions{Protocol: "https", Host: "example.com", Path: "/"}, "given=1; root=r; wide=w; secure=s"},
+	}
+
+	for _, tt := range tests {
+		if got := jar.header(tt.target, now); got != tt.want {
+			t.Errorf("header for %s%s = %q, want %q", tt.target.Host, tt.target.Path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// corsCheck is one line of the CORS report
+type corsCheck struct {
+	ok     bool
+	detail string
+}
+
+// parseInterspersed parses flags that may appear before or after positional
+// arguments and returns the positional arguments in order
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// listContains reports whether a comma-separated header value lists item,
+// compared case-insensitively when fold is set
+func listContains(list string, item string, fold bool) bool {
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == item || (fold && strings.EqualFold(entry, item)) {
+			return true
+		}
+	}
+	return false
+}
+
+// runCORS implements "cccurl cors <url> --origin <origin>": it sends the
+// preflight OPTIONS request and the actual request, then reports which CORS
+// response headers allow or deny the scenario
+func runCORS(args []string) error {
+	var origin, method string
+	var requestHeaders headerList
+	var credentials, verbose bool
+
+	fs := flag.NewFlagSet("cors", flag.ContinueOnError)
+	fs.StringVar(&origin, "origin", "", "Origin of the calling page, e.g. https://app.example")
+	fs.StringVar(&method, "X", "GET", "Method of the actual request")
+	fs.StringVar(&method, "method", "GET", "Method of the actual request")
+	fs.Var(&requestHeaders, "H", "Header the actual request sends; repeat for more")
+	fs.BoolVar(&credentials, "credentials", false, "The page sends credentials (cookies or HTTP auth)")
+	fs.BoolVar(&verbose, "v", false, "Show the requests and responses exchanged")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s cors [options] <URL>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 || origin == "" {
+		fs.Usage()
+		return fmt.Errorf("error: cors needs exactly one URL and --origin")
+	}
+	target := positional[0]
+	method = strings.ToUpper(method)
+	out = console{Silent: !verbose, ShowError: true, Color: colorEnabled(false)}
+
+	ctx, stop := interruptContext()
+	defer stop()
+
+	// Preflight request, as the browser would send it
+	var names []string
+	for _, h := range requestHeaders {
+		names = append(names, headerName(h))
+	}
+	preflightHeaders := headerList{"Origin: " + origin, "Access-Control-Request-Method: " + method}
+	if len(names) > 0 {
+		preflightHeaders = append(preflightHeaders, "Access-Control-Request-Headers: "+strings.ToLower(strings.Join(names, ",")))
+	}
+	preflightOpts := helperOptions("OPTIONS", target)
+	preflightOpts.Headers = preflightHeaders
+	preflight, err := fetchResponse(ctx, &preflightOpts)
+	if err != nil {
+		return err
+	}
+	out.printHead(preflight)
+
+	// Actual request carrying the Origin header
+	actualOpts := helperOptions(method, target)
+	actualOpts.Headers = append(headerList{"Origin: " + origin}, requestHeaders...)
+	actual, err := fetchResponse(ctx, &actualOpts)
+	if err != nil {
+		return err
+	}
+	out.printHead(actual)
+
+	fmt.Printf("Preflight: OPTIONS %s -> %d\n", target, preflight.StatusCode)
+	preflightChecks := corsPreflightChecks(preflight, origin, method, names, credentials)
+	allowed := printCORSChecks(preflightChecks)
+
+	fmt.Printf("Actual request: %s %s -> %d\n", method, target, actual.StatusCode)
+	actualChecks := []corsCheck{corsOriginCheck(actual, origin, credentials)}
+	if credentials {
+		actualChecks = append(actualChecks, corsCredentialsCheck(actual))
+	}
+	if exposed := actual.header("Access-Control-Expose-Headers"); exposed != "" {
+		actualChecks = append(actualChecks, corsCheck{ok: true, detail: "Exposed headers: " + exposed})
+	}
+	allowed = printCORSChecks(actualChecks) && allowed
+
+	if !allowed {
+		fmt.Println("Result: blocked")
+		return &exitError{code: 1, err: fmt.Errorf("CORS request from %s is not allowed", origin)}
+	}
+	fmt.Println("Result: allowed")
+	return nil
+}
+
+// corsPreflightChecks evaluates the preflight response
+func corsPreflightChecks(resp *httpResponse, origin string, method string, headers []string, credentials bool) []corsCheck {
+	checks := []corsCheck{{
+		ok:     resp.StatusCode >= 200 && resp.StatusCode < 300,
+		detail: fmt.Sprintf("Preflight status %d", resp.StatusCode),
+	}}
+	checks = append(checks, corsOriginCheck(resp, origin, credentials))
+
+	allowMethods := resp.header("Access-Control-Allow-Methods")
+	methodOK := listContains(allowMethods, method, false) ||
+		(allowMethods == "*" && !credentials) ||
+		method == "GET" || method == "HEAD" || method == "POST"
+	checks = append(checks, corsCheck{
+		ok:     methodOK,
+		detail: fmt.Sprintf("Method %s (Access-Control-Allow-Methods: %s)", method, allowMethods),
+	})
+
+	allowHeaders := resp.header("Access-Control-Allow-Headers")
+	for _, name := range headers {
+		checks = append(checks, corsCheck{
+			ok:     listContains(allowHeaders, name, true) || (allowHeaders == "*" && !credentials),
+			detail: fmt.Sprintf("Header %s (Access-Control-Allow-Headers: %s)", name, allowHeaders),
+		})
+	}
+
+	if credentials {
+		checks = append(checks, corsCredentialsCheck(resp))
+	}
+	if maxAge := resp.header("Access-Control-Max-Age"); maxAge != "" {
+		checks = append(checks, corsCheck{ok: true, detail: "Preflight cacheable for " + maxAge + " seconds"})
+	}
+	return checks
+}
+
+// corsOriginCheck verifies Access-Control-Allow-Origin; the "*" wildcard is
+// not honored for credentialed requests
+func corsOriginCheck(resp *httpResponse, origin string, credentials bool) corsCheck {
+	allowOrigin := resp.header("Access-Control-Allow-Origin")
+	return corsCheck{
+		ok:     allowOrigin == origin || (allowOrigin == "*" && !credentials),
+		detail: fmt.Sprintf("Origin %s (Access-Control-Allow-Origin: %s)", origin, allowOrigin),
+	}
+}
+
+// corsCredentialsCheck verifies that credentials are explicitly allowed
+func corsCredentialsCheck(resp *httpResponse) corsCheck {
+	value := resp.header("Access-Control-Allow-Credentials")
+	return corsCheck{
+		ok:     value == "true",
+		detail: fmt.Sprintf("Credentials (Access-Control-Allow-Credentials: %s)", value),
+	}
+}
+
+// printCORSChecks prints each check and reports whether all of them passed
+func printCORSChecks(checks []corsCheck) bool {
+	allOK := true
+	for _, check := range checks {
+		mark := "allow"
+		if !check.ok {
+			mark = "deny "
+			allOK = false
+		}
+		fmt.Printf("  [%s] %s\n", mark, check.detail)
+	}
+	return allOK
+}
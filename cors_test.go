@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// corsHandler allows cross-origin PUTs with an X-Token header from
+// https://app.example, credentials included
+func corsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Origin") == "https://app.example" {
+		w.Header().Set("Access-Control-Allow-Origin", "https://app.example")
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+	if r.Method == "OPTIONS" {
+		w.Header().Set("Access-Control-Allow-Methods", "GET, PUT")
+		w.Header().Set("Access-Control-Allow-Headers", "X-Token")
+		w.WriteHeader(204)
+		return
+	}
+	w.Write([]byte("ok"))
+}
+
+func TestCORS(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(corsHandler))
+	t.Cleanup(server.Close)
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(corsHandler))
+	t.Cleanup(tlsServer.Close)
+	roots := filepath.Join(t.TempDir(), "roots.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsServer.Certificate().Raw})
+	if err := os.WriteFile(roots, cert, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		args      []string
+		wantCode  int
+		wantLines []string
+	}{
+		{
+			name:      "allowed",
+			args:      []string{server.URL, "--origin", "https://app.example", "-X", "PUT", "-H", "X-Token: 1", "--credentials"},
+			wantLines: []string{"Preflight: OPTIONS " + server.URL + " -> 204", "  [allow] Method PUT (Access-Control-Allow-Methods: GET, PUT)", "  [allow] Header X-Token (Access-Control-Allow-Headers: X-Token)", "Result: allowed"},
+		},
+		{
+			name:      "over https",
+			args:      []string{tlsServer.URL, "--origin", "https://app.example"},
+			wantLines: []string{"Actual request: GET " + tlsServer.URL + " -> 200", "Result: allowed"},
+		},
+		{
+			name:      "other origin",
+			args:      []string{server.URL, "--origin", "https://evil.example"},
+			wantCode:  1,
+			wantLines: []string{"  [deny ] Origin https://evil.example (Access-Control-Allow-Origin: )", "Result: blocked"},
+		},
+		{
+			name:      "method not allowed",
+			args:      []string{server.URL, "--origin", "https://app.example", "-X", "DELETE"},
+			wantCode:  1,
+			wantLines: []string{"  [deny ] Method DELETE (Access-Control-Allow-Methods: GET, PUT)", "Result: blocked"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := runCLIWithEnv(t, []string{"SSL_CERT_FILE=" + roots}, "", append([]string{"cors"}, tt.args...)...)
+			if result.code != tt.wantCode {
+				t.Fatalf("exit status %d, want %d, stderr:\n%s", result.code, tt.wantCode, result.stderr)
+			}
+			lines := strings.Split(result.stdout, "\n")
+			for _, want := range tt.wantLines {
+				if !slices.Contains(lines, want) {
+					t.Errorf("output has no line %q:\n%s", want, result.stdout)
+				}
+			}
+		})
+	}
+}
+
+func TestListContains(t *testing.T) {
+	tests := []struct {
+		list string
+		item string
+		fold bool
+		want bool
+	}{
+		{list: "GET, PUT", item: "PUT", want: true},
+		{list: "GET, PUT", item: "put"},
+		{list: "X-Token, Content-Type", item: "content-type", fold: true, want: true},
+		{list: "", item: "GET"},
+	}
+
+	for _, tt := range tests {
+		if got := listContains(tt.list, tt.item, tt.fold); got != tt.want {
+			t.Errorf("listContains(%q, %q, %v) = %v, want %v", tt.list, tt.item, tt.fold, got, tt.want)
+		}
+	}
+}
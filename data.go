@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// gzipMagic is the two-byte signature every gzip stream starts with
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// dataKind tells how a data argument is turned into payload
+type dataKind int
+
+const (
+	dataPlain     dataKind = iota // -d
+	dataBinary                    // --data-binary
+	dataRaw                       // --data-raw
+	dataURLEncode                 // --data-urlencode
+	dataJSON                      // --json
+)
+
+// dataArg is one data argument together with the flag that gave it
+type dataArg struct {
+	kind  dataKind
+	value string
+}
+
+// dataList holds the data arguments of all data flags in command-line order
+type dataList []dataArg
+
+// dataFlag is a custom flag type appending arguments of one kind to a shared dataList
+type dataFlag struct {
+	list *dataList
+	kind dataKind
+}
+
+// String returns the string representation of the arguments of this kind
+func (f dataFlag) String() string {
+	if f.list == nil {
+		return ""
+	}
+	var values []string
+	for _, arg := range *f.list {
+		if arg.kind == f.kind {
+			values = append(values, arg.value)
+		}
+	}
+	return strings.Join(values, "&")
+}
+
+// Set appends one argument to the dataList
+func (f dataFlag) Set(value string) error {
+	*f.list = append(*f.list, dataArg{kind: f.kind, value: value})
+	return nil
+}
+
+// loadRequestData resolves the -d arguments into the payload, joining several
+// with '&' into one form body as curl does; --json pieces are joined as they
+// are. The payload is read in full: retries, redirects and authentication
+// handshakes send it again, and signing needs all of it up front
+func loadRequestData(args dataList, expand bool) (string, string, error) {
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		switch arg.kind {
+		case dataRaw:
+			parts[i] = arg.value
+			continue
+		case dataURLEncode:
+			part, err := urlEncodeData(arg.value)
+			if err != nil {
+				return "", "", err
+			}
+			parts[i] = part
+			continue
+		}
+		part, encoding, err := loadDataPart(arg.value, expand)
+		if err != nil {
+			return "", "", err
+		}
+		if encoding != "" {
+			if len(args) > 1 {
+				return "", "", fmt.Errorf("error: the gzip-compressed %s cannot be joined with other -d data; use --expand-input to send it decompressed", arg.value)
+			}
+			return part, encoding, nil
+		}
+		// Like curl, -d reads files as text lines and drops the line breaks;
+		// --data-binary keeps every byte
+		if arg.kind == dataPlain && strings.HasPrefix(arg.value, "@") {
+			part = strings.NewReplacer("\r", "", "\n", "").Replace(part)
+		}
+		parts[i] = part
+	}
+	if len(args) > 0 && args[0].kind == dataJSON {
+		return strings.Join(parts, ""), "", nil
+	}
+	return strings.Join(parts, "&"), "", nil
+}
+
+// loadDataPart resolves one -d argument, reading the payload from a file
+// when it starts with '@', or from stdin for "@-". Gzip-compressed files are
+// decompressed when expand is set and otherwise sent as-is, in which case the
+// returned content encoding is "gzip" so the server knows how to read them
+func loadDataPart(data string, expand bool) (string, string, error) {
+	if !strings.HasPrefix(data, "@") {
+		return data, "", nil
+	}
+
+	name := data[1:]
+	raw, err := readDataFile(name)
+	if err != nil {
+		return "", "", err
+	}
+	if !bytes.HasPrefix(raw, gzipMagic) {
+		return string(raw), "", nil
+	}
+	if !expand {
+		return string(raw), "gzip", nil
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return "", "", fmt.Errorf("error decompressing %s: %v", name, err)
+	}
+	defer zr.Close()
+	expanded, err := io.ReadAll(zr)
+	if err != nil {
+		return "", "", fmt.Errorf("error decompressing %s: %v", name, err)
+	}
+	return string(expanded), "", nil
+}
+
+// applyJSON sets up --json: its pieces make up the whole body, sent like
+// --data-binary, and the JSON media type is announced for the body and the
+// response unless -H gives those headers
+func applyJSON(opts *requestOptions) error {
+	json := 0
+	for _, arg := range opts.DataArgs {
+		if arg.kind == dataJSON {
+			json++
+		}
+	}
+	if json == 0 {
+		return nil
+	}
+	if json != len(opts.DataArgs) {
+		return fmt.Errorf("error: --json cannot be combined with other data flags")
+	}
+	var defaults headerList
+	for _, header := range []string{"Content-Type: application/json", "Accept: application/json"} {
+		if !opts.Headers.has(headerName(header)) {
+			defaults = append(defaults, header)
+		}
+	}
+	opts.Headers = append(defaults, opts.Headers...)
+	return nil
+}
+
+// applyGet moves the resolved payload into the URL query for -G, after any
+// query the URL already has, so the request goes out without a body
+func applyGet(opts *requestOptions) error {
+	if opts.ContentEncoding != "" {
+		return fmt.Errorf("error: -G cannot send gzip-compressed data in the URL; use --expand-input to send it decompressed")
+	}
+	opts.Query = joinQuery(opts.Query, opts.Data)
+	opts.Data = ""
+	return nil
+}
+
+// queryList is a custom flag type collecting --url-query arguments
+type queryList []string
+
+// String returns the string representation of the queryList
+func (q *queryList) String() string {
+	return strings.Join(*q, "&")
+}
+
+// Set appends one --url-query argument
+func (q *queryList) Set(value string) error {
+	*q = append(*q, value)
+	return nil
+}
+
+// applyURLQuery resolves the --url-query arguments into query parameters
+// for every URL, encoded like --data-urlencode content. An argument starting
+// with + is taken as already encoded and added as-is
+func applyURLQuery(opts *requestOptions) error {
+	for _, arg := range opts.URLQueries {
+		param, raw := strings.CutPrefix(arg, "+")
+		if !raw {
+			var err error
+			if param, err = urlEncodeData(arg); err != nil {
+				return err
+			}
+		}
+		opts.Query = joinQuery(opts.Query, param)
+	}
+	return nil
+}
+
+// joinQuery joins two pieces of a query string with '&', skipping empty ones
+func joinQuery(query string, param string) string {
+	if query == "" || param == "" {
+		return query + param
+	}
+	return query + "&" + param
+}
+
+// appendQuery adds query parameters to a URL, after any query it already has
+// and before its #fragment
+func appendQuery(rawURL string, query string) string {
+	if query == "" {
+		return rawURL
+	}
+	base, fragment, hasFragment := strings.Cut(rawURL, "#")
+	separator := "?"
+	if strings.Contains(base, "?") {
+		separator = "&"
+		if strings.HasSuffix(base, "?") || strings.HasSuffix(base, "&") {
+			separator = ""
+		}
+	}
+	rawURL = base + separator + query
+	if hasFragment {
+		rawURL += "#" + fragment
+	}
+	return rawURL
+}
+
+// readDataFile reads the payload file named by a data argument, or stdin for "-"
+func readDataFile(name string) ([]byte, error) {
+	var raw []byte
+	var err error
+	if name == "-" {
+		raw, err = io.ReadAll(os.Stdin)
+	} else {
+		raw, err = os.ReadFile(name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading data file: %v", err)
+	}
+	return raw, nil
+}
+
+// urlEncodeData resolves a --data-urlencode argument in one of curl's forms:
+// "content" and "=content" send content encoded, "name=content" sends
+// name=encoded content, and "@file" and "name@file" do the same with the
+// content of a file (or stdin for "-"), newlines included. Whichever of '='
+// and '@' comes first decides the form
+func urlEncodeData(arg string) (string, error) {
+	i := strings.IndexAny(arg, "=@")
+	if i < 0 {
+		return percentEncode(arg), nil
+	}
+	name, content := arg[:i], arg[i+1:]
+	if arg[i] == '@' {
+		raw, err := readDataFile(content)
+		if err != nil {
+			return "", err
+		}
+		content = string(raw)
+	}
+	if name == "" {
+		return percentEncode(content), nil
+	}
+	return name + "=" + percentEncode(content), nil
+}
+
+// percentEncode escapes everything but unreserved characters, spaces included,
+// the way curl encodes --data-urlencode content
+func percentEncode(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// stdinStream returns the body for a lone -d @- or --data-binary @- when
+// stdin is a pipe and nothing needs the whole payload before sending: no
+// signing, and no authentication handshake, retry or redirect that would
+// send it again. The body is then streamed with chunked encoding as it
+// arrives instead of being read in full first. It returns nil when the
+// payload has to be loaded, along with the content encoding of a gzip stream
+func stdinStream(opts *requestOptions) (uploadBody, string, error) {
+	if len(opts.DataArgs) != 1 || opts.DataArgs[0].value != "@-" {
+		return nil, "", nil
+	}
+	kind := opts.DataArgs[0].kind
+	if kind != dataPlain && kind != dataBinary && kind != dataJSON {
+		return nil, "", nil
+	}
+	if opts.Get || opts.ExpandInput || opts.needsWholeBody() {
+		return nil, "", nil
+	}
+	info, err := os.Stdin.Stat()
+	if err != nil || info.Mode()&os.ModeNamedPipe == 0 {
+		return nil, "", nil
+	}
+
+	stream := &streamUpload{r: os.Stdin, contentType: "application/x-www-form-urlencoded"}
+	encoding := ""
+	reader := bufio.NewReader(os.Stdin)
+	if magic, _ := reader.Peek(len(gzipMagic)); bytes.Equal(magic, gzipMagic) {
+		encoding = "gzip"
+	} else if kind == dataPlain {
+		stream.r = lineJoiner{reader}
+		return stream, "", nil
+	}
+	stream.r = reader
+	return stream, encoding, nil
+}
+
+// lineJoiner drops carriage returns and newlines from a stream, the way -d
+// reads files
+type lineJoiner struct {
+	r io.Reader
+}
+
+// Read reads from the underlying reader, removing line breaks
+func (l lineJoiner) Read(p []byte) (int, error) {
+	for {
+		n, err := l.r.Read(p)
+		kept := 0
+		for _, c := range p[:n] {
+			if c != '\r' && c != '\n' {
+				p[kept] = c
+				kept++
+			}
+		}
+		// Only line breaks arrived; read on rather than report an empty read
+		if kept > 0 || err != nil {
+			return kept, err
+		}
+	}
+}
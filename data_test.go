@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestURLEncodeData(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "payload.txt")
+	if err := os.WriteFile(file, []byte("a b&c\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		arg     string
+		want    string
+		wantErr bool
+	}{
+		{arg: "hello world", want: "hello%20world"},
+		{arg: "=a=b&c", want: "a%3Db%26c"},
+		{arg: "name=a b+c", want: "name=a%20b%2Bc"},
+		{arg: "name=", want: "name="},
+		{arg: "q=x@y", want: "q=x%40y"},
+		{arg: "@" + file, want: "a%20b%26c%0A"},
+		{arg: "name@" + file, want: "name=a%20b%26c%0A"},
+		{arg: "name@" + file + ".missing", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := urlEncodeData(tt.arg)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("urlEncodeData(%q) = %q, want an error", tt.arg, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("urlEncodeData(%q) error = %v", tt.arg, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("urlEncodeData(%q) = %q, want %q", tt.arg, got, tt.want)
+		}
+	}
+}
+
+func TestPercentEncode(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"", ""},
+		{"AZaz09-_.~", "AZaz09-_.~"},
+		{"a b", "a%20b"},
+		{"a+b", "a%2Bb"},
+		{"/?#[]", "%2F%3F%23%5B%5D"},
+		{"é", "%C3%A9"},
+	}
+
+	for _, tt := range tests {
+		if got := percentEncode(tt.in); got != tt.want {
+			t.Errorf("percentEncode(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestAppendQuery(t *testing.T) {
+	tests := []struct {
+		url   string
+		query string
+		want  string
+	}{
+		{"http://h/p", "", "http://h/p"},
+		{"http://h/p", "a=1", "http://h/p?a=1"},
+		{"http://h/p?x=0", "a=1", "http://h/p?x=0&a=1"},
+		{"http://h/p?", "a=1", "http://h/p?a=1"},
+		{"http://h/p?x=0&", "a=1", "http://h/p?x=0&a=1"},
+		{"http://h/p#top", "a=1", "http://h/p?a=1#top"},
+	}
+
+	for _, tt := range tests {
+		if got := appendQuery(tt.url, tt.query); got != tt.want {
+			t.Errorf("appendQuery(%q, %q) = %q, want %q", tt.url, tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestStdinData(t *testing.T) {
+	const payload = `{"name":"cc"}`
+	redirecting := func(w http.ResponseWriter, r *http.Request, body string) {
+		if r.URL.Path != "/final" {
+			http.Redirect(w, r, "/final", http.StatusTemporaryRedirect)
+			return
+		}
+		w.Write([]byte("ok"))
+	}
+	ok := func(w http.ResponseWriter, r *http.Request, body string) { w.Write([]byte("ok")) }
+
+	tests := []struct {
+		name        string
+		args        []string
+		handler     func(w http.ResponseWriter, r *http.Request, body string)
+		wantLength  int64
+		wantRequest int
+	}{
+		{name: "streamed", args: []string{"--data-binary", "@-"}, handler: ok, wantLength: -1, wantRequest: 1},
+		{name: "json streamed", args: []string{"--json", "@-"}, handler: ok, wantLength: -1, wantRequest: 1},
+		{name: "read in full for -L", args: []string{"--data-binary", "@-", "-L"}, handler: redirecting, wantLength: int64(len(payload)), wantRequest: 2},
+		{name: "read in full for --retry", args: []string{"--data-binary", "@-", "--retry", "1"}, handler: ok, wantLength: int64(len(payload)), wantRequest: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(t, tt.handler)
+			result := runCLI(t, payload, append(append([]string{"-s", "-S"}, tt.args...), server.URL+"/post")...)
+			if result.code != 0 {
+				t.Fatalf("exit status %d, stderr:\n%s", result.code, result.stderr)
+			}
+			requests := server.received()
+			if len(requests) != tt.wantRequest {
+				t.Fatalf("%d requests, want %d", len(requests), tt.wantRequest)
+			}
+			for _, r := range requests {
+				if r.Method != "POST" || r.Body != payload || r.ContentLength != tt.wantLength {
+					t.Errorf("%s %s with body %q and Content-Length %d, want POST with %q and %d", r.Method, r.URL, r.Body, r.ContentLength, payload, tt.wantLength)
+				}
+			}
+		})
+	}
+}
+
+func TestFollowRedirectsRefusesStream(t *testing.T) {
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request, body string) {
+		http.Redirect(w, r, "/final", http.StatusTemporaryRedirect)
+	})
+	opts := helperOptions("POST", server.URL+"/post")
+	opts.Location = true
+	opts.MaxRedirs = 50
+	opts.Upload = &streamUpload{r: strings.NewReader("once")}
+
+	_, _, _, err := followRedirects(context.Background(), &opts, newTransferStats())
+	if err == nil || !strings.Contains(err.Error(), "cannot be sent again") {
+		t.Fatalf("followRedirects error = %v, want a refusal to send the stream again", err)
+	}
+	if requests := server.received(); len(requests) != 1 {
+		t.Errorf("%d requests, want only the first", len(requests))
+	}
+}
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// sourcePool is a custom flag type holding local source addresses that are
+// handed out round-robin, one per transfer
+type sourcePool struct {
+	addrs []net.IP
+	next  int
+}
+
+// String returns the string representation of the sourcePool
+func (p *sourcePool) String() string {
+	parts := make([]string, len(p.addrs))
+	for i, ip := range p.addrs {
+		parts[i] = ip.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// Set parses a comma-separated list of IP addresses and appends them to the pool
+func (p *sourcePool) Set(value string) error {
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		ip := net.ParseIP(part)
+		if ip == nil {
+			return fmt.Errorf("invalid source address: %s", part)
+		}
+		p.addrs = append(p.addrs, ip)
+	}
+	return nil
+}
+
+// pick returns the next source address in the rotation, or nil when the pool is empty
+func (p *sourcePool) pick() net.IP {
+	if len(p.addrs) == 0 {
+		return nil
+	}
+	ip := p.addrs[p.next%len(p.addrs)]
+	p.next++
+	return ip
+}
+
+// portRange is a custom flag type holding the local ports a connection may
+// be bound to, given as a port or a first-last range
+type portRange struct {
+	first int
+	last  int
+}
+
+// String returns the string representation of the portRange
+func (r *portRange) String() string {
+	if r.first == 0 {
+		return ""
+	}
+	if r.first == r.last {
+		return strconv.Itoa(r.first)
+	}
+	return fmt.Sprintf("%d-%d", r.first, r.last)
+}
+
+// Set parses a port or a first-last port range
+func (r *portRange) Set(value string) error {
+	first, last, isRange := strings.Cut(value, "-")
+	if !isRange {
+		last = first
+	}
+	var err error
+	if r.first, err = strconv.Atoi(strings.TrimSpace(first)); err == nil {
+		r.last, err = strconv.Atoi(strings.TrimSpace(last))
+	}
+	if err != nil || r.first < 1 || r.last > 65535 || r.last < r.first {
+		return fmt.Errorf("invalid local port range: %s", value)
+	}
+	return nil
+}
+
+// interfaceAddrs returns the addresses to bind to for --interface: the
+// address itself when one is given, or those of the named network interface
+func interfaceAddrs(name string) ([]net.IP, error) {
+	if ip := net.ParseIP(name); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("error using interface %s: %v", name, err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("error using interface %s: %v", name, err)
+	}
+	var ips []net.IP
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok {
+			ips = append(ips, ipNet.IP)
+		}
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("error using interface %s: it has no address", name)
+	}
+	return ips, nil
+}
+
+// dialTCP opens a TCP connection to address, binding to localIP when one is
+// given. With a local port range, the ports are tried in order until one is
+// free
+func dialTCP(ctx context.Context, address string, localIP net.IP, ports portRange) (net.Conn, error) {
+	if ports.first == 0 {
+		var dialer net.Dialer
+		if localIP != nil {
+			dialer.LocalAddr = &net.TCPAddr{IP: localIP}
+		}
+		return dialer.DialContext(ctx, "tcp", address)
+	}
+	for port := ports.first; port <= ports.last; port++ {
+		dialer := net.Dialer{LocalAddr: &net.TCPAddr{IP: localIP, Port: port}}
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if !errors.Is(err, syscall.EADDRINUSE) && !errors.Is(err, syscall.EADDRNOTAVAIL) {
+			return conn, err
+		}
+	}
+	return nil, fmt.Errorf("no local port in %s is free", ports.String())
+}
+
+// portList is a custom flag type holding candidate ports to probe in order
+type portList []string
+
+// String returns the string representation of the portList
+func (p *portList) String() string {
+	return strings.Join(*p, ",")
+}
+
+// Set parses a comma-separated list of ports and appends them to the portList
+func (p *portList) Set(value string) error {
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("invalid port: %s", part)
+		}
+		*p = append(*p, part)
+	}
+	return nil
+}
+
+// resolveHost looks up the addresses for host with resolver in the network
+// family, "ip" for both or "ip4" or "ip6" for one; IP literals are returned
+// as-is when they belong to it
+func resolveHost(ctx context.Context, resolver *net.Resolver, host string, network string) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		if (network == "ip4" && ip.To4() == nil) || (network == "ip6" && ip.To4() != nil) {
+			return nil, fmt.Errorf("%s is not an %s address", host, familyName(network))
+		}
+		return []net.IP{ip}, nil
+	}
+	return resolver.LookupIP(ctx, network, host)
+}
+
+// familyName returns the name of the address family of a network
+func familyName(network string) string {
+	if network == "ip6" {
+		return "IPv6"
+	}
+	return "IPv4"
+}
+
+// network returns the address family the host is resolved in: "ip4" for -4,
+// "ip6" for -6, or "ip" for either
+func (opts *requestOptions) network() string {
+	switch {
+	case opts.IPv4:
+		return "ip4"
+	case opts.IPv6:
+		return "ip6"
+	}
+	return "ip"
+}
+
+// dialAddrs tries each resolved address in turn on the given port, binding
+// to the first source address of the same family. Addresses of a family no
+// source address has are skipped
+func dialAddrs(ctx context.Context, addrs []net.IP, port string, localIPs []net.IP, ports portRange) (net.Conn, error) {
+	err := fmt.Errorf("no address to connect to")
+	if len(localIPs) > 0 {
+		err = fmt.Errorf("no address matches the family of source address %s", (&sourcePool{addrs: localIPs}).String())
+	}
+	for _, ip := range addrs {
+		var localIP net.IP
+		if len(localIPs) > 0 {
+			i := slices.IndexFunc(localIPs, func(local net.IP) bool { return (ip.To4() == nil) == (local.To4() == nil) })
+			if i < 0 {
+				continue
+			}
+			localIP = localIPs[i]
+		}
+		var conn net.Conn
+		conn, err = dialTCP(ctx, net.JoinHostPort(ip.String(), port), localIP, ports)
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+// localIPs returns the source addresses a transfer may bind to: the next one
+// of --interface-rotate, or those of --interface
+func (opts *requestOptions) localIPs() ([]net.IP, error) {
+	if ip := opts.Sources.pick(); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	if opts.Interface != "" {
+		return interfaceAddrs(opts.Interface)
+	}
+	return nil, nil
+}
+
+// connect resolves the host and opens the connection for a transfer. Name
+// resolution and connecting share the --connect-timeout budget, and the
+// returned connection stays bound to ctx so that reads and writes fail once
+// the transfer is cancelled or hits --max-time
+func connect(ctx context.Context, host string, port string, opts *requestOptions, stats *transferStats) (net.Conn, error) {
+	conn, _, err := dialConn(ctx, host, port, opts, stats)
+	if err != nil {
+		return nil, err
+	}
+	bound, _ := bindConn(ctx, conn, opts, stats)
+	return bound, nil
+}
+
+// connectTLS opens a connection for a helper exchange over https, verifying
+// the server certificate against the system roots for host
+func connectTLS(ctx context.Context, host string, port string, opts *requestOptions, stats *transferStats) (net.Conn, error) {
+	conn, err := connect(ctx, host, port, opts, stats)
+	if err != nil {
+		return nil, err
+	}
+	secure := tls.Client(conn, &tls.Config{ServerName: host})
+	if err := secure.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error in the TLS handshake with %s: %v", net.JoinHostPort(host, port), err)
+	}
+	return secure, nil
+}
+
+// dialConn resolves the host and opens a TCP connection to it, within the
+// --connect-timeout budget, with the socket options of the transfer applied.
+// When candidate ports are given they are probed in order instead of port,
+// and the one the connection was made on is returned
+func dialConn(ctx context.Context, host string, port string, opts *requestOptions, stats *transferStats) (net.Conn, string, error) {
+	localIPs, err := opts.localIPs()
+	if err != nil {
+		return nil, "", err
+	}
+
+	connectCtx := ctx
+	if opts.ConnectTimeout > 0 {
+		var cancel context.CancelFunc
+		connectCtx, cancel = context.WithTimeout(ctx, seconds(opts.ConnectTimeout))
+		defer cancel()
+	}
+
+	conn, port, err := connectAddrs(connectCtx, host, port, opts, localIPs, stats)
+	if err != nil {
+		if connectCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+			return nil, "", &exitError{
+				code: exitOperationTimedOut,
+				err:  fmt.Errorf("Connection timed out after %s", out.duration(time.Since(stats.Start))),
+			}
+		}
+		return nil, "", err
+	}
+	stats.connected(conn)
+	if opts.Linger >= 0 {
+		if err := tcpConn(conn).SetLinger(opts.Linger); err != nil {
+			conn.Close()
+			return nil, "", fmt.Errorf("error setting linger: %v", err)
+		}
+	}
+	return conn, port, nil
+}
+
+// bindConn ties an open connection to the transfer: pending reads and writes
+// fail once ctx ends, and the idle-read and rate-limiting wrappers the
+// options ask for are added. The returned function detaches the connection
+// from ctx again, reporting false when ctx has already ended
+func bindConn(ctx context.Context, conn net.Conn, opts *requestOptions, stats *transferStats) (net.Conn, func() bool) {
+	// Unblock any pending read or write as soon as the transfer context ends
+	detach := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Unix(1, 0))
+	})
+	if opts.ReadTimeout > 0 {
+		conn = &idleConn{Conn: conn, stats: stats}
+	}
+	if opts.LimitRate > 0 {
+		conn = newThrottledConn(ctx, conn, int64(opts.LimitRate))
+	}
+	return conn, detach
+}
+
+// connectAddrs resolves the host, unless --resolve gives its addresses, and
+// dials it, probing --try-ports candidates in order. It returns the port the
+// connection was made on
+func connectAddrs(ctx context.Context, host string, port string, opts *requestOptions, localIPs []net.IP, stats *transferStats) (net.Conn, string, error) {
+	addrs, err := lookupHost(ctx, host, port, opts)
+	if err != nil {
+		return nil, "", fmt.Errorf("error resolving %s: %v", host, err)
+	}
+	stats.NameLookup = time.Since(stats.Start)
+
+	if len(opts.TryPorts) == 0 {
+		conn, err := dialAddrs(ctx, addrs, port, localIPs, opts.LocalPort)
+		if err != nil {
+			return nil, "", fmt.Errorf("error connecting to %s: %w", net.JoinHostPort(host, port), err)
+		}
+		return conn, port, nil
+	}
+
+	for _, candidate := range opts.TryPorts {
+		conn, err := dialAddrs(ctx, addrs, candidate, localIPs, opts.LocalPort)
+		if err != nil {
+			out.Printf("Port %s failed: %v\n", candidate, err)
+			continue
+		}
+		out.Printf("Connected on port %s\n", candidate)
+		return conn, candidate, nil
+	}
+	return nil, "", fmt.Errorf("error connecting to %s: no port in %s accepted the connection", host, opts.TryPorts.String())
+}
+
+// probePorts finds the --try-ports candidate the URL is served on, before
+// the transfer builds its request, and returns the URL with that port so
+// that the Host header, the effective URL and relative redirects all carry
+// it. The probing connection is left in the idle pool for the request
+func probePorts(ctx context.Context, opts *requestOptions) (string, error) {
+	target, err := parseURL(opts.URL)
+	if err != nil || target.Protocol != "http" {
+		// The transfer reports what is wrong with the URL
+		return opts.URL, nil
+	}
+	conn, port, err := dialConn(ctx, target.Host, target.Port, opts, newTransferStats())
+	if err != nil {
+		return "", err
+	}
+	if opts.reusesConns() {
+		idleConns.put(poolKey(target.Host, port, opts), conn)
+	} else {
+		conn.Close()
+	}
+	return withPort(opts.URL, port)
+}
+
+// tcpConn returns the TCP connection underneath conn, looking through the
+// rate-limiting, idle-tracking, metering, pooling and TLS wrappers
+func tcpConn(conn net.Conn) *net.TCPConn {
+	for {
+		switch c := conn.(type) {
+		case *throttledConn:
+			conn = c.Conn
+		case *idleConn:
+			conn = c.Conn
+		case *meteredConn:
+			conn = c.Conn
+		case *pooledConn:
+			conn = c.Conn
+		case *tls.Conn:
+			conn = c.NetConn()
+		default:
+			return conn.(*net.TCPConn)
+		}
+	}
+}
+
+// closeWrite half-closes conn: the server sees a FIN while responses can still be read
+func closeWrite(conn net.Conn) error {
+	if err := tcpConn(conn).CloseWrite(); err != nil {
+		return fmt.Errorf("error shutting down the sending side: %v", err)
+	}
+	return nil
+}
+
+// withPort returns rawURL with the port of its authority set to port, the
+// rest of the URL kept as typed
+func withPort(rawURL string, port string) (string, error) {
+	scheme := strings.Index(rawURL, "://")
+	if scheme < 0 {
+		return "", fmt.Errorf("Error parsing URL: missing scheme in %s", rawURL)
+	}
+	start := scheme + len("://")
+	end := len(rawURL)
+	if i := strings.IndexAny(rawURL[start:], "/?#"); i >= 0 {
+		end = start + i
+	}
+	if at := strings.LastIndexByte(rawURL[start:end], '@'); at >= 0 {
+		start += at + 1
+	}
+	host := rawURL[start:end]
+	if strings.HasPrefix(host, "[") {
+		host, _, _ = strings.Cut(host, "]")
+		host += "]"
+	} else if colon := strings.LastIndexByte(host, ':'); colon >= 0 {
+		host = host[:colon]
+	}
+	return rawURL[:start] + host + ":" + port + rawURL[end:], nil
+}
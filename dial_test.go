@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestWithPort(t *testing.T) {
+	tests := []struct {
+		url     string
+		port    string
+		want    string
+		wantErr bool
+	}{
+		{url: "http://example.com", port: "8080", want: "http://example.com:8080"},
+		{url: "http://example.com/a?b#c", port: "8080", want: "http://example.com:8080/a?b#c"},
+		{url: "http://example.com:80/", port: "8080", want: "http://example.com:8080/"},
+		{url: "http://user:p@ss@example.com/", port: "81", want: "http://user:p@ss@example.com:81/"},
+		{url: "http://[::1]/x", port: "81", want: "http://[::1]:81/x"},
+		{url: "http://[::1]:80", port: "81", want: "http://[::1]:81"},
+		{url: "http://bücher.example/", port: "81", want: "http://bücher.example:81/"},
+		{url: "example.com", port: "81", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := withPort(tt.url, tt.port)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("withPort(%q, %q) = %q, want an error", tt.url, tt.port, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("withPort(%q, %q) error = %v", tt.url, tt.port, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("withPort(%q, %q) = %q, want %q", tt.url, tt.port, got, tt.want)
+		}
+	}
+}
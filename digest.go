@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"slices"
+	"strings"
+)
+
+// digestChallenge holds the parameters of a WWW-Authenticate: Digest challenge
+type digestChallenge struct {
+	params    map[string]string
+	algorithm string
+	session   bool
+	newHash   func() hash.Hash
+}
+
+// parseAuthParams splits a comma-separated list of auth-params, unquoting
+// quoted-string values. Parameter names are lowercased
+func parseAuthParams(s string) map[string]string {
+	params := map[string]string{}
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimLeft(s, ", \t") {
+		name, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			break
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		rest = strings.TrimLeft(rest, " \t")
+		var value strings.Builder
+		if strings.HasPrefix(rest, `"`) {
+			i := 1
+			for ; i < len(rest) && rest[i] != '"'; i++ {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+				}
+				value.WriteByte(rest[i])
+			}
+			s = rest[min(i+1, len(rest)):]
+		} else {
+			end := strings.IndexByte(rest, ',')
+			if end < 0 {
+				end = len(rest)
+			}
+			value.WriteString(strings.TrimSpace(rest[:end]))
+			s = rest[end:]
+		}
+		params[name] = value.String()
+	}
+	return params
+}
+
+// parseDigestChallenge picks the strongest Digest challenge the response
+// offers, preferring SHA-256 over MD5, or returns nil when there is none
+func parseDigestChallenge(resp *httpResponse) *digestChallenge {
+	var best *digestChallenge
+	for _, h := range resp.Headers {
+		scheme, rest, _ := strings.Cut(h.Value, " ")
+		if !strings.EqualFold(h.Name, "WWW-Authenticate") || !strings.EqualFold(scheme, "Digest") {
+			continue
+		}
+		params := parseAuthParams(rest)
+		if params["nonce"] == "" {
+			continue
+		}
+		algorithm := strings.ToUpper(params["algorithm"])
+		if algorithm == "" {
+			algorithm = "MD5"
+		}
+		challenge := &digestChallenge{params: params, algorithm: algorithm}
+		base, session := strings.CutSuffix(algorithm, "-SESS")
+		challenge.session = session
+		switch base {
+		case "MD5":
+			challenge.newHash = md5.New
+		case "SHA-256":
+			challenge.newHash = sha256.New
+		default:
+			continue
+		}
+		if best == nil || (base == "SHA-256" && !strings.HasPrefix(best.algorithm, "SHA-256")) {
+			best = challenge
+		}
+	}
+	return best
+}
+
+// digest hashes the colon-joined parts with the challenge's algorithm
+func (c *digestChallenge) digest(parts ...string) string {
+	h := c.newHash()
+	io.WriteString(h, strings.Join(parts, ":"))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// qop picks the quality of protection to answer with. Plain auth is
+// preferred; auth-int, which hashes the body, is only used when it is the
+// sole option
+func (c *digestChallenge) qop() string {
+	offered := strings.Split(strings.ReplaceAll(c.params["qop"], " ", ""), ",")
+	switch {
+	case slices.Contains(offered, "auth"):
+		return "auth"
+	case slices.Contains(offered, "auth-int"):
+		return "auth-int"
+	}
+	return ""
+}
+
+// authorization computes the Digest Authorization value answering the
+// challenge for one request, following RFC 7616. bodyHash is the hex digest
+// of the body under the challenge's algorithm, needed for auth-int only
+func (c *digestChallenge) authorization(credentials string, method string, uri string, bodyHash string, cnonce string) string {
+	user, password, _ := strings.Cut(credentials, ":")
+	realm, nonce := c.params["realm"], c.params["nonce"]
+
+	ha1 := c.digest(user, realm, password)
+	if c.session {
+		ha1 = c.digest(ha1, nonce, cnonce)
+	}
+
+	qop := c.qop()
+	ha2 := c.digest(method, uri)
+	if qop == "auth-int" {
+		ha2 = c.digest(method, uri, bodyHash)
+	}
+
+	const nc = "00000001"
+	var response string
+	if qop != "" {
+		response = c.digest(ha1, nonce, nc, cnonce, qop, ha2)
+	} else {
+		response = c.digest(ha1, nonce, ha2)
+	}
+
+	fields := []string{
+		fmt.Sprintf("username=%q", user),
+		fmt.Sprintf("realm=%q", realm),
+		fmt.Sprintf("nonce=%q", nonce),
+		fmt.Sprintf("uri=%q", uri),
+		"algorithm=" + c.algorithm,
+		fmt.Sprintf("response=%q", response),
+	}
+	if qop != "" {
+		fields = append(fields, "qop="+qop, "nc="+nc, fmt.Sprintf("cnonce=%q", cnonce))
+	}
+	if opaque, ok := c.params["opaque"]; ok {
+		fields = append(fields, fmt.Sprintf("opaque=%q", opaque))
+	}
+	return "Digest " + strings.Join(fields, ", ")
+}
+
+// newCnonce returns the client nonce; with --deterministic it is derived from
+// the server nonce so that repeated runs send identical requests
+func newCnonce(opts *requestOptions, nonce string) string {
+	if opts.Deterministic {
+		sum := sha256.Sum256([]byte(nonce))
+		return hex.EncodeToString(sum[:8])
+	}
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// digestRequest performs doRequest and answers a 401 Digest challenge by
+// resending the request once with the computed Authorization header
+func digestRequest(ctx context.Context, opts *requestOptions, target string, stats *transferStats) (*httpResponse, io.Reader, net.Conn, error) {
+	resp, body, conn, err := doRequest(ctx, opts, target, stats)
+	if err != nil || resp.StatusCode != 401 {
+		return resp, body, conn, err
+	}
+	return answerDigest(ctx, opts, target, resp, body, conn, stats)
+}
+
+// answerDigest resends the request rejected with resp, answering its Digest
+// challenge. Without credentials or a usable challenge resp is kept as is
+func answerDigest(ctx context.Context, opts *requestOptions, target string, resp *httpResponse, body io.Reader, conn net.Conn, stats *transferStats) (*httpResponse, io.Reader, net.Conn, error) {
+	options, err := parseURL(target)
+	if err != nil {
+		return resp, body, conn, nil
+	}
+	credentials := credentials(opts, options)
+	challenge := parseDigestChallenge(resp)
+	if credentials == "" || challenge == nil {
+		return resp, body, conn, nil
+	}
+	out.printHead(resp)
+	conn.Close()
+
+	var bodyHash string
+	if challenge.qop() == "auth-int" {
+		if bodyHash, err = payloadHash(opts, challenge.newHash); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	authorized := *opts
+	value := challenge.authorization(credentials, opts.Method, options.Path, bodyHash, newCnonce(opts, challenge.params["nonce"]))
+	authorized.Headers = opts.Headers.with("Authorization: " + value)
+	return doRequest(ctx, &authorized, target, stats)
+}
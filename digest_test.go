@@ -0,0 +1,191 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseAuthParams(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want map[string]string
+	}{
+		{
+			name: "quoted and token values",
+			in:   `realm="test", nonce="abc", qop=auth, algorithm=MD5`,
+			want: map[string]string{"realm": "test", "nonce": "abc", "qop": "auth", "algorithm": "MD5"},
+		},
+		{
+			name: "commas and escapes inside quotes",
+			in:   `realm="a, \"b\"", qop="auth,auth-int"`,
+			want: map[string]string{"realm": `a, "b"`, "qop": "auth,auth-int"},
+		},
+		{
+			name: "names lowercased, spaces around",
+			in:   `  Realm = "x" ,NONCE=y  `,
+			want: map[string]string{"realm": "x", "nonce": "y"},
+		},
+		{
+			name: "empty",
+			in:   "",
+			want: map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseAuthParams(tt.in)
+			if len(got) != len(tt.want) {
+				t.Fatalf("parseAuthParams(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+			for name, value := range tt.want {
+				if got[name] != value {
+					t.Errorf("parseAuthParams(%q)[%q] = %q, want %q", tt.in, name, got[name], value)
+				}
+			}
+		})
+	}
+}
+
+func TestParseDigestChallenge(t *testing.T) {
+	tests := []struct {
+		name      string
+		headers   []string
+		algorithm string // "" when no challenge is usable
+	}{
+		{
+			name:      "md5 by default",
+			headers:   []string{`Digest realm="r", nonce="n"`},
+			algorithm: "MD5",
+		},
+		{
+			name:      "sha-256 preferred",
+			headers:   []string{`Digest realm="r", nonce="n", algorithm=MD5`, `Digest realm="r", nonce="n", algorithm=SHA-256`},
+			algorithm: "SHA-256",
+		},
+		{
+			name:      "session variant",
+			headers:   []string{`Digest realm="r", nonce="n", algorithm=md5-sess`},
+			algorithm: "MD5-SESS",
+		},
+		{
+			name:    "unknown algorithm skipped",
+			headers: []string{`Digest realm="r", nonce="n", algorithm=SHA-512-256`},
+		},
+		{
+			name:    "nonce required",
+			headers: []string{`Digest realm="r"`},
+		},
+		{
+			name:    "other schemes ignored",
+			headers: []string{`Basic realm="r"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &httpResponse{StatusCode: 401}
+			for _, value := range tt.headers {
+				resp.Headers = append(resp.Headers, headerField{Name: "WWW-Authenticate", Value: value})
+			}
+			challenge := parseDigestChallenge(resp)
+			if tt.algorithm == "" {
+				if challenge != nil {
+					t.Fatalf("parseDigestChallenge() = %+v, want nil", challenge)
+				}
+				return
+			}
+			if challenge == nil {
+				t.Fatalf("parseDigestChallenge() = nil, want %s", tt.algorithm)
+			}
+			if challenge.algorithm != tt.algorithm {
+				t.Errorf("algorithm = %s, want %s", challenge.algorithm, tt.algorithm)
+			}
+		})
+	}
+}
+
+func TestDigestAuthorization(t *testing.T) {
+	tests := []struct {
+		name        string
+		challenge   string
+		credentials string
+		method      string
+		uri         string
+		bodyHash    string
+		cnonce      string
+		response    string
+	}{
+		{
+			// RFC 2617 section 3.5
+			name:        "rfc 2617 md5",
+			challenge:   `Digest realm="testrealm@host.com", qop="auth,auth-int", nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093", opaque="5ccc069c403ebaf9f0171e9517f40e41"`,
+			credentials: "Mufasa:Circle Of Life",
+			method:      "GET",
+			uri:         "/dir/index.html",
+			cnonce:      "0a4f113b",
+			response:    "6629fae49393a05397450978507c4ef1",
+		},
+		{
+			// RFC 7616 section 3.9.1
+			name:        "rfc 7616 md5",
+			challenge:   `Digest realm="http-auth@example.org", qop="auth, auth-int", algorithm=MD5, nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`,
+			credentials: "Mufasa:Circle of Life",
+			method:      "GET",
+			uri:         "/dir/index.html",
+			cnonce:      "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ",
+			response:    "8ca523f5e9506fed4657c9700eebdbec",
+		},
+		{
+			// RFC 7616 section 3.9.1
+			name:        "rfc 7616 sha-256",
+			challenge:   `Digest realm="http-auth@example.org", qop="auth, auth-int", algorithm=SHA-256, nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`,
+			credentials: "Mufasa:Circle of Life",
+			method:      "GET",
+			uri:         "/dir/index.html",
+			cnonce:      "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ",
+			response:    "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1",
+		},
+		{
+			name:        "no qop",
+			challenge:   `Digest realm="testrealm@host.com", nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093"`,
+			credentials: "Mufasa:Circle Of Life",
+			method:      "GET",
+			uri:         "/dir/index.html",
+			cnonce:      "0a4f113b",
+			response:    "670fd8c2df070c60b045671b8b24ff02",
+		},
+		{
+			name:        "session with auth-int only",
+			challenge:   `Digest realm="testrealm@host.com", qop="auth-int", algorithm=MD5-sess, nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093"`,
+			credentials: "Mufasa:Circle Of Life",
+			method:      "POST",
+			uri:         "/dir/index.html",
+			bodyHash:    "d41d8cd98f00b204e9800998ecf8427e",
+			cnonce:      "0a4f113b",
+			response:    "934fb4a35936d210b83a84e862ac834f",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &httpResponse{Headers: []headerField{{Name: "WWW-Authenticate", Value: tt.challenge}}}
+			challenge := parseDigestChallenge(resp)
+			if challenge == nil {
+				t.Fatal("parseDigestChallenge() = nil")
+			}
+			got := challenge.authorization(tt.credentials, tt.method, tt.uri, tt.bodyHash, tt.cnonce)
+			params := parseAuthParams(strings.TrimPrefix(got, "Digest "))
+			if params["response"] != tt.response {
+				t.Errorf("response = %s, want %s\nAuthorization: %s", params["response"], tt.response, got)
+			}
+			if params["uri"] != tt.uri || params["username"] != strings.Split(tt.credentials, ":")[0] {
+				t.Errorf("Authorization = %s, want uri %s and the user", got, tt.uri)
+			}
+			if opaque := challenge.params["opaque"]; params["opaque"] != opaque {
+				t.Errorf("opaque = %q, want %q", params["opaque"], opaque)
+			}
+		})
+	}
+}
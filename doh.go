@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// DNS record types queried over DoH
+const (
+	dnsTypeA    = 1
+	dnsTypeAAAA = 28
+)
+
+// dohNegativeTTL is how long an answer without addresses is cached, since
+// its TTL would be in an SOA record this client does not read
+const dohNegativeTTL = 60 * time.Second
+
+// dohAnswers caches the addresses DoH queries returned, for the rest of the
+// invocation or until their TTL runs out, so every transfer, redirect and
+// retry to a host does not query again
+var dohAnswers = &dnsCache{}
+
+// resolveDoH looks up the addresses for host with DNS over HTTPS (RFC 8484),
+// POSTing A and AAAA queries, as the network family asks, to --doh-url. The
+// queries go over TLS for an https:// URL, and connect the way the transfer
+// does; the DoH server's own name is resolved by --resolve or the system
+func resolveDoH(ctx context.Context, opts *requestOptions, host string, network string) ([]net.IP, error) {
+	var types []uint16
+	if network != "ip4" {
+		types = append(types, dnsTypeAAAA)
+	}
+	if network != "ip6" {
+		types = append(types, dnsTypeA)
+	}
+	var addrs []net.IP
+	for _, qtype := range types {
+		found, err := queryDoH(ctx, opts, host, qtype)
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, found...)
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no address found for %s with DoH", host)
+	}
+	return addrs, nil
+}
+
+// queryDoH sends one query to the DoH server, answering from the cache when
+// the same query was made before and its answer is still valid
+func queryDoH(ctx context.Context, opts *requestOptions, host string, qtype uint16) ([]net.IP, error) {
+	key := fmt.Sprintf("%s %s %d", opts.DoHURL, strings.ToLower(host), qtype)
+	if addrs, ok := dohAnswers.get(key, time.Now()); ok {
+		return addrs, nil
+	}
+	query, err := dnsQuery(host, qtype)
+	if err != nil {
+		return nil, err
+	}
+	// The DoH server's own name is resolved without DoH
+	helper := opts.helperFor("POST", opts.DoHURL)
+	helper.DoHURL = ""
+	helper.Data = string(query)
+	helper.DataType = "application/dns-message"
+	helper.Headers = headerList{"Accept: application/dns-message"}
+	resp, err := fetchResponse(ctx, &helper)
+	if err != nil {
+		return nil, fmt.Errorf("error querying %s: %v", opts.DoHURL, err)
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("error querying %s: %d %s", opts.DoHURL, resp.StatusCode, resp.Status)
+	}
+	addrs, ttl, err := parseDNSAnswer(resp.Body, qtype)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the answer of %s: %v", opts.DoHURL, err)
+	}
+	lifetime := time.Duration(ttl) * time.Second
+	if len(addrs) == 0 {
+		lifetime = dohNegativeTTL
+	}
+	dohAnswers.put(key, addrs, time.Now().Add(lifetime))
+	return addrs, nil
+}
+
+// dnsQuery builds a DNS query message for one record type of name, with the
+// ID left 0 as RFC 8484 recommends so that answers can be cached by HTTP
+func dnsQuery(name string, qtype uint16) ([]byte, error) {
+	msg := []byte{
+		0, 0, // ID
+		1, 0, // flags: recursion desired
+		0, 1, // one question
+		0, 0, 0, 0, 0, 0, // no answer, authority or additional records
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return nil, fmt.Errorf("invalid host name %q for a DNS query", name)
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0)
+	msg = binary.BigEndian.AppendUint16(msg, qtype)
+	return binary.BigEndian.AppendUint16(msg, 1), nil // class IN
+}
+
+// parseDNSAnswer returns the addresses of the given record type in the
+// answer section of a DNS response, along with the lowest TTL among them.
+// A name that does not exist, or has no such record, gives no address
+func parseDNSAnswer(msg []byte, qtype uint16) ([]net.IP, uint32, error) {
+	if len(msg) < 12 {
+		return nil, 0, fmt.Errorf("message too short")
+	}
+	switch rcode := msg[3] & 0x0f; rcode {
+	case 0, 3: // no error, no such name
+	default:
+		return nil, 0, fmt.Errorf("DNS error code %d", rcode)
+	}
+	questions := binary.BigEndian.Uint16(msg[4:])
+	answers := binary.BigEndian.Uint16(msg[6:])
+
+	offset := 12
+	var err error
+	for range questions {
+		if offset, err = skipDNSName(msg, offset); err != nil {
+			return nil, 0, err
+		}
+		offset += 4 // type and class
+	}
+
+	var addrs []net.IP
+	var ttl uint32
+	for range answers {
+		if offset, err = skipDNSName(msg, offset); err != nil {
+			return nil, 0, err
+		}
+		if offset+10 > len(msg) {
+			return nil, 0, fmt.Errorf("truncated record")
+		}
+		rtype := binary.BigEndian.Uint16(msg[offset:])
+		class := binary.BigEndian.Uint16(msg[offset+2:])
+		recordTTL := binary.BigEndian.Uint32(msg[offset+4:])
+		length := int(binary.BigEndian.Uint16(msg[offset+8:]))
+		offset += 10
+		if offset+length > len(msg) {
+			return nil, 0, fmt.Errorf("truncated record")
+		}
+		// CNAME records lead to the addresses of the canonical name, listed after them
+		if rtype == qtype && class == 1 && (length == net.IPv4len || length == net.IPv6len) {
+			addrs = append(addrs, net.IP(append([]byte{}, msg[offset:offset+length]...)))
+			if len(addrs) == 1 || recordTTL < ttl {
+				ttl = recordTTL
+			}
+		}
+		offset += length
+	}
+	return addrs, ttl, nil
+}
+
+// skipDNSName returns the offset just past the domain name starting at
+// offset, which ends with a zero length or a compression pointer
+func skipDNSName(msg []byte, offset int) (int, error) {
+	for offset < len(msg) {
+		length := int(msg[offset])
+		switch {
+		case length == 0:
+			return offset + 1, nil
+		case length&0xc0 == 0xc0:
+			return offset + 2, nil
+		}
+		offset += 1 + length
+	}
+	return 0, fmt.Errorf("truncated name")
+}
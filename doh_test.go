@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// dnsTestAnswer builds the answer to query, giving an A record with addr for
+// an A question and no record for any other
+func dnsTestAnswer(query []byte, addr net.IP) []byte {
+	qtype := binary.BigEndian.Uint16(query[len(query)-4:])
+	msg := append([]byte{}, query...)
+	msg[2], msg[3] = 0x81, 0x80 // a response, recursion desired and available
+	if qtype != dnsTypeA {
+		return msg
+	}
+	msg[7] = 1                    // one answer
+	msg = append(msg, 0xc0, 0x0c) // the name of the question
+	msg = binary.BigEndian.AppendUint16(msg, dnsTypeA)
+	msg = binary.BigEndian.AppendUint16(msg, 1)
+	msg = binary.BigEndian.AppendUint32(msg, 300)
+	msg = binary.BigEndian.AppendUint16(msg, net.IPv4len)
+	return append(msg, addr.To4()...)
+}
+
+func TestDNSQuery(t *testing.T) {
+	got, err := dnsQuery("www.example.com.", dnsTypeAAAA)
+	if err != nil {
+		t.Fatalf("dnsQuery error = %v", err)
+	}
+	want := "\x00\x00\x01\x00\x00\x01\x00\x00\x00\x00\x00\x00\x03www\x07example\x03com\x00\x00\x1c\x00\x01"
+	if string(got) != want {
+		t.Errorf("dnsQuery = %q, want %q", got, want)
+	}
+
+	for _, name := range []string{"a..b", strings.Repeat("x", 64) + ".com"} {
+		if _, err := dnsQuery(name, dnsTypeA); err == nil {
+			t.Errorf("dnsQuery(%q) gave no error", name)
+		}
+	}
+}
+
+func TestParseDNSAnswer(t *testing.T) {
+	query, _ := dnsQuery("example.com", dnsTypeA)
+	answer := dnsTestAnswer(query, net.ParseIP("192.0.2.1"))
+	nxdomain := append([]byte{}, query...)
+	nxdomain[2], nxdomain[3] = 0x81, 0x83
+	refused := append([]byte{}, query...)
+	refused[2], refused[3] = 0x81, 0x85
+
+	tests := []struct {
+		name     string
+		msg      []byte
+		wantAddr []string
+		wantTTL  uint32
+		wantErr  bool
+	}{
+		{name: "address", msg: answer, wantAddr: []string{"192.0.2.1"}, wantTTL: 300},
+		{name: "no such name", msg: nxdomain},
+		{name: "refused", msg: refused, wantErr: true},
+		{name: "truncated record", msg: answer[:len(answer)-2], wantErr: true},
+		{name: "too short", msg: answer[:6], wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addrs, ttl, err := parseDNSAnswer(tt.msg, dnsTypeA)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseDNSAnswer = %v, want an error", addrs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseDNSAnswer error = %v", err)
+			}
+			var got []string
+			for _, addr := range addrs {
+				got = append(got, addr.String())
+			}
+			if !slices.Equal(got, tt.wantAddr) || ttl != tt.wantTTL {
+				t.Errorf("parseDNSAnswer = %v with TTL %d, want %v with TTL %d", got, ttl, tt.wantAddr, tt.wantTTL)
+			}
+		})
+	}
+}
+
+// startDoHServer serves DNS answers pointing every name at 127.0.0.1, one
+// query per connection, and sends on closes the error each connection ended
+// with after the answer: nil when the client shut it down normally
+func startDoHServer(t *testing.T) (string, <-chan error) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	closes := make(chan error, 16)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				req, err := http.ReadRequest(reader)
+				if err != nil {
+					closes <- err
+					return
+				}
+				query, _ := io.ReadAll(req.Body)
+				answer := dnsTestAnswer(query, net.IPv4(127, 0, 0, 1))
+				resp := &http.Response{
+					StatusCode:    200,
+					ProtoMajor:    1,
+					ProtoMinor:    1,
+					Header:        http.Header{"Content-Type": {"application/dns-message"}},
+					ContentLength: int64(len(answer)),
+					Body:          io.NopCloser(strings.NewReader(string(answer))),
+				}
+				resp.Write(conn)
+				_, err = io.Copy(io.Discard, reader)
+				closes <- err
+			}()
+		}
+	}()
+	return "http://" + ln.Addr().String() + "/dns-query", closes
+}
+
+func TestDoHResolvesAndClosesNormally(t *testing.T) {
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request, body string) { w.Write([]byte("ok")) })
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	dohURL, closes := startDoHServer(t)
+
+	result := runCLI(t, "", "-s", "-S", "--doh-url", dohURL, "http://doh-test.invalid:"+port+"/")
+	if result.code != 0 {
+		t.Fatalf("exit status %d, stderr:\n%s", result.code, result.stderr)
+	}
+	if result.stdout != "ok" {
+		t.Errorf("stdout = %q, want ok", result.stdout)
+	}
+
+	// One AAAA and one A query
+	for i := 0; i < 2; i++ {
+		if err := <-closes; err != nil {
+			if errors.Is(err, syscall.ECONNRESET) {
+				t.Errorf("DoH connection %d was reset instead of closed", i+1)
+			} else {
+				t.Errorf("DoH connection %d: %v", i+1, err)
+			}
+		}
+	}
+}
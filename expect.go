@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// expectContinueThreshold is the body size from which requests automatically
+// carry Expect: 100-continue, so a server can refuse large uploads early
+const expectContinueThreshold = 1 << 20
+
+// uploadChunkSize is how much of the body is written between checks for an
+// early response from the server
+const uploadChunkSize = 64 << 10
+
+// expectTimeout returns how long to hold the body back waiting for 100
+// Continue, or zero when the request does not expect one. For a host known
+// from --host-db the wait is cut to a few of its usual response times, since
+// a server that answers at all sends 100 Continue well within them
+func expectTimeout(opts *requestOptions, headers headerSet) time.Duration {
+	if expect, _ := headers.get("Expect"); requestBodySize(opts) == 0 || !strings.EqualFold(expect, "100-continue") {
+		return 0
+	}
+	timeout := seconds(opts.Expect100Timeout)
+	if opts.HostPrefs != nil && opts.HostPrefs.Latency > 0 {
+		timeout = min(timeout, max(4*opts.HostPrefs.Latency, 50*time.Millisecond))
+	}
+	return max(timeout, time.Millisecond)
+}
+
+// headResult carries a response head read in the background
+type headResult struct {
+	resp *httpResponse
+	err  error
+}
+
+// isInterim reports whether the head is a 1xx response that a final one follows
+func isInterim(resp *httpResponse) bool {
+	return resp.StatusCode >= 100 && resp.StatusCode < 200 && resp.StatusCode != 101
+}
+
+// uploadExchange sends a request with a body while watching the connection for
+// the server's answer. With expectTimeout set, the body is held back until 100
+// Continue arrives or the timeout passes, as curl does. A final response that
+// arrives before the body is complete, such as an early 413 or 401, stops the
+// upload: the pending write is cut short and the response is reported instead
+// of the write error from a server that stopped reading. The body is read
+// chunk by chunk as it is written, so it never has to be in memory at once;
+// a negative size means it is sent until it ends, already chunk-framed.
+// It returns the final response head, a reader for its body and the number of
+// body bytes sent. With halfClose the sending side is shut down after the
+// last body byte
+func uploadExchange(conn net.Conn, reader *bufio.Reader, method string, head string, body io.Reader, size int64, expectTimeout time.Duration, halfClose bool) (*httpResponse, io.Reader, int64, error) {
+	if _, err := conn.Write([]byte(head)); err != nil {
+		return nil, nil, 0, fmt.Errorf("error sending request: %v", err)
+	}
+
+	heads := make(chan headResult, 1)
+	readHead := func() {
+		go func() {
+			resp, err := readResponseHead(reader)
+			if err == nil && !isInterim(resp) {
+				// Unblock a write the server is no longer reading
+				conn.SetWriteDeadline(time.Unix(1, 0))
+			}
+			heads <- headResult{resp, err}
+		}()
+	}
+	readHead()
+
+	if expectTimeout > 0 {
+		timer := time.NewTimer(expectTimeout)
+		select {
+		case result := <-heads:
+			timer.Stop()
+			if result.err != nil {
+				return nil, nil, 0, result.err
+			}
+			if !isInterim(result.resp) {
+				out.Printf("Server answered %d before the body was sent\n", result.resp.StatusCode)
+				return result.resp, bodyReader(reader, result.resp, method), 0, nil
+			}
+			readHead()
+		case <-timer.C:
+			out.Printf("No 100 Continue within %s, sending the body anyway\n", out.duration(expectTimeout))
+		}
+	}
+
+	// A write error is only reported when the server has nothing to say about it
+	var writeErr error
+	var sent int64
+	chunk := make([]byte, uploadChunkSize)
+	done := false
+	for !done && (size < 0 || sent < size) && writeErr == nil {
+		select {
+		case result := <-heads:
+			if result.err != nil {
+				return nil, nil, sent, result.err
+			}
+			if !isInterim(result.resp) {
+				out.Printf("Server answered %d before the upload finished, stopped after %s\n", result.resp.StatusCode, uploadProgress(sent, size))
+				return result.resp, bodyReader(reader, result.resp, method), sent, nil
+			}
+			// A late 100 Continue after the timeout, keep uploading
+			readHead()
+		default:
+		}
+		var n int
+		var err error
+		if size < 0 {
+			// Send whatever has arrived so a slow stream is not held back
+			n, err = body.Read(chunk)
+			if err == io.EOF {
+				done, err = true, nil
+			}
+		} else {
+			n, err = io.ReadFull(body, chunk[:min(int64(len(chunk)), size-sent)])
+		}
+		if err != nil {
+			return nil, nil, sent, fmt.Errorf("error reading request body: %v", err)
+		}
+		n, err = conn.Write(chunk[:n])
+		sent += int64(n)
+		writeErr = err
+	}
+	if halfClose && writeErr == nil {
+		writeErr = closeWrite(conn)
+	}
+
+	for {
+		result := <-heads
+		if result.err != nil {
+			if writeErr != nil {
+				return nil, nil, sent, fmt.Errorf("error sending request body: %v", writeErr)
+			}
+			return nil, nil, sent, result.err
+		}
+		if isInterim(result.resp) {
+			readHead()
+			continue
+		}
+		if size >= 0 && sent < size {
+			out.Printf("Server answered %d before the upload finished, stopped after %s\n", result.resp.StatusCode, uploadProgress(sent, size))
+		}
+		return result.resp, bodyReader(reader, result.resp, method), sent, nil
+	}
+}
+
+// uploadProgress describes how much of a body of the given size was sent
+func uploadProgress(sent int64, size int64) string {
+	if size < 0 {
+		return out.size(sent)
+	}
+	return out.size(sent) + " of " + out.size(size)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpectTimeout(t *testing.T) {
+	expect := headerSet{{Name: "expect", Value: "100-Continue"}}
+	tests := []struct {
+		name    string
+		opts    requestOptions
+		headers headerSet
+		want    time.Duration
+	}{
+		{name: "no Expect", opts: requestOptions{Data: "x", Expect100Timeout: 1}},
+		{name: "no body", opts: requestOptions{Expect100Timeout: 1}, headers: expect},
+		{name: "--expect100-timeout", opts: requestOptions{Data: "x", Expect100Timeout: 2.5}, headers: expect, want: 2500 * time.Millisecond},
+		{name: "at least a millisecond", opts: requestOptions{Data: "x"}, headers: expect, want: time.Millisecond},
+		{
+			name:    "known host",
+			opts:    requestOptions{Data: "x", Expect100Timeout: 1, HostPrefs: &hostPrefs{Latency: 20 * time.Millisecond}},
+			headers: expect,
+			want:    80 * time.Millisecond,
+		},
+		{
+			name:    "known fast host",
+			opts:    requestOptions{Data: "x", Expect100Timeout: 1, HostPrefs: &hostPrefs{Latency: time.Millisecond}},
+			headers: expect,
+			want:    50 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		if got := expectTimeout(&tt.opts, tt.headers); got != tt.want {
+			t.Errorf("%s: expectTimeout = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// expectedUpload is what an expectServer saw of one upload
+type expectedUpload struct {
+	expect string
+	body   int
+	held   time.Duration // from the end of the head to the first body byte
+}
+
+// expectServer accepts one upload per connection. With mode "continue" it
+// answers Expect: 100-continue with 100 Continue, with "silent" it ignores
+// it, and with "reject" it answers 413 without reading the body
+func expectServer(t *testing.T, mode string) (string, <-chan expectedUpload) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	uploads := make(chan expectedUpload, 4)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				req, err := http.ReadRequest(reader)
+				if err != nil {
+					return
+				}
+				upload := expectedUpload{expect: req.Header.Get("Expect")}
+				if mode == "reject" {
+					io.WriteString(conn, "HTTP/1.1 413 Payload Too Large\r\nContent-Length: 0\r\nConnection: close\r\n\r\n")
+					uploads <- upload
+					return
+				}
+				if mode == "continue" && upload.expect != "" {
+					io.WriteString(conn, "HTTP/1.1 100 Continue\r\n\r\n")
+				}
+				start := time.Now()
+				reader.Peek(1)
+				upload.held = time.Since(start)
+				n, _ := io.CopyN(io.Discard, reader, req.ContentLength)
+				upload.body = int(n)
+				fmt.Fprintf(conn, "HTTP/1.1 200 OK\r\nContent-Length: %d\r\nConnection: close\r\n\r\n%d", len(fmt.Sprint(n)), n)
+				uploads <- upload
+			}()
+		}
+	}()
+	return "http://" + ln.Addr().String() + "/upload", uploads
+}
+
+func TestExpectContinue(t *testing.T) {
+	dir := t.TempDir()
+	big := filepath.Join(dir, "big.bin")
+	if err := os.WriteFile(big, make([]byte, expectContinueThreshold), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	small := filepath.Join(dir, "small.txt")
+	if err := os.WriteFile(small, []byte("small"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		mode       string
+		args       []string
+		wantExpect string
+		wantBody   int
+		maxHeld    time.Duration
+		minHeld    time.Duration
+		wantStdout string
+	}{
+		{name: "small body", mode: "silent", args: []string{"-T", small}, wantBody: 5, maxHeld: time.Second},
+		{name: "large body", mode: "continue", args: []string{"-T", big}, wantExpect: "100-continue", wantBody: expectContinueThreshold, maxHeld: time.Second},
+		{
+			name: "header given", mode: "continue", args: []string{"-T", small, "-H", "Expect: 100-continue"},
+			wantExpect: "100-continue", wantBody: 5, maxHeld: time.Second,
+		},
+		{name: "header removed", mode: "silent", args: []string{"-T", big, "-H", "Expect:"}, wantBody: expectContinueThreshold, maxHeld: time.Second},
+		{
+			name: "no 100 Continue", mode: "silent", args: []string{"-T", big, "--expect100-timeout", "0.5"},
+			wantExpect: "100-continue", wantBody: expectContinueThreshold, minHeld: 400 * time.Millisecond, wantStdout: "No 100 Continue within",
+		},
+		{
+			name: "refused before the body", mode: "reject", args: []string{"-T", big},
+			wantExpect: "100-continue", wantStdout: "Server answered 413 before the body was sent",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url, uploads := expectServer(t, tt.mode)
+			result := runCLI(t, "", append(tt.args, url)...)
+			if result.code != 0 {
+				t.Fatalf("exit status %d, stderr:\n%s", result.code, result.stderr)
+			}
+			upload := <-uploads
+			if upload.expect != tt.wantExpect || upload.body != tt.wantBody {
+				t.Errorf("server saw Expect %q and %d body bytes, want %q and %d", upload.expect, upload.body, tt.wantExpect, tt.wantBody)
+			}
+			if (tt.maxHeld > 0 && upload.held > tt.maxHeld) || upload.held < tt.minHeld {
+				t.Errorf("the body was held back %v", upload.held)
+			}
+			if !strings.Contains(result.stdout, tt.wantStdout) {
+				t.Errorf("stdout does not mention %q:\n%s", tt.wantStdout, result.stdout)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// exportSpec describes one response value to export as an environment variable
+type exportSpec struct {
+	Name   string
+	Source string // "json", "header" or "status"
+	Expr   string
+}
+
+// exportList is a custom flag type to allow multiple --export-env flags
+type exportList []exportSpec
+
+// envNamePattern matches names that are valid shell variable identifiers
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// String returns the string representation of the exportList
+func (e *exportList) String() string {
+	parts := make([]string, len(*e))
+	for i, spec := range *e {
+		parts[i] = spec.Name + "=" + spec.Source + ":" + spec.Expr
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Set parses a NAME=source:expr specification and appends it to the exportList
+func (e *exportList) Set(value string) error {
+	name, source, ok := strings.Cut(value, "=")
+	if !ok || !envNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid export format: %s. Expected 'NAME=json:.path', 'NAME=header:Name' or 'NAME=status'", value)
+	}
+	kind, expr, _ := strings.Cut(source, ":")
+	switch kind {
+	case "json", "header":
+		if expr == "" {
+			return fmt.Errorf("invalid export format: %s. Missing expression after '%s:'", value, kind)
+		}
+	case "status":
+	default:
+		return fmt.Errorf("invalid export source: %s. Expected json, header or status", kind)
+	}
+	*e = append(*e, exportSpec{Name: name, Source: kind, Expr: expr})
+	return nil
+}
+
+// exportValue extracts the value described by spec from the response
+func exportValue(spec exportSpec, resp *httpResponse) (string, error) {
+	switch spec.Source {
+	case "header":
+		return resp.header(spec.Expr), nil
+	case "status":
+		return strconv.Itoa(resp.StatusCode), nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(resp.Body))
+	decoder.UseNumber()
+	var doc any
+	if err := decoder.Decode(&doc); err != nil {
+		return "", fmt.Errorf("error exporting %s: response body is not JSON: %v", spec.Name, err)
+	}
+	value, err := jsonLookup(doc, spec.Expr)
+	if err != nil {
+		return "", fmt.Errorf("error exporting %s: %v", spec.Name, err)
+	}
+	return jsonScalar(value), nil
+}
+
+// jsonLookup walks a decoded JSON document following a path such as .user.items[0].id
+func jsonLookup(doc any, path string) (any, error) {
+	rest := strings.TrimPrefix(path, ".")
+	current := doc
+	for rest != "" {
+		var key string
+		switch {
+		case strings.HasPrefix(rest, "["):
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated index in path %s", path)
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("invalid index %q in path %s", rest[1:end], path)
+			}
+			list, ok := current.([]any)
+			if !ok || index < 0 || index >= len(list) {
+				return nil, fmt.Errorf("index %d not found in path %s", index, path)
+			}
+			current = list[index]
+			rest = strings.TrimPrefix(rest[end+1:], ".")
+			continue
+		default:
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			key, rest = rest[:end], strings.TrimPrefix(rest[end:], ".")
+		}
+		object, ok := current.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("key %q not found in path %s", key, path)
+		}
+		current, ok = object[key]
+		if !ok {
+			return nil, fmt.Errorf("key %q not found in path %s", key, path)
+		}
+	}
+	return current, nil
+}
+
+// jsonScalar renders a decoded JSON value as plain text: strings unquoted,
+// null as empty and objects or arrays as compact JSON
+func jsonScalar(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
+
+// shellQuote quotes a value for safe use in a POSIX shell
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// writeExports evaluates every export spec and either prints shell export
+// lines or writes them to a dotenv file
+func writeExports(specs exportList, resp *httpResponse, dotenvPath string) error {
+	var lines strings.Builder
+	for _, spec := range specs {
+		value, err := exportValue(spec, resp)
+		if err != nil {
+			return err
+		}
+		if dotenvPath != "" {
+			lines.WriteString(fmt.Sprintf("%s=%s\n", spec.Name, strconv.Quote(value)))
+		} else {
+			lines.WriteString(fmt.Sprintf("export %s=%s\n", spec.Name, shellQuote(value)))
+		}
+	}
+
+	if dotenvPath == "" {
+		fmt.Print(lines.String())
+		return nil
+	}
+	if err := os.WriteFile(dotenvPath, []byte(lines.String()), 0600); err != nil {
+		return fmt.Errorf("error writing export file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportListSet(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    exportSpec
+		wantErr string
+	}{
+		{value: "TOKEN=json:.data.token", want: exportSpec{Name: "TOKEN", Source: "json", Expr: ".data.token"}},
+		{value: "ID=header:X-Request-Id", want: exportSpec{Name: "ID", Source: "header", Expr: "X-Request-Id"}},
+		{value: "CODE=status", want: exportSpec{Name: "CODE", Source: "status"}},
+		{value: "1BAD=status", wantErr: "invalid export format"},
+		{value: "TOKEN", wantErr: "invalid export format"},
+		{value: "TOKEN=json:", wantErr: "Missing expression"},
+		{value: "TOKEN=body:x", wantErr: "invalid export source: body"},
+	}
+
+	for _, tt := range tests {
+		var list exportList
+		err := list.Set(tt.value)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Set(%q) error = %v, want one mentioning %q", tt.value, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || len(list) != 1 || list[0] != tt.want {
+			t.Errorf("Set(%q) = %v, %v, want %v", tt.value, list, err, tt.want)
+		}
+	}
+}
+
+func TestExportValue(t *testing.T) {
+	resp := &httpResponse{
+		StatusCode: 201,
+		Headers:    []headerField{{Name: "X-Request-Id", Value: "abc"}},
+		Body:       []byte(`{"user":{"id":12345678901234567890,"name":"Ann","tags":["a","b"],"admin":false,"team":null},"items":[{"id":7}]}`),
+	}
+	tests := []struct {
+		source  string
+		expr    string
+		want    string
+		wantErr string
+	}{
+		{source: "status", want: "201"},
+		{source: "header", expr: "x-request-id", want: "abc"},
+		{source: "json", expr: ".user.name", want: "Ann"},
+		{source: "json", expr: ".user.id", want: "12345678901234567890"},
+		{source: "json", expr: ".user.admin", want: "false"},
+		{source: "json", expr: ".user.team", want: ""},
+		{source: "json", expr: ".user.tags", want: `["a","b"]`},
+		{source: "json", expr: ".user.tags[1]", want: "b"},
+		{source: "json", expr: ".items[0].id", want: "7"},
+		{source: "json", expr: ".items[1].id", wantErr: "index 1 not found"},
+		{source: "json", expr: ".user.email", wantErr: `key "email" not found`},
+		{source: "json", expr: ".items[x]", wantErr: "invalid index"},
+		{source: "json", expr: ".items[0", wantErr: "unterminated index"},
+	}
+
+	for _, tt := range tests {
+		got, err := exportValue(exportSpec{Name: "V", Source: tt.source, Expr: tt.expr}, resp)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("exportValue(%s:%s) error = %v, want one mentioning %q", tt.source, tt.expr, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("exportValue(%s:%s) = %q, %v, want %q", tt.source, tt.expr, got, err, tt.want)
+		}
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	if got, want := shellQuote("it's $HOME"), `'it'\''s $HOME'`; got != want {
+		t.Errorf("shellQuote = %s, want %s", got, want)
+	}
+}
+
+func TestExportEnv(t *testing.T) {
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request, body string) {
+		w.Header().Set("X-Request-Id", "req-1")
+		w.Write([]byte(`{"token":"it's secret"}`))
+	})
+	args := []string{"-s", "-S", "-o", "/dev/null", "--export-env", "TOKEN=json:.token", "--export-env", "REQ=header:X-Request-Id"}
+
+	result := runCLI(t, "", append(args, server.URL+"/")...)
+	if result.code != 0 {
+		t.Fatalf("exit status %d, stderr:\n%s", result.code, result.stderr)
+	}
+	if want := "export TOKEN='it'\\''s secret'\nexport REQ='req-1'\n"; result.stdout != want {
+		t.Errorf("stdout = %q, want %q", result.stdout, want)
+	}
+
+	dotenv := filepath.Join(t.TempDir(), ".env")
+	result = runCLI(t, "", append(args, "--export-file", dotenv, server.URL+"/")...)
+	if result.code != 0 {
+		t.Fatalf("exit status %d, stderr:\n%s", result.code, result.stderr)
+	}
+	content, err := os.ReadFile(dotenv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "TOKEN=\"it's secret\"\nREQ=\"req-1\"\n"; string(content) != want {
+		t.Errorf("dotenv file = %q, want %q", content, want)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// bodyFilter is a single stage of a --filter pipeline
+type bodyFilter struct {
+	Name string
+	Arg  string
+	n    int
+	re   *regexp.Regexp
+}
+
+// filterChain is a custom flag type holding the body filter pipeline; repeated
+// --filter flags append further stages
+type filterChain []bodyFilter
+
+// String returns the string representation of the filterChain
+func (f *filterChain) String() string {
+	parts := make([]string, len(*f))
+	for i, stage := range *f {
+		parts[i] = stage.Name
+		if stage.Arg != "" {
+			parts[i] += ":" + stage.Arg
+		}
+	}
+	return strings.Join(parts, "|")
+}
+
+// Set parses a pipeline such as 'json|sort-keys' and appends its stages; a
+// literal pipe inside a stage argument is written as \|
+func (f *filterChain) Set(value string) error {
+	for _, part := range splitPipeline(value) {
+		name, arg, _ := strings.Cut(strings.TrimSpace(part), ":")
+		stage := bodyFilter{Name: name, Arg: arg}
+		switch name {
+		case "json", "compact", "sort-keys":
+		case "head", "tail":
+			n, err := strconv.Atoi(arg)
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid filter %s: expected a line count, e.g. %s:100", part, name)
+			}
+			stage.n = n
+		case "grep":
+			re, err := regexp.Compile(arg)
+			if err != nil {
+				return fmt.Errorf("invalid filter %s: %v", part, err)
+			}
+			stage.re = re
+		default:
+			return fmt.Errorf("unknown filter: %s. Expected json, compact, sort-keys, head:N, tail:N or grep:pattern", name)
+		}
+		*f = append(*f, stage)
+	}
+	return nil
+}
+
+// splitPipeline splits a filter pipeline on unescaped '|' characters
+func splitPipeline(value string) []string {
+	var parts []string
+	var current strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && i+1 < len(value) && value[i+1] == '|':
+			current.WriteByte('|')
+			i++
+		case value[i] == '|':
+			parts = append(parts, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(value[i])
+		}
+	}
+	return append(parts, current.String())
+}
+
+// applyFilters runs the body through every stage of the pipeline in order
+func applyFilters(chain filterChain, body []byte) ([]byte, error) {
+	for _, stage := range chain {
+		var err error
+		body, err = stage.apply(body)
+		if err != nil {
+			return nil, fmt.Errorf("filter %s: %v", stage.Name, err)
+		}
+	}
+	return body, nil
+}
+
+// apply runs a single filter stage over the body
+func (stage bodyFilter) apply(body []byte) ([]byte, error) {
+	switch stage.Name {
+	case "json":
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, body, "", "  "); err != nil {
+			return nil, err
+		}
+		buf.WriteByte('\n')
+		return buf.Bytes(), nil
+	case "compact":
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, body); err != nil {
+			return nil, err
+		}
+		buf.WriteByte('\n')
+		return buf.Bytes(), nil
+	case "sort-keys":
+		// Decoding into maps and re-encoding orders object keys
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		var doc any
+		if err := decoder.Decode(&doc); err != nil {
+			return nil, err
+		}
+		// Strings keep <, > and & as sent instead of \u003c escapes
+		var sorted bytes.Buffer
+		encoder := json.NewEncoder(&sorted)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(doc); err != nil {
+			return nil, err
+		}
+		return sorted.Bytes(), nil
+	}
+
+	lines := splitLines(body)
+	switch stage.Name {
+	case "head":
+		if len(lines) > stage.n {
+			lines = lines[:stage.n]
+		}
+	case "tail":
+		if len(lines) > stage.n {
+			lines = lines[len(lines)-stage.n:]
+		}
+	case "grep":
+		var matched [][]byte
+		for _, line := range lines {
+			if stage.re.Match(bytes.TrimRight(line, "\r\n")) {
+				matched = append(matched, line)
+			}
+		}
+		lines = matched
+	}
+	return bytes.Join(lines, nil), nil
+}
+
+// splitLines splits the body into lines, keeping each line's terminator
+func splitLines(body []byte) [][]byte {
+	var lines [][]byte
+	for len(body) > 0 {
+		end := bytes.IndexByte(body, '\n')
+		if end < 0 {
+			end = len(body) - 1
+		}
+		lines = append(lines, body[:end+1])
+		body = body[end+1:]
+	}
+	return lines
+}
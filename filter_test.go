@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestFilterChainSet(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr string
+	}{
+		{value: "json|sort-keys", want: "json|sort-keys"},
+		{value: "head:10 | tail:2", want: "head:10|tail:2"},
+		{value: `grep:a\|b`, want: "grep:a|b"},
+		{value: "head:x", wantErr: "expected a line count"},
+		{value: "tail:-1", wantErr: "expected a line count"},
+		{value: "grep:(", wantErr: "invalid filter grep:("},
+		{value: "upper", wantErr: "unknown filter: upper"},
+	}
+
+	for _, tt := range tests {
+		var chain filterChain
+		err := chain.Set(tt.value)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Set(%q) error = %v, want one mentioning %q", tt.value, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Set(%q) error = %v", tt.value, err)
+		} else if chain.String() != tt.want {
+			t.Errorf("Set(%q) = %q, want %q", tt.value, chain.String(), tt.want)
+		}
+	}
+}
+
+func TestApplyFilters(t *testing.T) {
+	const lines = "one\ntwo\nthree\nfour"
+	tests := []struct {
+		pipeline string
+		body     string
+		want     string
+		wantErr  bool
+	}{
+		{pipeline: "json", body: `{"b":1,"a":[2]}`, want: "{\n  \"b\": 1,\n  \"a\": [\n    2\n  ]\n}\n"},
+		{pipeline: "compact", body: "{\n  \"a\": 1\n}", want: "{\"a\":1}\n"},
+		{pipeline: "sort-keys", body: `{"b":1.50,"a":"<&>"}`, want: "{\n  \"a\": \"<&>\",\n  \"b\": 1.50\n}\n"},
+		{pipeline: "sort-keys|compact", body: `{"b":1,"a":2}`, want: "{\"a\":2,\"b\":1}\n"},
+		{pipeline: "head:2", body: lines, want: "one\ntwo\n"},
+		{pipeline: "tail:2", body: lines, want: "three\nfour"},
+		{pipeline: "head:10", body: lines, want: lines},
+		{pipeline: "grep:^t", body: "one\r\ntwo\r\nthree\r\n", want: "two\r\nthree\r\n"},
+		{pipeline: "grep:o|head:1", body: lines, want: "one\n"},
+		{pipeline: "json", body: "not json", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pipeline, func(t *testing.T) {
+			var chain filterChain
+			if err := chain.Set(tt.pipeline); err != nil {
+				t.Fatal(err)
+			}
+			got, err := applyFilters(chain, []byte(tt.body))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("applyFilters = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyFilters error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("applyFilters = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterOutput(t *testing.T) {
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request, body string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"z":1,"a":2}`))
+	})
+
+	result := runCLI(t, "", "-s", "-S", "--filter", "sort-keys", "--filter", "compact", server.URL+"/")
+	if result.code != 0 {
+		t.Fatalf("exit status %d, stderr:\n%s", result.code, result.stderr)
+	}
+	if want := "{\"a\":2,\"z\":1}\n"; result.stdout != want {
+		t.Errorf("stdout = %q, want %q", result.stdout, want)
+	}
+
+	result = runCLI(t, "", "-s", "-S", "--filter", "json", "-N", server.URL+"/")
+	if result.code == 0 || !strings.Contains(result.stderr, "cannot be combined with -N") {
+		t.Errorf("--filter with -N: exit status %d, stderr:\n%s", result.code, result.stderr)
+	}
+}
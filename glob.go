@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// maxGlobURLs caps how many URLs one glob pattern may expand to, so a typo
+// like [1-1000000] fails up front instead of starting a million transfers
+const maxGlobURLs = 100000
+
+// globURL is one URL a glob pattern expanded to, with the text each glob
+// matched, in pattern order, for the #1, #2... references of -o
+type globURL struct {
+	URL     string
+	Matches []string
+	first   bool // expanded from the first URL of the command line
+}
+
+// expandGlob expands curl's URL globbing: {one,two,three} sets, numeric
+// ranges like [1-10] or [001-100:5] with an optional step and zero padding
+// taken from the start, and letter ranges like [a-z]. The URLs come in
+// order with the last glob varying fastest. A brackets pair holding an
+// IPv6 address is kept as-is, and \ escapes a literal {, }, [ or ]
+func expandGlob(pattern string) ([]globURL, error) {
+	urls := []globURL{{}}
+	var literal strings.Builder
+	appendLiteral := func() {
+		for i := range urls {
+			urls[i].URL += literal.String()
+		}
+		literal.Reset()
+	}
+
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '\\' && i+1 < len(pattern) && strings.IndexByte("{}[]", pattern[i+1]) >= 0:
+			literal.WriteByte(pattern[i+1])
+			i++
+			continue
+		case c != '{' && c != '[':
+			literal.WriteByte(c)
+			continue
+		}
+
+		closing := byte('}')
+		if c == '[' {
+			closing = ']'
+		}
+		end := strings.IndexByte(pattern[i+1:], closing)
+		if end < 0 {
+			return nil, fmt.Errorf("error: unmatched %c in URL glob at position %d; escape it or use --globoff", c, i+1)
+		}
+		body := pattern[i+1 : i+1+end]
+		if c == '[' && isBracketedAddress(body) {
+			literal.WriteString(pattern[i : i+end+2])
+			i += end + 1
+			continue
+		}
+
+		values, err := globValues(c, body)
+		if err != nil {
+			return nil, fmt.Errorf("error: invalid URL glob %c%s%c: %v", c, body, closing, err)
+		}
+		if len(urls)*len(values) > maxGlobURLs {
+			return nil, fmt.Errorf("error: the URL glob expands to more than %d URLs", maxGlobURLs)
+		}
+		appendLiteral()
+		expanded := make([]globURL, 0, len(urls)*len(values))
+		for _, u := range urls {
+			for _, value := range values {
+				matches := append(append([]string{}, u.Matches...), value)
+				expanded = append(expanded, globURL{URL: u.URL + value, Matches: matches})
+			}
+		}
+		urls = expanded
+		i += end + 1
+	}
+	appendLiteral()
+	return urls, nil
+}
+
+// isBracketedAddress reports whether the text between brackets is an IPv6
+// address, possibly with a zone, rather than a range
+func isBracketedAddress(body string) bool {
+	host, _, _ := strings.Cut(body, "%")
+	return strings.Contains(host, ":") && net.ParseIP(host) != nil
+}
+
+// globValues lists the values of one glob: the items of a {set}, or every
+// step of a [range]
+func globValues(kind byte, body string) ([]string, error) {
+	if kind == '{' {
+		if strings.ContainsAny(body, "{[") {
+			return nil, fmt.Errorf("globs cannot be nested")
+		}
+		return strings.Split(body, ","), nil
+	}
+
+	rangeSpec, stepSpec, hasStep := strings.Cut(body, ":")
+	step := 1
+	if hasStep {
+		n, err := strconv.Atoi(stepSpec)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("step %q is not a positive number", stepSpec)
+		}
+		step = n
+	}
+	first, last, ok := strings.Cut(rangeSpec, "-")
+	if !ok {
+		return nil, fmt.Errorf("expected a range like 1-10 or a-z")
+	}
+
+	// Letter range
+	if len(first) == 1 && len(last) == 1 && isLetter(first[0]) && isLetter(last[0]) {
+		if isUpper(first[0]) != isUpper(last[0]) || first[0] > last[0] {
+			return nil, fmt.Errorf("%s-%s is not an ascending range of letters of one case", first, last)
+		}
+		var values []string
+		for c := int(first[0]); c <= int(last[0]); c += step {
+			values = append(values, string(rune(c)))
+		}
+		return values, nil
+	}
+
+	// Numeric range, padded to the width of the start when it has leading zeros
+	start, err := strconv.Atoi(first)
+	if err != nil || start < 0 {
+		return nil, fmt.Errorf("%q is not a number or a letter", first)
+	}
+	stop, err := strconv.Atoi(last)
+	if err != nil || stop < start {
+		return nil, fmt.Errorf("%q is not a number at least %d", last, start)
+	}
+	if (stop-start)/step+1 > maxGlobURLs {
+		return nil, fmt.Errorf("the range has more than %d values", maxGlobURLs)
+	}
+	width := 0
+	if len(first) > 1 && first[0] == '0' {
+		width = len(first)
+	}
+	var values []string
+	for n := start; n <= stop; n += step {
+		values = append(values, fmt.Sprintf("%0*d", width, n))
+	}
+	return values, nil
+}
+
+// isLetter reports whether c is an ASCII letter
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// isUpper reports whether c is an uppercase ASCII letter
+func isUpper(c byte) bool {
+	return c >= 'A' && c <= 'Z'
+}
+
+// outputName substitutes the #1, #2... references in an -o file name with
+// the text the globs of the URL matched; a reference past the last glob is
+// left as-is
+func (g globURL) outputName(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] != '#' {
+			b.WriteByte(name[i])
+			continue
+		}
+		j := i + 1
+		for j < len(name) && name[j] >= '0' && name[j] <= '9' {
+			j++
+		}
+		n, err := strconv.Atoi(name[i+1 : j])
+		if err != nil || n < 1 || n > len(g.Matches) {
+			b.WriteByte('#')
+			continue
+		}
+		b.WriteString(g.Matches[n-1])
+		i = j - 1
+	}
+	return b.String()
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestExpandGlob(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  string
+		want     []string
+		errorMsg string
+	}{
+		{
+			name:    "no glob",
+			pattern: "http://example.com/a",
+			want:    []string{"http://example.com/a"},
+		},
+		{
+			name:    "set",
+			pattern: "http://{one,two}.example.com/",
+			want:    []string{"http://one.example.com/", "http://two.example.com/"},
+		},
+		{
+			name:    "numeric range",
+			pattern: "http://example.com/[1-3].txt",
+			want:    []string{"http://example.com/1.txt", "http://example.com/2.txt", "http://example.com/3.txt"},
+		},
+		{
+			name:    "zero padding and step",
+			pattern: "http://example.com/[008-012:2]",
+			want:    []string{"http://example.com/008", "http://example.com/010", "http://example.com/012"},
+		},
+		{
+			name:    "letter range",
+			pattern: "http://example.com/[a-c]",
+			want:    []string{"http://example.com/a", "http://example.com/b", "http://example.com/c"},
+		},
+		{
+			name:    "last glob varies fastest",
+			pattern: "http://h/{a,b}/[1-2]",
+			want:    []string{"http://h/a/1", "http://h/a/2", "http://h/b/1", "http://h/b/2"},
+		},
+		{
+			name:    "ipv6 literal kept",
+			pattern: "http://[::1]:8080/[1-2]",
+			want:    []string{"http://[::1]:8080/1", "http://[::1]:8080/2"},
+		},
+		{
+			name:    "ipv6 literal with zone",
+			pattern: "http://[fe80::1%25eth0]/",
+			want:    []string{"http://[fe80::1%25eth0]/"},
+		},
+		{
+			name:    "escaped brackets",
+			pattern: `http://h/\[1-2\]\{x\}`,
+			want:    []string{"http://h/[1-2]{x}"},
+		},
+		{name: "unmatched", pattern: "http://h/[1-2", errorMsg: "unmatched ["},
+		{name: "nested", pattern: "http://h/{a,[1-2]}", errorMsg: "nested"},
+		{name: "descending numbers", pattern: "http://h/[5-1]", errorMsg: "invalid URL glob"},
+		{name: "mixed case letters", pattern: "http://h/[a-Z]", errorMsg: "one case"},
+		{name: "bad step", pattern: "http://h/[1-5:0]", errorMsg: "step"},
+		{name: "too many", pattern: "http://h/[1-1000][1-1000]", errorMsg: "more than"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			urls, err := expandGlob(tt.pattern)
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("expandGlob(%q) error = %v, want one containing %q", tt.pattern, err, tt.errorMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expandGlob(%q) error = %v", tt.pattern, err)
+			}
+			var got []string
+			for _, u := range urls {
+				got = append(got, u.URL)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("expandGlob(%q) = %q, want %q", tt.pattern, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGlobOutputName(t *testing.T) {
+	tests := []struct {
+		name    string
+		matches []string
+		want    string
+	}{
+		{"file_#1.txt", []string{"a"}, "file_a.txt"},
+		{"#2-#1", []string{"x", "07"}, "07-x"},
+		{"#3.txt", []string{"a"}, "#3.txt"},
+		{"#0#", []string{"a"}, "#0#"},
+		{"plain", nil, "plain"},
+		{"#12", []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "twelve"}, "twelve"},
+	}
+
+	for _, tt := range tests {
+		if got := (globURL{Matches: tt.matches}).outputName(tt.name); got != tt.want {
+			t.Errorf("outputName(%q) with %q = %q, want %q", tt.name, tt.matches, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// varList is a custom flag type collecting repeated key=value variables
+type varList []string
+
+// String returns the string representation of the varList
+func (v *varList) String() string {
+	return strings.Join(*v, ", ")
+}
+
+// Set checks that the value has the key=value form and appends it to the varList
+func (v *varList) Set(value string) error {
+	if key, _, ok := strings.Cut(value, "="); !ok || strings.TrimSuffix(key, ":") == "" {
+		return fmt.Errorf("invalid variable %q: expected key=value", value)
+	}
+	*v = append(*v, value)
+	return nil
+}
+
+// applyGraphQL wraps --graphql and its --graphql-var variables into the
+// standard {"query": ..., "variables": {...}} envelope, sent as a --json
+// body. A query starting with '@' is read from a file. Variables are strings
+// given as key=value, or JSON values given as key:=json
+func applyGraphQL(opts *requestOptions) error {
+	if opts.GraphQL == "" {
+		if len(opts.GraphQLVars) > 0 {
+			return fmt.Errorf("error: --graphql-var needs --graphql")
+		}
+		return nil
+	}
+	if len(opts.DataArgs) > 0 || len(opts.FormArgs) > 0 || opts.UploadFile != "" {
+		return fmt.Errorf("error: --graphql builds the body and cannot be combined with -d, --json, -F, -T or request items")
+	}
+	query := opts.GraphQL
+	if file, ok := strings.CutPrefix(query, "@"); ok {
+		content, err := readDataFile(file)
+		if err != nil {
+			return err
+		}
+		query = string(content)
+	}
+
+	variables := map[string]json.RawMessage{}
+	for _, variable := range opts.GraphQLVars {
+		key, value, _ := strings.Cut(variable, "=")
+		if name, ok := strings.CutSuffix(key, ":"); ok {
+			if !json.Valid([]byte(value)) {
+				return fmt.Errorf("error: GraphQL variable %s is not valid JSON: %s", name, value)
+			}
+			variables[name] = json.RawMessage(value)
+			continue
+		}
+		variables[key], _ = json.Marshal(value)
+	}
+
+	envelope := struct {
+		Query     string                     `json:"query"`
+		Variables map[string]json.RawMessage `json:"variables,omitempty"`
+	}{query, variables}
+	body, err := json.Marshal(envelope)
+	if err != nil {
+		return fmt.Errorf("error encoding GraphQL request: %v", err)
+	}
+	opts.DataArgs = dataList{{kind: dataJSON, value: string(body)}}
+	return nil
+}
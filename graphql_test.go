@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestVarListSet(t *testing.T) {
+	var vars varList
+	for _, value := range []string{"id=1", "n:=2", "empty="} {
+		if err := vars.Set(value); err != nil {
+			t.Errorf("Set(%q) error = %v", value, err)
+		}
+	}
+	for _, value := range []string{"id", "=1", ":=2"} {
+		if err := vars.Set(value); err == nil {
+			t.Errorf("Set(%q) gave no error", value)
+		}
+	}
+}
+
+func TestApplyGraphQL(t *testing.T) {
+	queryFile := filepath.Join(t.TempDir(), "query.graphql")
+	if err := os.WriteFile(queryFile, []byte("query { me { id } }"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		opts    requestOptions
+		want    string
+		wantErr string
+	}{
+		{name: "no query", opts: requestOptions{}},
+		{name: "query only", opts: requestOptions{GraphQL: "{ me }"}, want: `{"query":"{ me }"}`},
+		{
+			name: "variables",
+			opts: requestOptions{GraphQL: "query($id: ID!)", GraphQLVars: varList{"id=42", "limit:=10", "filter:={\"on\":true}"}},
+			want: `{"query":"query($id: ID!)","variables":{"filter":{"on":true},"id":"42","limit":10}}`,
+		},
+		{name: "query file", opts: requestOptions{GraphQL: "@" + queryFile}, want: `{"query":"query { me { id } }"}`},
+		{name: "invalid JSON variable", opts: requestOptions{GraphQL: "q", GraphQLVars: varList{"n:=nope"}}, wantErr: "not valid JSON"},
+		{name: "variables without a query", opts: requestOptions{GraphQLVars: varList{"id=1"}}, wantErr: "--graphql-var needs --graphql"},
+		{name: "with -d", opts: requestOptions{GraphQL: "q", DataArgs: dataList{{kind: dataRaw, value: "x"}}}, wantErr: "cannot be combined"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			err := applyGraphQL(&opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("applyGraphQL error = %v, want one mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyGraphQL error = %v", err)
+			}
+			if tt.want == "" {
+				if len(opts.DataArgs) != 0 {
+					t.Errorf("DataArgs = %v, want none", opts.DataArgs)
+				}
+				return
+			}
+			if len(opts.DataArgs) != 1 || opts.DataArgs[0].kind != dataJSON || opts.DataArgs[0].value != tt.want {
+				t.Errorf("DataArgs = %v, want a --json body %s", opts.DataArgs, tt.want)
+			}
+		})
+	}
+}
+
+func TestGraphQLRequest(t *testing.T) {
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request, body string) {
+		w.Write([]byte(`{"data":{}}`))
+	})
+	result := runCLI(t, "", "-s", "-S", "--graphql", "query($n: Int) { items(n: $n) }", "--graphql-var", "n:=3", server.URL+"/graphql")
+	if result.code != 0 {
+		t.Fatalf("exit status %d, stderr:\n%s", result.code, result.stderr)
+	}
+
+	last := server.last(t)
+	if last.Method != "POST" || !strings.HasPrefix(last.Header.Get("Content-Type"), "application/json") {
+		t.Errorf("request %s with Content-Type %q, want a JSON POST", last.Method, last.Header.Get("Content-Type"))
+	}
+	var got, want map[string]any
+	json.Unmarshal([]byte(last.Body), &got)
+	json.Unmarshal([]byte(`{"query":"query($n: Int) { items(n: $n) }","variables":{"n":3}}`), &want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("body = %s", last.Body)
+	}
+}
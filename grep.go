@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+)
+
+// grepPattern is a custom flag type holding the compiled --grep expression
+type grepPattern struct {
+	re *regexp.Regexp
+}
+
+// String returns the string representation of the grepPattern
+func (g *grepPattern) String() string {
+	if g.re == nil {
+		return ""
+	}
+	return g.re.String()
+}
+
+// Set compiles the regular expression
+func (g *grepPattern) Set(value string) error {
+	re, err := regexp.Compile(value)
+	if err != nil {
+		return fmt.Errorf("invalid --grep pattern: %v", err)
+	}
+	g.re = re
+	return nil
+}
+
+// grepBody scans the body line by line as it arrives and prints the lines
+// matching --grep, prefixed with their line numbers like grep -n. With
+// --grep-context, that many lines around each match are printed too, and
+// separate groups are divided by "--". It returns the number of matching lines
+func grepBody(opts requestOptions, body io.Reader) (int, error) {
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	context := opts.GrepContext
+	var before []string
+	matches, after, lineNo, lastPrinted := 0, 0, 0, 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+		if opts.Grep.re.MatchString(line) {
+			matches++
+			first := lineNo - len(before)
+			if lastPrinted > 0 && first > lastPrinted+1 {
+				fmt.Fprintln(w, "--")
+			}
+			for i, prev := range before {
+				fmt.Fprintf(w, "%d-%s\n", first+i, prev)
+			}
+			before = before[:0]
+			fmt.Fprintf(w, "%d:%s\n", lineNo, line)
+			lastPrinted, after = lineNo, context
+			if opts.NoBuffer {
+				w.Flush()
+			}
+			continue
+		}
+		if after > 0 {
+			fmt.Fprintf(w, "%d-%s\n", lineNo, line)
+			lastPrinted = lineNo
+			after--
+			continue
+		}
+		if context > 0 {
+			if len(before) == context {
+				before = before[1:]
+			}
+			before = append(before, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return matches, fmt.Errorf("error reading body: %v", err)
+	}
+	return matches, nil
+}
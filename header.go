@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// httpDate formats t as an HTTP-date (RFC 9110 IMF-fixdate)
+func httpDate(t time.Time) string {
+	return t.UTC().Format(http.TimeFormat)
+}
+
+// parseTimeArg reads a point in time given as an HTTP-date, RFC 3339, Unix
+// seconds, "now" or @file for the modification time of a file
+func parseTimeArg(value string) (time.Time, error) {
+	if value == "now" {
+		return time.Now(), nil
+	}
+	if path, ok := strings.CutPrefix(value, "@"); ok {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return info.ModTime(), nil
+	}
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("unrecognized time %q: expected an HTTP-date, RFC 3339, Unix seconds, now or @file", value)
+}
+
+// headerInput returns the argument, reading stdin when it is "-"
+func headerInput(value string) (string, error) {
+	if value != "-" {
+		return value, nil
+	}
+	content, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+// headerCommands are the helpers of the header subcommand, each taking one argument
+var headerCommands = []struct {
+	name  string
+	usage string
+	run   func(arg string) (string, error)
+}{
+	{"parse-date", "Print an HTTP-date as RFC 3339 and Unix seconds", func(arg string) (string, error) {
+		t, err := http.ParseTime(arg)
+		if err != nil {
+			return "", fmt.Errorf("invalid HTTP-date %q", arg)
+		}
+		return fmt.Sprintf("%s %d", t.UTC().Format(time.RFC3339), t.Unix()), nil
+	}},
+	{"format-date", "Format a time (HTTP-date, RFC 3339, Unix seconds, now or @file) as an HTTP-date", func(arg string) (string, error) {
+		t, err := parseTimeArg(arg)
+		return httpDate(t), err
+	}},
+	{"if-modified-since", "Build an If-Modified-Since header for a time or @file", func(arg string) (string, error) {
+		t, err := parseTimeArg(arg)
+		return "If-Modified-Since: " + httpDate(t), err
+	}},
+	{"basic", "Build a Basic Authorization header for user:password", func(arg string) (string, error) {
+		return "Authorization: " + basicAuthorization(arg), nil
+	}},
+	{"percent-encode", "Percent-encode a string for use in a URL query, like --data-urlencode", func(arg string) (string, error) {
+		return percentEncode(arg), nil
+	}},
+	{"percent-decode", "Decode a percent-encoded string", url.QueryUnescape},
+	{"base64-encode", "Encode a string as base64", func(arg string) (string, error) {
+		return base64.StdEncoding.EncodeToString([]byte(arg)), nil
+	}},
+	{"base64-decode", "Decode a base64 string", func(arg string) (string, error) {
+		decoded, err := base64.StdEncoding.DecodeString(arg)
+		return string(decoded), err
+	}},
+}
+
+// runHeader implements the header subcommand, exposing the date, auth and
+// encoding helpers the client uses so shell scripts can build the same values.
+// An argument of "-" is read from stdin
+func runHeader(args []string) error {
+	usage := func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s header <command> <value>\n\nCommands:\n", os.Args[0])
+		for _, command := range headerCommands {
+			fmt.Fprintf(os.Stderr, "  %-18s %s\n", command.name, command.usage)
+		}
+	}
+	if len(args) != 2 {
+		usage()
+		return fmt.Errorf("error: header needs a command and one value")
+	}
+	for _, command := range headerCommands {
+		if command.name != args[0] {
+			continue
+		}
+		input, err := headerInput(args[1])
+		if err != nil {
+			return fmt.Errorf("error reading stdin: %v", err)
+		}
+		result, err := command.run(input)
+		if err != nil {
+			return fmt.Errorf("error: %v", err)
+		}
+		fmt.Println(result)
+		return nil
+	}
+	usage()
+	return fmt.Errorf("error: unknown header command %q", args[0])
+}
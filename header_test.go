@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHeaderSubcommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		stdin    string
+		want     string
+		wantCode int
+	}{
+		{name: "percent-encode", args: []string{"percent-encode", "a b&c/~é"}, want: "a%20b%26c%2F~%C3%A9"},
+		{name: "percent-encode matches --data-urlencode", args: []string{"percent-encode", "q=hello world"}, want: "q%3Dhello%20world"},
+		{name: "percent-decode", args: []string{"percent-decode", "a%20b+c"}, want: "a b c"},
+		{name: "basic", args: []string{"basic", "user:pass"}, want: "Authorization: Basic dXNlcjpwYXNz"},
+		{name: "base64 from stdin", args: []string{"base64-encode", "-"}, stdin: "hi", want: "aGk="},
+		{name: "parse-date", args: []string{"parse-date", "Sun, 06 Nov 1994 08:49:37 GMT"}, want: "1994-11-06T08:49:37Z 784111777"},
+		{name: "format-date", args: []string{"format-date", "784111777"}, want: "Sun, 06 Nov 1994 08:49:37 GMT"},
+		{name: "invalid date", args: []string{"parse-date", "yesterday"}, wantCode: 1},
+		{name: "unknown command", args: []string{"rot13", "x"}, wantCode: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := runCLI(t, tt.stdin, append([]string{"header"}, tt.args...)...)
+			if result.code != tt.wantCode {
+				t.Fatalf("exit status %d, want %d, stderr:\n%s", result.code, tt.wantCode, result.stderr)
+			}
+			if got := strings.TrimSuffix(result.stdout, "\n"); tt.wantCode == 0 && got != tt.want {
+				t.Errorf("stdout = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPercentEncodeRoundTrip(t *testing.T) {
+	for _, s := range []string{"a b", "x+y", "100%", "ü/ö?&=#"} {
+		decoded, err := headerCommandRun(t, "percent-decode", percentEncode(s))
+		if err != nil || decoded != s {
+			t.Errorf("decoding percentEncode(%q) = %q, %v", s, decoded, err)
+		}
+	}
+}
+
+// headerCommandRun runs one command of the header subcommand on arg
+func headerCommandRun(t *testing.T, name string, arg string) (string, error) {
+	t.Helper()
+	for _, command := range headerCommands {
+		if command.name == name {
+			return command.run(arg)
+		}
+	}
+	t.Fatalf("no header command %q", name)
+	return "", nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// headerSet holds request headers in the order they are sent. A name may
+// appear more than once, each occurrence sent as its own header line. Names
+// are sent spelled exactly as given, since some servers care, but matched
+// case-insensitively
+type headerSet []headerField
+
+// get returns the first value of the named header and whether it is present
+func (h headerSet) get(name string) (string, bool) {
+	for _, field := range h {
+		if strings.EqualFold(field.Name, name) {
+			return field.Value, true
+		}
+	}
+	return "", false
+}
+
+// has reports whether the named header is present
+func (h headerSet) has(name string) bool {
+	_, ok := h.get(name)
+	return ok
+}
+
+// add appends a header, keeping any earlier ones of the same name
+func (h *headerSet) add(name string, value string) {
+	*h = append(*h, headerField{Name: name, Value: value})
+}
+
+// set replaces every header of the name with a single one holding value,
+// sent where the first of them was and spelled as name, or appends it when
+// there is none
+func (h *headerSet) set(name string, value string) {
+	i := slices.IndexFunc(*h, func(field headerField) bool { return strings.EqualFold(field.Name, name) })
+	if i < 0 {
+		h.add(name, value)
+		return
+	}
+	(*h)[i] = headerField{Name: name, Value: value}
+	*h = append((*h)[:i+1], slices.DeleteFunc((*h)[i+1:], func(field headerField) bool { return strings.EqualFold(field.Name, name) })...)
+}
+
+// remove drops every header of the name
+func (h *headerSet) remove(name string) {
+	*h = slices.DeleteFunc(*h, func(field headerField) bool { return strings.EqualFold(field.Name, name) })
+}
+
+// sorted returns the headers in the fixed order used with --deterministic:
+// Host first, then the rest sorted by name regardless of case. Repeated
+// headers keep their relative order
+func (h headerSet) sorted() headerSet {
+	sorted := slices.Clone(h)
+	slices.SortStableFunc(sorted, func(a, b headerField) int {
+		aHost, bHost := strings.EqualFold(a.Name, "Host"), strings.EqualFold(b.Name, "Host")
+		switch {
+		case aHost && bHost:
+			return 0
+		case aHost:
+			return -1
+		case bHost:
+			return 1
+		}
+		return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	})
+	return sorted
+}
+
+// parseHeaderArg splits a -H argument in one of curl's forms: "Name: value"
+// sends a header, "Name:" with nothing after the colon removes the header
+// the client would otherwise send, and "Name;" sends it with an empty value
+func parseHeaderArg(header string) (name string, value string, remove bool, err error) {
+	name, value, ok := strings.Cut(header, ":")
+	if !ok {
+		if name, ok = strings.CutSuffix(strings.TrimSpace(header), ";"); !ok {
+			return "", "", false, fmt.Errorf("invalid header format: %s. Expected 'Key: Value', 'Key:' to remove it or 'Key;' to send it empty", header)
+		}
+		return strings.TrimSpace(name), "", false, nil
+	}
+	name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+	return name, value, value == "", nil
+}
+
+// headerName returns the name part of a -H argument
+func headerName(header string) string {
+	name, _, _, _ := parseHeaderArg(header)
+	return name
+}
+
+// loadHeaderFiles replaces each -H @file argument with the headers listed in
+// the file (or stdin for "@-"), one per line. Blank lines and lines starting
+// with # are skipped, so header sets can be kept out of the command line
+func loadHeaderFiles(headers headerList) (headerList, error) {
+	var loaded headerList
+	for _, header := range headers {
+		path, ok := strings.CutPrefix(header, "@")
+		if !ok {
+			loaded = append(loaded, header)
+			continue
+		}
+		var content []byte
+		var err error
+		if path == "-" {
+			content, err = io.ReadAll(os.Stdin)
+		} else {
+			content, err = os.ReadFile(path)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading header file: %v", err)
+		}
+		for i, line := range strings.Split(string(content), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			if _, _, _, err := parseHeaderArg(line); err != nil {
+				return nil, fmt.Errorf("error reading header file %s: line %d: %v", path, i+1, err)
+			}
+			loaded = append(loaded, line)
+		}
+	}
+	return loaded, nil
+}
+
+// has reports whether a header of the name was given, matched case-insensitively
+func (h headerList) has(name string) bool {
+	return slices.ContainsFunc(h, func(header string) bool { return strings.EqualFold(headerName(header), name) })
+}
+
+// removed lists the names of the headers given as "Name:" to be left out
+func (h headerList) removed() []string {
+	var names []string
+	for _, header := range h {
+		if name, _, remove, err := parseHeaderArg(header); err == nil && remove {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// with returns a copy of the list in which header replaces any given
+// earlier under the same name, for headers the client adds on its own
+// behalf, like the Authorization of a handshake
+func (h headerList) with(header string) headerList {
+	name := headerName(header)
+	kept := slices.DeleteFunc(slices.Clone(h), func(given string) bool { return strings.EqualFold(headerName(given), name) })
+	return append(kept, header)
+}
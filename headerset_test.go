@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/textproto"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// rawHeadServer answers every request with ok and sends on heads the header
+// lines of each request exactly as they arrived
+func rawHeadServer(t *testing.T) (string, <-chan []string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	heads := make(chan []string, 4)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := textproto.NewReader(bufio.NewReader(conn))
+				var lines []string
+				for {
+					line, err := reader.ReadLine()
+					if err != nil || line == "" {
+						break
+					}
+					lines = append(lines, line)
+				}
+				heads <- lines[1:]
+				io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\nConnection: close\r\n\r\nok")
+			}()
+		}
+	}()
+	return "http://" + ln.Addr().String() + "/", heads
+}
+
+// headerLines renders headers the way they go on the wire
+func headerLines(headers headerSet) []string {
+	var lines []string
+	for _, field := range headers {
+		lines = append(lines, field.Name+": "+field.Value)
+	}
+	return lines
+}
+
+func TestBuildHeadersRepeated(t *testing.T) {
+	target := urlOptions{Protocol: "http", Host: "example.com", Port: "80"}
+	headers, err := buildHeaders(target, headerList{"X-Tag: a", "Accept: text/html", "X-Tag: b", "Accept: application/json"}, 0, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"Host: example.com",
+		"User-Agent: " + userAgent(),
+		"Accept: text/html",
+		"Connection: close",
+		"X-Tag: a",
+		"X-Tag: b",
+		"Accept: application/json",
+	}
+	if got := headerLines(headers); !slices.Equal(got, want) {
+		t.Errorf("buildHeaders =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestRepeatedHeadersSent(t *testing.T) {
+	url, heads := rawHeadServer(t)
+	result := runCLI(t, "", "-s", "-S", "-H", "X-Tag: a", "-H", "X-Other: 1", "-H", "X-Tag: b", url)
+	if result.code != 0 {
+		t.Fatalf("exit status %d, stderr:\n%s", result.code, result.stderr)
+	}
+	var tags []string
+	for _, line := range <-heads {
+		if strings.HasPrefix(line, "X-") {
+			tags = append(tags, line)
+		}
+	}
+	if want := []string{"X-Tag: a", "X-Other: 1", "X-Tag: b"}; !slices.Equal(tags, want) {
+		t.Errorf("sent %q, want %q", tags, want)
+	}
+}
+
+func TestParseHeaderArg(t *testing.T) {
+	tests := []struct {
+		header     string
+		wantName   string
+		wantValue  string
+		wantRemove bool
+		wantErr    bool
+	}{
+		{header: "Accept: text/html", wantName: "Accept", wantValue: "text/html"},
+		{header: " X-Time :  12:30 ", wantName: "X-Time", wantValue: "12:30"},
+		{header: "User-Agent:", wantName: "User-Agent", wantRemove: true},
+		{header: "User-Agent:   ", wantName: "User-Agent", wantRemove: true},
+		{header: "X-Empty;", wantName: "X-Empty"},
+		{header: "X-Empty ; ", wantName: "X-Empty"},
+		{header: "X-Empty", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		name, value, remove, err := parseHeaderArg(tt.header)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseHeaderArg(%q) gave no error", tt.header)
+			}
+			continue
+		}
+		if err != nil || name != tt.wantName || value != tt.wantValue || remove != tt.wantRemove {
+			t.Errorf("parseHeaderArg(%q) = %q, %q, %v, %v, want %q, %q, %v", tt.header, name, value, remove, err, tt.wantName, tt.wantValue, tt.wantRemove)
+		}
+	}
+}
+
+func TestBuildHeadersRemovedAndEmpty(t *testing.T) {
+	target := urlOptions{Protocol: "http", Host: "example.com", Port: "80"}
+	headers, err := buildHeaders(target, headerList{"User-Agent:", "X-Empty;", "Content-Type:", "Accept: a", "Accept:"}, 4, "application/x-www-form-urlencoded", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Host: example.com", "Connection: close", "X-Empty: ", "Content-Length: 4"}
+	if got := headerLines(headers); !slices.Equal(got, want) {
+		t.Errorf("buildHeaders =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestRemovedAndEmptyHeadersSent(t *testing.T) {
+	url, heads := rawHeadServer(t)
+	result := runCLI(t, "", "-s", "-S", "-H", "User-Agent:", "-H", "X-Empty;", url)
+	if result.code != 0 {
+		t.Fatalf("exit status %d, stderr:\n%s", result.code, result.stderr)
+	}
+	lines := <-heads
+	if slices.ContainsFunc(lines, func(line string) bool { return strings.HasPrefix(line, "User-Agent") }) {
+		t.Errorf("User-Agent was sent after -H User-Agent: in %q", lines)
+	}
+	if !slices.Contains(lines, "X-Empty: ") {
+		t.Errorf("X-Empty was not sent empty in %q", lines)
+	}
+}
+
+func TestHeaderSetMatchesCaseInsensitively(t *testing.T) {
+	headers := headerSet{{Name: "X-Api-KEY", Value: "1"}, {Name: "accept", Value: "a"}, {Name: "x-api-key", Value: "2"}}
+	if value, ok := headers.get("x-API-key"); !ok || value != "1" {
+		t.Errorf("get = %q, %v, want the first value", value, ok)
+	}
+
+	set := slices.Clone(headers)
+	set.set("X-API-Key", "3")
+	if want := []string{"X-API-Key: 3", "accept: a"}; !slices.Equal(headerLines(set), want) {
+		t.Errorf("after set = %q, want %q", headerLines(set), want)
+	}
+
+	removed := slices.Clone(headers)
+	removed.remove("X-API-KEY")
+	if want := []string{"accept: a"}; !slices.Equal(headerLines(removed), want) {
+		t.Errorf("after remove = %q, want %q", headerLines(removed), want)
+	}
+
+	sorted := headerSet{{Name: "b", Value: "1"}, {Name: "A", Value: "2"}, {Name: "host", Value: "h"}, {Name: "B", Value: "3"}}.sorted()
+	if want := []string{"host: h", "A: 2", "b: 1", "B: 3"}; !slices.Equal(headerLines(sorted), want) {
+		t.Errorf("sorted = %q, want %q", headerLines(sorted), want)
+	}
+}
+
+func TestHeaderNamesSentAsTyped(t *testing.T) {
+	url, heads := rawHeadServer(t)
+	result := runCLI(t, "", "-s", "-S", "-H", "x-lower-case: 1", "-H", "X-API-KEY: 2", "-H", "user-agent: custom", url)
+	if result.code != 0 {
+		t.Fatalf("exit status %d, stderr:\n%s", result.code, result.stderr)
+	}
+	lines := <-heads
+	for _, want := range []string{"x-lower-case: 1", "X-API-KEY: 2", "user-agent: custom"} {
+		if !slices.Contains(lines, want) {
+			t.Errorf("%q was not sent as typed in %q", want, lines)
+		}
+	}
+	if slices.ContainsFunc(lines, func(line string) bool { return strings.HasPrefix(line, "User-Agent:") }) {
+		t.Errorf("the default User-Agent was sent besides user-agent in %q", lines)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHMACSpecSet(t *testing.T) {
+	t.Setenv("CCCURL_HMAC_KEY", "from-env")
+	tests := []struct {
+		value   string
+		want    hmacSpec
+		wantErr string
+	}{
+		{value: "sha256:key:X-Signature: {signature}", want: hmacSpec{Algorithm: "sha256", key: []byte("key"), Header: "X-Signature", Template: "{signature}"}},
+		{
+			value: "sha1:env:CCCURL_HMAC_KEY:Authorization: HMAC sig={signature_b64}, ts={timestamp}",
+			want:  hmacSpec{Algorithm: "sha1", key: []byte("from-env"), Header: "Authorization", Template: "HMAC sig={signature_b64}, ts={timestamp}"},
+		},
+		{value: "md5:key:X-Signature: {signature}", wantErr: "expected sha1, sha256 or sha512"},
+		{value: "sha256:key:X-Signature: {date}", wantErr: "with a {signature} placeholder"},
+		{value: "sha256:key", wantErr: "with a {signature} placeholder"},
+		{value: "sha256:env:CCCURL_HMAC_UNSET:X-Signature: {signature}", wantErr: "CCCURL_HMAC_UNSET is not set"},
+	}
+
+	for _, tt := range tests {
+		var spec hmacSpec
+		err := spec.Set(tt.value)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Set(%q) error = %v, want one mentioning %q", tt.value, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Set(%q) error = %v", tt.value, err)
+			continue
+		}
+		if spec.Algorithm != tt.want.Algorithm || string(spec.key) != string(tt.want.key) || spec.Header != tt.want.Header || spec.Template != tt.want.Template {
+			t.Errorf("Set(%q) = %+v, want %+v", tt.value, spec, tt.want)
+		}
+		if strings.Contains(spec.String(), string(spec.key)) {
+			t.Errorf("String() = %q shows the key", spec.String())
+		}
+	}
+}
+
+func TestHMACSign(t *testing.T) {
+	var spec hmacSpec
+	if err := spec.Set("sha256:key:X-Signature: v1={signature} b64={signature_b64} t={timestamp}"); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(1994, 11, 6, 8, 49, 37, 0, time.UTC)
+	bodyHash := "230d8358dc8e8890b4c58deeb62912ee2f20357ae92a5cc861b98e68fe31acb5" // SHA-256 of "body"
+
+	var headers headerSet
+	spec.sign("POST", "/p?q=1", &headers, bodyHash, now)
+	if date, _ := headers.get("Date"); date != "Sun, 06 Nov 1994 08:49:37 GMT" {
+		t.Errorf("Date = %q, want the signing time", date)
+	}
+	want := "v1=bd7a4cb6e872d08f6f44ecb60adad88712e6d2f5b072a893bddaa252034c2ecc b64=vXpMtuhy0I9vROy2CtrYhxLm0vWwcqiTvdqiUgNMLsw= t=784111777"
+	if got, _ := headers.get("X-Signature"); got != want {
+		t.Errorf("X-Signature = %q, want %q", got, want)
+	}
+
+	// A Date given with -H is signed as is
+	headers = headerSet{{Name: "date", Value: "yesterday"}}
+	spec.sign("POST", "/p?q=1", &headers, bodyHash, now)
+	if date, _ := headers.get("Date"); date != "yesterday" || len(headers) != 2 {
+		t.Errorf("headers = %v, want the given Date kept", headers)
+	}
+}
+
+func TestHMACSignedRequest(t *testing.T) {
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request, body string) {
+		bodyHash := sha256.Sum256([]byte(body))
+		canonical := strings.Join([]string{r.Method, r.URL.RequestURI(), r.Header.Get("Date"), hex.EncodeToString(bodyHash[:])}, "\n")
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte(canonical))
+		if r.Header.Get("X-Signature") != hex.EncodeToString(mac.Sum(nil)) {
+			w.WriteHeader(401)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+
+	for _, args := range [][]string{{}, {"-d", "a=1&b=2"}} {
+		args = append([]string{"-s", "-S", "--hmac-sign", "sha256:secret:X-Signature: {signature}"}, args...)
+		result := runCLI(t, "", append(args, server.URL+"/signed?x=y")...)
+		if result.code != 0 || result.stdout != "ok" {
+			t.Errorf("%q: exit status %d, stdout %q, stderr:\n%s", args, result.code, result.stdout, result.stderr)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// hostPrefs is what earlier responses taught about one host
+type hostPrefs struct {
+	Proto        string        `json:"proto"`
+	AcceptRanges bool          `json:"accept_ranges"`
+	Encoding     string        `json:"content_encoding,omitempty"`
+	Latency      time.Duration `json:"latency"` // moving average from connected to the first response byte
+	Samples      int           `json:"samples"`
+	Updated      time.Time     `json:"updated"`
+}
+
+// hostDB maps host:port to what is known about it
+type hostDB map[string]hostPrefs
+
+// hostDBPath returns the file holding the host database
+func hostDBPath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "cccurl", "hosts.json")
+}
+
+// hostKey identifies the host of a URL in the database, whatever the case
+// the host was written in
+func hostKey(rawURL string) string {
+	parsed, err := parseURL(rawURL)
+	if err != nil || parsed.Host == "" {
+		return ""
+	}
+	return net.JoinHostPort(strings.ToLower(parsed.Host), parsed.Port)
+}
+
+// loadHostDB reads the host database; a missing file is an empty database
+func loadHostDB(path string) (hostDB, error) {
+	db := hostDB{}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return db, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading host database: %v", err)
+	}
+	if err := json.Unmarshal(content, &db); err != nil {
+		return nil, fmt.Errorf("error reading host database %s: %v", path, err)
+	}
+	return db, nil
+}
+
+// save writes the database back. Failing to save is not fatal, the
+// preferences are simply learned again next time
+func (db hostDB) save(path string) {
+	content, err := json.MarshalIndent(db, "", "  ")
+	if err != nil {
+		return
+	}
+	if os.MkdirAll(filepath.Dir(path), 0700) == nil {
+		os.WriteFile(path, content, 0600)
+	}
+}
+
+// learn folds a completed exchange into the entry for key. Latency is an
+// exponential moving average so a single slow response does not dominate
+func (db hostDB) learn(key string, resp *httpResponse, stats *transferStats) {
+	prefs := db[key]
+	prefs.Proto = resp.Proto
+	if ranges := resp.header("Accept-Ranges"); ranges != "" || resp.StatusCode == 206 {
+		prefs.AcceptRanges = resp.StatusCode == 206 || strings.EqualFold(ranges, "bytes")
+	}
+	if resp.StatusCode == 200 {
+		prefs.Encoding = resp.header("Content-Encoding")
+	}
+	latency := stats.StartTransfer - stats.Connect
+	if prefs.Samples == 0 {
+		prefs.Latency = latency
+	} else {
+		prefs.Latency = (prefs.Latency*3 + latency) / 4
+	}
+	prefs.Samples++
+	prefs.Updated = time.Now().UTC()
+	db[key] = prefs
+}
+
+// String summarizes the preferences on one line
+func (p hostPrefs) String() string {
+	ranges := "no ranges"
+	if p.AcceptRanges {
+		ranges = "ranges"
+	}
+	summary := fmt.Sprintf("%s, %s, %s average over %d responses", p.Proto, ranges, out.duration(p.Latency), p.Samples)
+	if p.Encoding != "" {
+		summary += ", sends " + p.Encoding + " bodies"
+	}
+	return summary
+}
+
+// runHosts implements the hosts subcommand, listing the host database or
+// clearing it with --clear
+func runHosts(args []string) error {
+	fs := flag.NewFlagSet("hosts", flag.ContinueOnError)
+	clear := fs.Bool("clear", false, "Remove every learned host")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s hosts [--clear]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return fmt.Errorf("error: hosts takes no arguments")
+	}
+
+	path := hostDBPath()
+	if *clear {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("error clearing host database: %v", err)
+		}
+		fmt.Printf("Cleared %s\n", path)
+		return nil
+	}
+
+	db, err := loadHostDB(path)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Host database: %s\n", path)
+	keys := make([]string, 0, len(db))
+	for key := range db {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Printf("  %s: %s (updated %s)\n", key, db[key], db[key].Updated.Format(time.RFC3339))
+	}
+	if len(keys) == 0 {
+		fmt.Println("  (empty)")
+	}
+	return nil
+}
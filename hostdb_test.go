@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHostDBLearn(t *testing.T) {
+	db := hostDB{}
+	ranged := &httpResponse{Proto: "HTTP/1.1", StatusCode: 200, Headers: []headerField{{Name: "Accept-Ranges", Value: "bytes"}, {Name: "Content-Encoding", Value: "gzip"}}}
+	plain := &httpResponse{Proto: "HTTP/1.0", StatusCode: 404}
+
+	db.learn("a:80", ranged, &transferStats{Connect: 10 * time.Millisecond, StartTransfer: 110 * time.Millisecond})
+	if prefs := db["a:80"]; prefs.Proto != "HTTP/1.1" || !prefs.AcceptRanges || prefs.Encoding != "gzip" || prefs.Latency != 100*time.Millisecond || prefs.Samples != 1 {
+		t.Fatalf("after one response = %+v", prefs)
+	}
+
+	// A response saying nothing about ranges or encoding keeps what was learned
+	db.learn("a:80", plain, &transferStats{StartTransfer: 500 * time.Millisecond})
+	prefs := db["a:80"]
+	if prefs.Proto != "HTTP/1.0" || !prefs.AcceptRanges || prefs.Encoding != "gzip" || prefs.Samples != 2 {
+		t.Errorf("after two responses = %+v", prefs)
+	}
+	if prefs.Latency != 200*time.Millisecond {
+		t.Errorf("Latency = %v, want the moving average 200ms", prefs.Latency)
+	}
+
+	db.learn("a:80", &httpResponse{StatusCode: 200, Headers: []headerField{{Name: "Accept-Ranges", Value: "none"}}}, &transferStats{})
+	if prefs := db["a:80"]; prefs.AcceptRanges || prefs.Encoding != "" {
+		t.Errorf("after refusing ranges = %+v", prefs)
+	}
+}
+
+func TestHostDBSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cccurl", "hosts.json")
+	db, err := loadHostDB(path)
+	if err != nil || len(db) != 0 {
+		t.Fatalf("loadHostDB of a missing file = %v, %v, want an empty database", db, err)
+	}
+
+	db["example.com:443"] = hostPrefs{Proto: "HTTP/1.1", AcceptRanges: true, Latency: time.Second, Samples: 3}
+	db.save(path)
+	loaded, err := loadHostDB(path)
+	if err != nil {
+		t.Fatalf("loadHostDB error = %v", err)
+	}
+	if got := loaded["example.com:443"]; got != db["example.com:443"] {
+		t.Errorf("loaded %+v, want %+v", got, db["example.com:443"])
+	}
+
+	os.WriteFile(path, []byte("{not json"), 0o600)
+	if _, err := loadHostDB(path); err == nil {
+		t.Error("loadHostDB of a corrupt file gave no error")
+	}
+}
+
+func TestHostKey(t *testing.T) {
+	tests := map[string]string{
+		"http://Example.com/x": "example.com:80",
+		"https://[::1]:8443/":  "[::1]:8443",
+	}
+	for rawURL, want := range tests {
+		if got := hostKey(rawURL); got != want {
+			t.Errorf("hostKey(%q) = %q, want %q", rawURL, got, want)
+		}
+	}
+}
+
+func TestHostDBAcrossRuns(t *testing.T) {
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request, body string) {
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Write([]byte("ok"))
+	})
+	key := strings.TrimPrefix(server.URL, "http://")
+	env := []string{"XDG_CACHE_HOME=" + t.TempDir()}
+
+	first := runCLIWithEnv(t, env, "", "--host-db", server.URL+"/")
+	if first.code != 0 {
+		t.Fatalf("exit status %d, stderr:\n%s", first.code, first.stderr)
+	}
+	if strings.Contains(first.stdout, "Known host") {
+		t.Errorf("the first run already knew the host:\n%s", first.stdout)
+	}
+	second := runCLIWithEnv(t, env, "", "--host-db", server.URL+"/")
+	if !strings.Contains(second.stdout, "Known host "+key+": HTTP/1.1, ranges") {
+		t.Errorf("the second run did not use what the first learned:\n%s", second.stdout)
+	}
+
+	listed := runCLIWithEnv(t, env, "", "hosts")
+	if listed.code != 0 || !strings.Contains(listed.stdout, key+": HTTP/1.1, ranges") || !strings.Contains(listed.stdout, "over 2 responses") {
+		t.Errorf("hosts printed:\n%s%s", listed.stdout, listed.stderr)
+	}
+	runCLIWithEnv(t, env, "", "hosts", "--clear")
+	if listed = runCLIWithEnv(t, env, "", "hosts"); !strings.Contains(listed.stdout, "(empty)") {
+		t.Errorf("hosts after --clear printed:\n%s", listed.stdout)
+	}
+}
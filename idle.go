@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// idleConn records read and write activity on the connection in the transfer
+// stats so that monitorIdleReads can tell a silent server from a slow one
+type idleConn struct {
+	net.Conn
+	stats *transferStats
+}
+
+// Read reads from the connection, marking it as waiting on the server meanwhile
+func (c *idleConn) Read(p []byte) (int, error) {
+	c.stats.touch()
+	c.stats.Reading.Add(1)
+	n, err := c.Conn.Read(p)
+	c.stats.Reading.Add(-1)
+	if n > 0 {
+		c.stats.touch()
+	}
+	return n, err
+}
+
+// Write writes to the connection; upload progress counts as activity, so a
+// long upload does not trip the timeout of the pending response read
+func (c *idleConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		c.stats.touch()
+	}
+	return n, err
+}
+
+// monitorIdleReads cancels the returned context once a read has waited
+// --read-timeout without any byte moving on the connection. Unlike
+// --speed-limit, a server that streams slowly but steadily is never cut off
+func monitorIdleReads(parent context.Context, opts requestOptions, stats *transferStats) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(parent)
+	timeout := seconds(opts.ReadTimeout)
+	interval := min(max(timeout/10, 10*time.Millisecond), 250*time.Millisecond)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if stats.Reading.Load() == 0 {
+					continue
+				}
+				idle := time.Since(stats.Start) - time.Duration(stats.LastActive.Load())
+				if idle >= timeout {
+					cancel(&exitError{
+						code: exitOperationTimedOut,
+						err:  fmt.Errorf("Read timed out: no data received for %s", out.duration(timeout)),
+					})
+					return
+				}
+			}
+		}
+	}()
+
+	return ctx, func() { cancel(context.Canceled) }
+}
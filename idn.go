@@ -0,0 +1,293 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Punycode parameters (RFC 3492 section 5)
+const (
+	punyBase        = 36
+	punyTMin        = 1
+	punyTMax        = 26
+	punySkew        = 38
+	punyDamp        = 700
+	punyInitialBias = 72
+	punyInitialN    = 128
+)
+
+// idnToASCII converts an internationalized host name such as bücher.example
+// to the ASCII form used for DNS and the Host header, xn--bcher-kva.example.
+// The name is first mapped the way UTS #46 does for the common cases:
+// lowercased, full-width forms and ideographic dots turned into their ASCII
+// counterparts and invisible characters dropped. Labels with non-ASCII
+// characters are then validated and Punycode-encoded. Unicode normalization
+// is not applied, as the standard library has no tables for it, so a name
+// must be typed in its composed form: ü rather than u followed by U+0308
+func idnToASCII(host string) (string, error) {
+	if isASCII(host) {
+		return host, nil
+	}
+	if !utf8.ValidString(host) {
+		return "", fmt.Errorf("invalid host name %q: not valid UTF-8", host)
+	}
+	labels := strings.Split(idnMap(host), ".")
+	bidi := slices.ContainsFunc(labels, isRTLLabel)
+	for i, label := range labels {
+		if bidi {
+			if err := checkBidiLabel(label); err != nil {
+				return "", fmt.Errorf("invalid host name %q: %v", host, err)
+			}
+		}
+		if isASCII(label) {
+			continue
+		}
+		if err := checkIDNLabel(label); err != nil {
+			return "", fmt.Errorf("invalid host name %q: %v", host, err)
+		}
+		encoded, err := punycode(label)
+		if err != nil {
+			return "", fmt.Errorf("invalid host name %q: %v", host, err)
+		}
+		labels[i] = "xn--" + encoded
+		if len(labels[i]) > 63 {
+			return "", fmt.Errorf("invalid host name %q: label %s is longer than 63 bytes", host, labels[i])
+		}
+	}
+	return strings.Join(labels, "."), nil
+}
+
+// idnMap applies the UTS #46 mappings that matter for typed names: case
+// folding, full-width ASCII (U+FF01 to U+FF5E), the ideographic and
+// full-width dots as label separators, and removal of the invisible
+// characters UTS #46 maps to nothing
+func idnMap(host string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\u3002' || r == '\uff0e' || r == '\uff61':
+			return '.'
+		case r >= 0xff01 && r <= 0xff5e:
+			return unicode.ToLower(r - 0xfee0)
+		case r == '\u00ad' || r == '\u034f' || r == '\u180f' || r == '\u200b' || r == '\u2060' || r == '\u2064' || r == '\ufeff',
+			r >= '\u180b' && r <= '\u180d', r >= '\ufe00' && r <= '\ufe0f', r >= 0xe0100 && r <= 0xe01ef:
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, host)
+}
+
+// checkIDNLabel rejects a mapped label IDNA does not allow: one starting or
+// ending with a hyphen, with hyphens in its third and fourth positions, or
+// starting with a combining mark, and one holding ASCII other than letters,
+// digits and hyphens, spaces, control, format, private-use or unassigned
+// code points. A joiner is only allowed after a virama, as in Indic
+// scripts (RFC 5892 appendix A)
+func checkIDNLabel(label string) error {
+	runes := []rune(label)
+	switch {
+	case strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-"):
+		return fmt.Errorf("label %s starts or ends with a hyphen", label)
+	case len(runes) >= 4 && runes[2] == '-' && runes[3] == '-':
+		return fmt.Errorf("label %s has hyphens in its third and fourth positions", label)
+	case unicode.Is(unicode.M, runes[0]):
+		return fmt.Errorf("label %s starts with a combining mark", label)
+	}
+	for i, r := range runes {
+		switch {
+		case r == '\u200c' || r == '\u200d':
+			if i == 0 || !isVirama(runes[i-1]) {
+				return fmt.Errorf("label %s has a joiner U+%04X that does not follow a virama", label, r)
+			}
+		case r < utf8.RuneSelf:
+			if r != '-' && (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+				return fmt.Errorf("label %s contains %q, which is not allowed in a host name", label, r)
+			}
+		case unicode.In(r, unicode.Cc, unicode.Cf, unicode.Co, unicode.Cs, unicode.Z) || !unicode.In(r, unicode.L, unicode.M, unicode.N, unicode.P, unicode.S):
+			return fmt.Errorf("label %s contains U+%04X, which is not allowed in a host name", label, r)
+		}
+	}
+	return nil
+}
+
+// isVirama reports whether r is the virama of one of the main Indic
+// scripts, the one place a zero-width joiner or non-joiner belongs
+func isVirama(r rune) bool {
+	switch r {
+	case '\u094d', '\u09cd', '\u0a4d', '\u0acd', '\u0b4d', '\u0bcd', '\u0c4d', '\u0ccd', '\u0d4d', '\u0dca', '\u0e3a', '\u1039', '\u17d2', '\ua9c0':
+		return true
+	}
+	return false
+}
+
+// Bidirectional classes of RFC 5893, as far as a host name needs them
+const (
+	bidiL   = iota // left to right
+	bidiR          // right to left: Hebrew and other scripts that are not Arabic
+	bidiAL         // Arabic letter
+	bidiEN         // European number
+	bidiAN         // Arabic number
+	bidiES         // European separator, the hyphen
+	bidiNSM        // non-spacing mark
+	bidiON         // neutral
+)
+
+// bidiClass returns the bidirectional class of r. The standard library has
+// no table of these, so it is derived from the script and category of r,
+// which is right for the letters, digits and marks that make up host names
+func bidiClass(r rune) int {
+	switch {
+	case unicode.In(r, unicode.Mn, unicode.Me):
+		return bidiNSM
+	case r >= '0' && r <= '9', r >= '\u06f0' && r <= '\u06f9':
+		return bidiEN
+	case r >= '\u0660' && r <= '\u0669', r == '\u066b' || r == '\u066c' || r == '\u06dd' || r == '\u08e2', r >= 0x10e60 && r <= 0x10e7e:
+		return bidiAN
+	case r == '-' || r == '+':
+		return bidiES
+	case unicode.In(r, unicode.Arabic, unicode.Syriac, unicode.Thaana) && unicode.Is(unicode.L, r):
+		return bidiAL
+	case unicode.In(r, unicode.Hebrew, unicode.Nko, unicode.Samaritan, unicode.Mandaic, unicode.Adlam) && unicode.Is(unicode.L, r),
+		r >= 0x10800 && r <= 0x10fff && unicode.Is(unicode.L, r):
+		return bidiR
+	case unicode.In(r, unicode.L, unicode.Mc, unicode.N):
+		return bidiL
+	}
+	return bidiON
+}
+
+// isRTLLabel reports whether a label holds right-to-left characters, which
+// makes the whole name subject to the Bidi rule
+func isRTLLabel(label string) bool {
+	return strings.ContainsFunc(label, func(r rune) bool {
+		class := bidiClass(r)
+		return class == bidiR || class == bidiAL || class == bidiAN
+	})
+}
+
+// checkBidiLabel applies the Bidi rule of RFC 5893 section 2 to one label
+// of a name containing right-to-left text, so that it cannot display in an
+// order that reads as another name
+func checkBidiLabel(label string) error {
+	if label == "" {
+		return nil
+	}
+	classes := make([]int, 0, len(label))
+	for _, r := range label {
+		classes = append(classes, bidiClass(r))
+	}
+	last := len(classes) - 1
+	for last > 0 && classes[last] == bidiNSM {
+		last--
+	}
+	rtl := classes[0] == bidiR || classes[0] == bidiAL
+	switch {
+	case !rtl && classes[0] != bidiL:
+		return fmt.Errorf("label %s of a right-to-left name must start with a letter", label)
+	case rtl && slices.Contains(classes, bidiL):
+		return fmt.Errorf("label %s mixes right-to-left and left-to-right letters", label)
+	case rtl && slices.Contains(classes, bidiEN) && slices.Contains(classes, bidiAN):
+		return fmt.Errorf("label %s mixes European and Arabic digits", label)
+	case rtl && classes[last] != bidiR && classes[last] != bidiAL && classes[last] != bidiEN && classes[last] != bidiAN:
+		return fmt.Errorf("label %s must end with a right-to-left letter or digit", label)
+	case !rtl && slices.ContainsFunc(classes, func(c int) bool { return c == bidiR || c == bidiAL || c == bidiAN }):
+		return fmt.Errorf("label %s mixes left-to-right and right-to-left text", label)
+	case !rtl && classes[last] != bidiL && classes[last] != bidiEN:
+		return fmt.Errorf("label %s must end with a letter or digit", label)
+	}
+	return nil
+}
+
+// isASCII reports whether s holds only ASCII characters
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// punycode encodes one label with the Punycode algorithm of RFC 3492: the
+// ASCII characters are copied, followed by a delimiter and the insertions
+// of the other code points, encoded as variable-length base-36 deltas
+func punycode(label string) (string, error) {
+	runes := []rune(label)
+	var b strings.Builder
+	for _, r := range runes {
+		if r < utf8.RuneSelf {
+			b.WriteRune(r)
+		}
+	}
+	basic := b.Len()
+	handled := basic
+	if basic > 0 {
+		b.WriteByte('-')
+	}
+
+	n, delta, bias := rune(punyInitialN), 0, punyInitialBias
+	for handled < len(runes) {
+		// The smallest code point not handled yet
+		next := rune(utf8.MaxRune)
+		for _, r := range runes {
+			if r >= n && r < next {
+				next = r
+			}
+		}
+		if int(next-n) > (1<<31-1-delta)/(handled+1) {
+			return "", fmt.Errorf("label %q is too long to encode", label)
+		}
+		delta += int(next-n) * (handled + 1)
+		n = next
+		for _, r := range runes {
+			if r < n {
+				delta++
+			}
+			if r != n {
+				continue
+			}
+			q := delta
+			for k := punyBase; ; k += punyBase {
+				t := max(punyTMin, min(punyTMax, k-bias))
+				if q < t {
+					break
+				}
+				b.WriteByte(punyDigit(t + (q-t)%(punyBase-t)))
+				q = (q - t) / (punyBase - t)
+			}
+			b.WriteByte(punyDigit(q))
+			bias = punyAdapt(delta, handled+1, handled == basic)
+			delta = 0
+			handled++
+		}
+		delta++
+		n++
+	}
+	return b.String(), nil
+}
+
+// punyDigit returns the character for a base-36 digit: a-z, then 0-9
+func punyDigit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
+
+// punyAdapt is the bias adaptation function of RFC 3492 section 6.1
+func punyAdapt(delta int, points int, first bool) int {
+	if first {
+		delta /= punyDamp
+	} else {
+		delta /= 2
+	}
+	delta += delta / points
+	k := 0
+	for delta > ((punyBase-punyTMin)*punyTMax)/2 {
+		delta /= punyBase - punyTMin
+		k += punyBase
+	}
+	return k + (punyBase-punyTMin+1)*delta/(delta+punySkew)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPunycode(t *testing.T) {
+	tests := []struct {
+		label string
+		want  string
+	}{
+		{"bücher", "bcher-kva"},
+		{"münchen", "mnchen-3ya"},
+		{"abcé", "abc-dma"},
+		{"ü", "tda"},
+		{"☃", "n3h"},
+		{"日本語", "wgv71a119e"},
+		{"правительство", "80aealotwbjpid2k"},
+		// RFC 3492 section 7.1 sample (L), mixed-case ASCII kept
+		{"3年B組金八先生", "3B-ww4c5e180e575a65lsy2b"},
+	}
+
+	for _, tt := range tests {
+		got, err := punycode(tt.label)
+		if err != nil {
+			t.Errorf("punycode(%q) error = %v", tt.label, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("punycode(%q) = %q, want %q", tt.label, got, tt.want)
+		}
+	}
+}
+
+func TestIDNToASCII(t *testing.T) {
+	tests := []struct {
+		host    string
+		want    string
+		wantErr bool
+	}{
+		{host: "example.com", want: "example.com"},
+		{host: "Example.COM", want: "Example.COM"},
+		{host: "bücher.example", want: "xn--bcher-kva.example"},
+		{host: "BÜCHER.Example", want: "xn--bcher-kva.example"},
+		{host: "www.münchen.de", want: "www.xn--mnchen-3ya.de"},
+		{host: "日本語.jp", want: "xn--wgv71a119e.jp"},
+		{host: "b\xffcher.example", wantErr: true},
+		{host: strings.Repeat("é", 70) + ".example", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := idnToASCII(tt.host)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("idnToASCII(%q) = %q, want an error", tt.host, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("idnToASCII(%q) error = %v", tt.host, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("idnToASCII(%q) = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestIDNMapping(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{host: "ＢÜＣＨＥＲ\uff0eexample", want: "xn--bcher-kva.example"},
+		{host: "bücher\u3002example", want: "xn--bcher-kva.example"},
+		{host: "bü\u00adcher.example", want: "xn--bcher-kva.example"},
+		{host: "bücher\ufe0f.example", want: "xn--bcher-kva.example"},
+		{host: "ＥＸＡＭＰＬＥ.com", want: "example.com"},
+		{host: "STRAẞE.de", want: "xn--strae-oqa.de"},
+		{host: "क\u094d\u200dष.example", want: "xn--11b2ezcw70k.example"},
+	}
+
+	for _, tt := range tests {
+		got, err := idnToASCII(tt.host)
+		if err != nil || got != tt.want {
+			t.Errorf("idnToASCII(%q) = %q, %v, want %q", tt.host, got, err, tt.want)
+		}
+	}
+}
+
+func TestIDNValidation(t *testing.T) {
+	tests := []struct {
+		host    string
+		wantErr string // "" when the name is valid
+	}{
+		{host: "bü cher.example", wantErr: "not allowed"},
+		{host: "bü_cher.example", wantErr: "not allowed"},
+		{host: "bü\ue000cher.example", wantErr: "not allowed"},
+		{host: "bü\u0378cher.example", wantErr: "not allowed"},
+		{host: "bü\u200echer.example", wantErr: "not allowed"},
+		{host: "-bücher.example", wantErr: "hyphen"},
+		{host: "bücher-.example", wantErr: "hyphen"},
+		{host: "bü--cher.example", wantErr: "third and fourth"},
+		{host: "\u0308bücher.example", wantErr: "combining mark"},
+		{host: "bü\u200dcher.example", wantErr: "virama"},
+		{host: "שלום.example"},
+		{host: "שלום\u05b0.example"},
+		{host: "مثال.إختبار"},
+		{host: "مثال١٢.example"},
+		{host: "שלוםabc.example", wantErr: "mixes right-to-left and left-to-right"},
+		{host: "١שלום.example", wantErr: "must start with a letter"},
+		{host: "שלום-.example", wantErr: "must end with a right-to-left letter"},
+		{host: "مثال١2.example", wantErr: "European and Arabic digits"},
+		{host: "שלום.1example", wantErr: "must start with a letter"},
+		{host: "abcש.example", wantErr: "mixes left-to-right and right-to-left"},
+	}
+
+	for _, tt := range tests {
+		got, err := idnToASCII(tt.host)
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("idnToASCII(%q) error = %v", tt.host, err)
+		case tt.wantErr == "" && !strings.HasPrefix(got, "xn--"):
+			t.Errorf("idnToASCII(%q) = %q, want a Punycode label first", tt.host, got)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("idnToASCII(%q) = %q, %v, want an error mentioning %q", tt.host, got, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// supportedFeatures lists the capabilities compiled into this build, in the
+// spirit of the Features line of curl --version, with the options that use
+// them. Add a feature here along with its code
+var supportedFeatures = []string{
+	"aws-sigv4",   // --aws-sigv4
+	"basic-auth",  // -u
+	"bearer-auth", // --oauth2-bearer
+	"chunked",     // chunked responses and streamed request bodies
+	"cookies",     // -b, -c
+	"digest-auth", // --digest
+	"doh",         // --doh-url
+	"expect-100",  // --expect100-timeout
+	"glob",        // [1-10] and {a,b} in URLs
+	"gzip-upload", // -d @file.gz
+	"hmac",        // --hmac-sign
+	"idn",         // internationalized host names
+	"keep-alive",  // connection reuse across URLs
+	"multipart",   // -F
+	"netrc",       // -n, --netrc
+	"ntlm",        // --ntlm
+	"oauth2",      // --oauth2
+	"rate-limit",  // --limit-rate
+	"redirects",   // -L
+	"retry",       // --retry
+	"upload",      // -T
+	"write-out",   // -w
+}
+
+// environmentVariables lists the environment variables cccurl consults
+var environmentVariables = []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "NETRC", "NO_COLOR"}
+
+// buildVersion returns the module version and VCS revision stamped into the
+// binary; the version is "(devel)" for a build from a source checkout
+func buildVersion() (string, string) {
+	version, revision := "(devel)", ""
+	if build, ok := debug.ReadBuildInfo(); ok {
+		if build.Main.Version != "" {
+			version = build.Main.Version
+		}
+		for _, setting := range build.Settings {
+			if setting.Key == "vcs.revision" {
+				revision = setting.Value
+			}
+		}
+	}
+	return version, revision
+}
+
+// userAgent is the default User-Agent, cccurl/<version>
+func userAgent() string {
+	version, _ := buildVersion()
+	if version == "(devel)" {
+		version = "dev"
+	}
+	return "cccurl/" + strings.TrimPrefix(version, "v")
+}
+
+// runInfo implements the info subcommand, printing the build, the supported
+// protocols and features, and the environment and files that influence a run
+func runInfo(args []string) error {
+	fs := flag.NewFlagSet("info", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s info\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return fmt.Errorf("error: info takes no arguments")
+	}
+
+	version, revision := buildVersion()
+	if revision != "" {
+		revision = " " + revision
+	}
+	fmt.Printf("cccurl %s%s (%s %s/%s)\n", version, revision, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	fmt.Println("Protocols: http")
+	fmt.Printf("Features: %s\n", strings.Join(supportedFeatures, " "))
+
+	fmt.Println()
+	fmt.Println("Environment:")
+	for _, name := range environmentVariables {
+		value, ok := os.LookupEnv(name)
+		switch {
+		case ok && (strings.Contains(name, "SECRET") || strings.Contains(name, "TOKEN")):
+			// Never echo secrets into a support paste
+			fmt.Printf("  %s (set)\n", name)
+		case ok:
+			fmt.Printf("  %s=%s\n", name, value)
+		default:
+			fmt.Printf("  %s (unset)\n", name)
+		}
+	}
+
+	fmt.Println()
+	fmt.Printf("Credentials file: %s (read with -n or --netrc)\n", defaultNetrcPath())
+	fmt.Printf("Cache directory: %s (access tokens fetched with --oauth2)\n", oauth2CacheDir())
+	fmt.Printf("Host database: %s (learned with --host-db)\n", hostDBPath())
+	return nil
+}
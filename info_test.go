@@ -0,0 +1,38 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSupportedFeaturesSorted(t *testing.T) {
+	if !slices.IsSorted(supportedFeatures) {
+		t.Errorf("supportedFeatures is not sorted: %q", supportedFeatures)
+	}
+	if len(slices.Compact(slices.Clone(supportedFeatures))) != len(supportedFeatures) {
+		t.Errorf("supportedFeatures lists a feature twice: %q", supportedFeatures)
+	}
+}
+
+func TestInfo(t *testing.T) {
+	result := runCLI(t, "", "info")
+	if result.code != 0 {
+		t.Fatalf("exit status %d, stderr:\n%s", result.code, result.stderr)
+	}
+	for _, want := range []string{
+		"Protocols: http\n",
+		"Features: " + strings.Join(supportedFeatures, " ") + "\n",
+		"  NO_COLOR=1\n",
+		"Credentials file: ",
+		"Host database: ",
+	} {
+		if !strings.Contains(result.stdout, want) {
+			t.Errorf("info output has no %q:\n%s", want, result.stdout)
+		}
+	}
+
+	if result := runCLI(t, "", "info", "extra"); result.code == 0 {
+		t.Error("info accepted an argument")
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// itemSeparators are the separators of HTTPie-style request items, longest
+// first so that ":=@" is not mistaken for ":" or ":="
+var itemSeparators = []string{":=@", ":=", "=@", "=", "@", ":"}
+
+// splitItem splits a request item at its separator: whichever occurs first,
+// preferring the longest one starting there
+func splitItem(item string) (key string, sep string, value string, ok bool) {
+	best := -1
+	for _, candidate := range itemSeparators {
+		i := strings.Index(item, candidate)
+		if i > 0 && (best < 0 || i < best) {
+			best, sep = i, candidate
+		}
+	}
+	if best < 0 {
+		return "", "", "", false
+	}
+	return item[:best], sep, item[best+len(sep):], true
+}
+
+// hostPortURL matches a scheme-less URL naming a port, like localhost:8080
+// or example.com:8080/path, which would otherwise read as a header item
+var hostPortURL = regexp.MustCompile(`^(localhost|[^\s:/@=]*\.[^\s:/@=]*):\d+(/|$)`)
+
+// hostQueryKey matches the key an item split would find in a scheme-less URL
+// with a query but no path, like example.com?q for example.com?q=x
+var hostQueryKey = regexp.MustCompile(`^(localhost|[^\s:/@=?]*\.[^\s:/@=?]*)\?`)
+
+// splitPositional separates the URLs from the request items among the
+// arguments after the flags. The first argument is always a URL; after it an
+// argument containing "://", one without any item separator such as
+// example.com/path, or a host:port one is another URL. So is one whose key
+// would hold a '/' or look like a host with a query, as in
+// example.com/search?q=x or example.com?q=x, since no header or field name
+// does. Anything else is a request item
+func splitPositional(args []string) (urls []string, items []string) {
+	for i, arg := range args {
+		key, _, _, isItem := splitItem(arg)
+		urlKey := strings.Contains(key, "/") || hostQueryKey.MatchString(key)
+		if i == 0 || strings.Contains(arg, "://") || !isItem || urlKey || hostPortURL.MatchString(arg) {
+			urls = append(urls, arg)
+			continue
+		}
+		items = append(items, arg)
+	}
+	return urls, items
+}
+
+// applyItems compiles HTTPie-style request items given after the URL:
+// Header:value adds a header, key=value a JSON string field, key:=raw a
+// JSON literal such as a number, boolean, array or object, and key@file or
+// key=@file a string field holding a file's content, with key:=@file taking
+// a JSON literal from a file. Fields are sent in order as a JSON object with
+// --json semantics
+func applyItems(opts *requestOptions, items []string) error {
+	var fields []string
+	for _, item := range items {
+		key, sep, value, ok := splitItem(item)
+		if !ok {
+			return fmt.Errorf("error: invalid request item %q: expected Header:value, key=value, key:=json or key@file", item)
+		}
+		if sep == ":" {
+			opts.Headers = append(opts.Headers, key+": "+value)
+			continue
+		}
+
+		raw := value
+		if strings.HasSuffix(sep, "@") {
+			content, err := os.ReadFile(value)
+			if err != nil {
+				return fmt.Errorf("error reading request item %s: %v", key, err)
+			}
+			raw = string(content)
+		}
+		var field []byte
+		if strings.HasPrefix(sep, ":=") {
+			if !json.Valid([]byte(raw)) {
+				return fmt.Errorf("error: request item %s is not valid JSON: %s", key, raw)
+			}
+			field = []byte(strings.TrimSpace(raw))
+		} else {
+			field, _ = json.Marshal(raw)
+		}
+		name, _ := json.Marshal(key)
+		fields = append(fields, string(name)+":"+string(field))
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	if len(opts.DataArgs) > 0 || len(opts.FormArgs) > 0 || opts.UploadFile != "" {
+		return fmt.Errorf("error: request item fields build a JSON body and cannot be combined with -d, --json, -F or -T")
+	}
+	opts.DataArgs = dataList{{kind: dataJSON, value: "{" + strings.Join(fields, ",") + "}"}}
+	return nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSplitItem(t *testing.T) {
+	tests := []struct {
+		item string
+		want [3]string
+		isOK bool
+	}{
+		{item: "Accept:application/json", want: [3]string{"Accept", ":", "application/json"}, isOK: true},
+		{item: "name=cc", want: [3]string{"name", "=", "cc"}, isOK: true},
+		{item: "age:=3", want: [3]string{"age", ":=", "3"}, isOK: true},
+		{item: "doc:=@a.json", want: [3]string{"doc", ":=@", "a.json"}, isOK: true},
+		{item: "bio=@bio.txt", want: [3]string{"bio", "=@", "bio.txt"}, isOK: true},
+		{item: "bio@bio.txt", want: [3]string{"bio", "@", "bio.txt"}, isOK: true},
+		{item: "url=http://x", want: [3]string{"url", "=", "http://x"}, isOK: true},
+		{item: "example.com/path"},
+		{item: "=value"},
+	}
+
+	for _, tt := range tests {
+		key, sep, value, ok := splitItem(tt.item)
+		if ok != tt.isOK || [3]string{key, sep, value} != tt.want {
+			t.Errorf("splitItem(%q) = %q, %q, %q, %v, want %q, %v", tt.item, key, sep, value, ok, tt.want, tt.isOK)
+		}
+	}
+}
+
+func TestSplitPositional(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		wantURLs  []string
+		wantItems []string
+	}{
+		{name: "first is a URL", args: []string{"example.com?q=x", "name=cc"}, wantURLs: []string{"example.com?q=x"}, wantItems: []string{"name=cc"}},
+		{name: "scheme", args: []string{"a", "http://b/?q=x"}, wantURLs: []string{"a", "http://b/?q=x"}},
+		{name: "no separator", args: []string{"a", "example.com/b"}, wantURLs: []string{"a", "example.com/b"}},
+		{name: "host and port", args: []string{"a", "localhost:8080", "example.com:8080/x"}, wantURLs: []string{"a", "localhost:8080", "example.com:8080/x"}},
+		{name: "path and query", args: []string{"a", "foo.com/s?q=x"}, wantURLs: []string{"a", "foo.com/s?q=x"}},
+		{name: "host and query", args: []string{"a", "foo.com?q=x", "localhost?q=x"}, wantURLs: []string{"a", "foo.com?q=x", "localhost?q=x"}},
+		{name: "items", args: []string{"a", "X-Tag:v", "user.name=cc", "path=/x/y", "q==x"}, wantURLs: []string{"a"}, wantItems: []string{"X-Tag:v", "user.name=cc", "path=/x/y", "q==x"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			urls, items := splitPositional(tt.args)
+			if !slices.Equal(urls, tt.wantURLs) || !slices.Equal(items, tt.wantItems) {
+				t.Errorf("splitPositional(%q) = %q, %q, want %q, %q", tt.args, urls, items, tt.wantURLs, tt.wantItems)
+			}
+		})
+	}
+}
+
+func TestApplyItems(t *testing.T) {
+	dir := t.TempDir()
+	bio := filepath.Join(dir, "bio.txt")
+	if err := os.WriteFile(bio, []byte("line \"one\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	doc := filepath.Join(dir, "doc.json")
+	if err := os.WriteFile(doc, []byte(" [1, 2]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		items       []string
+		opts        requestOptions
+		wantHeaders headerList
+		wantBody    string
+		wantErr     string
+	}{
+		{name: "header only", items: []string{"X-Tag:v"}, wantHeaders: headerList{"X-Tag: v"}},
+		{
+			name:     "fields in order",
+			items:    []string{"name=cc", "age:=3", "tags:=[\"a\"]", "bio@" + bio, "doc:=@" + doc},
+			wantBody: `{"name":"cc","age":3,"tags":["a"],"bio":"line \"one\"\n","doc":[1, 2]}`,
+		},
+		{name: "invalid json", items: []string{"age:=x"}, wantErr: "not valid JSON"},
+		{name: "missing file", items: []string{"bio@" + filepath.Join(dir, "none")}, wantErr: "error reading request item bio"},
+		{name: "not an item", items: []string{"plain"}, wantErr: "invalid request item"},
+		{name: "with -d", items: []string{"a=1"}, opts: requestOptions{DataArgs: dataList{{kind: dataPlain, value: "x"}}}, wantErr: "cannot be combined"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			err := applyItems(&opts, tt.items)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("applyItems error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyItems error = %v", err)
+			}
+			if !slices.Equal(opts.Headers, tt.wantHeaders) {
+				t.Errorf("headers = %q, want %q", opts.Headers, tt.wantHeaders)
+			}
+			body := ""
+			if len(opts.DataArgs) == 1 && opts.DataArgs[0].kind == dataJSON {
+				body = opts.DataArgs[0].value
+			}
+			if body != tt.wantBody {
+				t.Errorf("body = %s, want %s", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestRequestItems(t *testing.T) {
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request, body string) { w.Write([]byte(r.URL.Path + ";")) })
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	result := runCLI(t, "", "-s", "-S", server.URL+"/first", "name=cc", "X-Tag:v", host+"/second?q=x")
+	if result.code != 0 {
+		t.Fatalf("exit status %d, stderr:\n%s", result.code, result.stderr)
+	}
+	if result.stdout != "/first;/second;" {
+		t.Errorf("stdout = %q, want both URLs fetched", result.stdout)
+	}
+	for _, r := range server.received() {
+		if r.Body != `{"name":"cc"}` || r.Header.Get("X-Tag") != "v" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("%s %s with body %q, X-Tag %q and Content-Type %q, want the items on each", r.Method, r.URL, r.Body, r.Header.Get("X-Tag"), r.Header.Get("Content-Type"))
+		}
+	}
+	if last := server.last(t); last.URL != "/second?q=x" {
+		t.Errorf("second URL requested as %q", last.URL)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// idleConns holds the connections left open after a complete response, so
+// a later transfer to the same host, of the same URL list or after --next,
+// sends its request on one of them instead of connecting again
+var idleConns = &connPool{}
+
+// connPool holds idle connections by the host, port and source settings
+// they were opened with
+type connPool struct {
+	mu    sync.Mutex
+	conns map[string][]net.Conn
+}
+
+// take removes and returns an idle connection for key, or nil when there is none
+func (p *connPool) take(key string) net.Conn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	conns := p.conns[key]
+	if len(conns) == 0 {
+		return nil
+	}
+	conn := conns[len(conns)-1]
+	p.conns[key] = conns[:len(conns)-1]
+	return conn
+}
+
+// put keeps conn for a later request to key
+func (p *connPool) put(key string, conn net.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conns == nil {
+		p.conns = map[string][]net.Conn{}
+	}
+	p.conns[key] = append(p.conns[key], conn)
+}
+
+// closeAll closes every idle connection, once no transfer is left to use them
+func (p *connPool) closeAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, conns := range p.conns {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}
+	p.conns = nil
+}
+
+// reusesConns reports whether the transfer may send its request on an idle
+// connection and leave its own one open. Rotating source addresses needs a
+// new connection every time, and a half-closed one cannot carry another
+// request
+func (opts *requestOptions) reusesConns() bool {
+	return len(opts.Sources.addrs) == 0 && !opts.HalfClose
+}
+
+// keepsAlive reports whether the request asks the server to keep the
+// connection open, for the transfers still to come
+func (opts *requestOptions) keepsAlive() bool {
+	return opts.KeepAlive && opts.reusesConns()
+}
+
+// poolKey identifies the connections a request to host and port may reuse:
+// those opened to the same place with the same addressing options
+func poolKey(host string, port string, opts *requestOptions) string {
+	return fmt.Sprintf("%s %s %s %s %s %s", strings.ToLower(host), port, opts.network(), opts.Interface, opts.LocalPort.String(), opts.Resolve.String())
+}
+
+// pooledConn is a connection that goes back to the idle pool when closed,
+// provided the request asked to keep it open, the response it carried was
+// read to its end and the server agreed
+type pooledConn struct {
+	net.Conn
+	raw      net.Conn
+	key      string
+	detach   func() bool
+	keep     bool // the request was sent with Connection: keep-alive
+	reusable bool
+	closed   bool
+}
+
+// openConn returns a connection for a request to host and port: an idle one
+// left by an earlier transfer when the transfer reuses connections, or else
+// a new one. It reports whether the connection was reused
+func openConn(ctx context.Context, host string, port string, opts *requestOptions, stats *transferStats) (net.Conn, bool, error) {
+	if !opts.reusesConns() {
+		conn, err := connect(ctx, host, port, opts, stats)
+		return conn, false, err
+	}
+	key := poolKey(host, port, opts)
+	raw := idleConns.take(key)
+	reused := raw != nil
+	if reused {
+		out.Printf("Reusing the connection to %s\n", net.JoinHostPort(host, port))
+		stats.reused(raw)
+	} else {
+		var err error
+		raw, _, err = dialConn(ctx, host, port, opts, stats)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	bound, detach := bindConn(ctx, raw, opts, stats)
+	return &pooledConn{Conn: bound, raw: raw, key: key, detach: detach, keep: opts.keepsAlive()}, reused, nil
+}
+
+// Close returns the connection to the pool when it can carry another
+// request, and closes it otherwise
+func (c *pooledConn) Close() error {
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	// A connection whose transfer context already ended has had its deadline
+	// cut short, and may still have it cut, so it is not kept
+	if c.keep && c.reusable && c.detach() {
+		if err := c.raw.SetDeadline(time.Time{}); err == nil {
+			idleConns.put(c.key, c.raw)
+			return nil
+		}
+	}
+	return c.Conn.Close()
+}
+
+// track returns body wrapped so that reading it to its end marks the
+// connection reusable, when the response is framed and the server keeps the
+// connection open. Anything left unread leaves the connection to be closed
+func (c *pooledConn) track(resp *httpResponse, body io.Reader, reader *bufio.Reader) io.Reader {
+	if !persistent(resp) {
+		return body
+	}
+	switch body.(type) {
+	case *strings.Reader:
+		// No body follows the head
+		c.reusable = reader.Buffered() == 0
+		return body
+	case closeDelimitedReader:
+		return body
+	}
+	return &completionReader{r: body, done: func() {
+		c.reusable = reader.Buffered() == 0
+	}}
+}
+
+// persistent reports whether the server keeps the connection open after the
+// response: HTTP/1.1 unless it says Connection: close, HTTP/1.0 only when it
+// says keep-alive
+func persistent(resp *httpResponse) bool {
+	connection := strings.ToLower(resp.header("Connection"))
+	switch resp.Proto {
+	case "HTTP/1.1":
+		return !strings.Contains(connection, "close")
+	case "HTTP/1.0":
+		return strings.Contains(connection, "keep-alive")
+	}
+	return false
+}
+
+// completionReader calls done once the underlying reader reaches a clean EOF
+type completionReader struct {
+	r    io.Reader
+	done func()
+}
+
+// Read reads from the underlying reader, calling done at its end
+func (c *completionReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if err == io.EOF && c.done != nil {
+		c.done()
+		c.done = nil
+	}
+	return n, err
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPersistent(t *testing.T) {
+	tests := []struct {
+		proto      string
+		connection string
+		want       bool
+	}{
+		{"HTTP/1.1", "", true},
+		{"HTTP/1.1", "keep-alive", true},
+		{"HTTP/1.1", "Close", false},
+		{"HTTP/1.0", "", false},
+		{"HTTP/1.0", "Keep-Alive", true},
+		{"HTTP/0.9", "", false},
+	}
+
+	for _, tt := range tests {
+		resp := &httpResponse{Proto: tt.proto}
+		if tt.connection != "" {
+			resp.Headers = []headerField{{Name: "Connection", Value: tt.connection}}
+		}
+		if got := persistent(resp); got != tt.want {
+			t.Errorf("persistent(%s, Connection: %q) = %v, want %v", tt.proto, tt.connection, got, tt.want)
+		}
+	}
+}
+
+func TestPooledConnTrack(t *testing.T) {
+	keepAlive := &httpResponse{Proto: "HTTP/1.1"}
+	closing := &httpResponse{Proto: "HTTP/1.1", Headers: []headerField{{Name: "Connection", Value: "close"}}}
+
+	tests := []struct {
+		name   string
+		resp   *httpResponse
+		body   func(reader *bufio.Reader) io.Reader
+		wire   string
+		readTo bool
+		want   bool
+	}{
+		{
+			name: "no body",
+			resp: keepAlive,
+			body: func(*bufio.Reader) io.Reader { return strings.NewReader("") },
+			want: true,
+		},
+		{
+			name:   "framed body read to the end",
+			resp:   keepAlive,
+			body:   func(reader *bufio.Reader) io.Reader { return io.LimitReader(reader, 5) },
+			wire:   "hello",
+			readTo: true,
+			want:   true,
+		},
+		{
+			name: "framed body left unread",
+			resp: keepAlive,
+			body: func(reader *bufio.Reader) io.Reader { return io.LimitReader(reader, 5) },
+			wire: "hello",
+		},
+		{
+			name:   "bytes after the body",
+			resp:   keepAlive,
+			body:   func(reader *bufio.Reader) io.Reader { return io.LimitReader(reader, 5) },
+			wire:   "helloEXTRA",
+			readTo: true,
+		},
+		{
+			name:   "close-delimited body",
+			resp:   keepAlive,
+			body:   func(reader *bufio.Reader) io.Reader { return closeDelimitedReader{reader} },
+			wire:   "hello",
+			readTo: true,
+		},
+		{
+			name:   "server closes",
+			resp:   closing,
+			body:   func(reader *bufio.Reader) io.Reader { return io.LimitReader(reader, 5) },
+			wire:   "hello",
+			readTo: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := bufio.NewReader(strings.NewReader(tt.wire))
+			reader.Peek(len(tt.wire))
+			conn := &pooledConn{}
+			body := conn.track(tt.resp, tt.body(reader), reader)
+			if tt.readTo {
+				if _, err := io.ReadAll(body); err != nil {
+					t.Fatalf("reading the body: %v", err)
+				}
+			}
+			if conn.reusable != tt.want {
+				t.Errorf("reusable = %v, want %v", conn.reusable, tt.want)
+			}
+		})
+	}
+}
+
+func TestConnPool(t *testing.T) {
+	pool := &connPool{}
+	a, b := net.Pipe()
+	defer b.Close()
+
+	if got := pool.take("k"); got != nil {
+		t.Fatalf("take from an empty pool = %v, want nil", got)
+	}
+	pool.put("k", a)
+	if got := pool.take("other"); got != nil {
+		t.Errorf("take(other) = %v, want nil", got)
+	}
+	if got := pool.take("k"); got != a {
+		t.Errorf("take(k) = %v, want the conn put", got)
+	}
+	if got := pool.take("k"); got != nil {
+		t.Errorf("second take(k) = %v, want nil", got)
+	}
+
+	pool.put("k", a)
+	pool.closeAll()
+	if got := pool.take("k"); got != nil {
+		t.Errorf("take after closeAll = %v, want nil", got)
+	}
+	if _, err := a.Write([]byte("x")); err == nil {
+		t.Error("write after closeAll succeeded, want the conn closed")
+	}
+}
+
+func TestConnectionReuse(t *testing.T) {
+	tests := []struct {
+		name       string
+		close      bool
+		wantConns  int
+		wantHeader []string
+	}{
+		{name: "kept alive", wantConns: 1, wantHeader: []string{"keep-alive", "keep-alive", "close"}},
+		{name: "server closes", close: true, wantConns: 3, wantHeader: []string{"keep-alive", "keep-alive", "close"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(t, func(w http.ResponseWriter, r *http.Request, body string) {
+				if tt.close {
+					w.Header().Set("Connection", "close")
+				}
+				w.Write([]byte(r.URL.Path))
+			})
+			result := runCLI(t, "", "-s", "-S", server.URL+"/a", server.URL+"/b", server.URL+"/c")
+			if result.code != 0 {
+				t.Fatalf("exit status %d, stderr:\n%s", result.code, result.stderr)
+			}
+			if result.stdout != "/a/b/c" {
+				t.Errorf("stdout = %q, want /a/b/c", result.stdout)
+			}
+			var got []string
+			for _, r := range server.received() {
+				got = append(got, r.Header.Get("Connection"))
+			}
+			if !slices.Equal(got, tt.wantHeader) {
+				t.Errorf("Connection headers = %q, want %q", got, tt.wantHeader)
+			}
+			if conns := server.connections(); conns != tt.wantConns {
+				t.Errorf("%d connections, want %d", conns, tt.wantConns)
+			}
+		})
+	}
+}
+
+func TestPooledConnCloseKeepsOnlyKeptAlive(t *testing.T) {
+	for _, keep := range []bool{true, false} {
+		pool := idleConns
+		idleConns = &connPool{}
+		a, b := net.Pipe()
+		conn := &pooledConn{Conn: a, raw: a, key: "k", detach: func() bool { return true }, keep: keep, reusable: true}
+		conn.Close()
+		if got := idleConns.take("k") != nil; got != keep {
+			t.Errorf("with keep %v, pooled = %v", keep, got)
+		}
+		idleConns = pool
+		a.Close()
+		b.Close()
+	}
+}
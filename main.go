@@ -2,12 +2,17 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"crypto/sha256"
 	"flag"
 	"fmt"
+	"io"
 	"net"
 	"net/url"
 	"os"
+	"slices"
 	"strings"
+	"time"
 )
 
 // urlOptions holds the parsed components of a URL
@@ -18,15 +23,30 @@ type urlOptions struct {
 	Path     string
 	Query    string
 	Fragment string
+	User     *url.Userinfo
 }
 
 // parseURL parses the input URL string and returns its components
 func parseURL(urlstr string) (urlOptions, error) {
+	// A line break would end the request line early and let the rest of the
+	// URL pass for headers of its own
+	if strings.ContainsAny(urlstr, "\r\n") {
+		return urlOptions{}, fmt.Errorf("%q contains a line break", urlstr)
+	}
 	parsedURL, err := url.Parse(urlstr)
 	if err != nil {
 		return urlOptions{}, err
 	}
 
+	if parsedURL.Host == "" {
+		return urlOptions{}, fmt.Errorf("no host in %q", urlstr)
+	}
+
+	host, err := idnToASCII(parsedURL.Hostname())
+	if err != nil {
+		return urlOptions{}, err
+	}
+
 	port := parsedURL.Port()
 	if port == "" {
 		if parsedURL.Scheme == "http" {
@@ -36,23 +56,38 @@ func parseURL(urlstr string) (urlOptions, error) {
 		}
 	}
 
-	path := parsedURL.Path
-	if path == "" {
-		path = "/"
-	}
-	if parsedURL.RawQuery != "" {
-		path += "?" + parsedURL.RawQuery
-	}
-
 	return urlOptions{
 		Protocol: parsedURL.Scheme,
-		Host:     strings.Split(parsedURL.Host, ":")[0],
+		Host:     host,
 		Port:     port,
-		Path:     path,
+		Path:     requestTarget(parsedURL),
 		Fragment: parsedURL.Fragment,
+		User:     parsedURL.User,
 	}, nil
 }
 
+// withDefaultScheme prefixes a URL given without a scheme, like example.com/path,
+// with the default one, as curl does
+func withDefaultScheme(rawURL string, scheme string) string {
+	if strings.Contains(rawURL, "://") {
+		return rawURL
+	}
+	return strings.ToLower(scheme) + "://" + rawURL
+}
+
+// hostHeader returns the Host header value for the URL: the host name, with
+// the port when it is not the default one of the scheme. IPv6 literals are
+// put back in brackets
+func (u urlOptions) hostHeader() string {
+	if (u.Protocol == "http" && u.Port == "80") || (u.Protocol == "https" && u.Port == "443") {
+		if strings.Contains(u.Host, ":") {
+			return "[" + u.Host + "]"
+		}
+		return u.Host
+	}
+	return net.JoinHostPort(u.Host, u.Port)
+}
+
 // headerList is a custom flag type to allow multiple -H flags
 type headerList []string
 
@@ -69,82 +104,441 @@ func (h *headerList) Set(value string) error {
 
 // requestOptions holds all the configurations for the HTTP request
 type requestOptions struct {
-	Method  string
-	Data    string
-	Headers headerList
-	URL     string
+	Method       string
+	Head         bool
+	Get          bool // send the data as query parameters instead of a body
+	URLQueries   queryList
+	Query        string // query parameters appended to every URL, from -G data and --url-query
+	DataArgs     dataList
+	Data         string // the payload resolved from DataArgs
+	FormArgs     formList
+	FormBoundary string
+	FormOrder    string // field names sent first, comma-separated
+	GraphQL      string
+	GraphQLVars  varList
+	BodyTemplate string
+	TemplateVars varList
+	UploadFile   string
+	Upload       uploadBody // a body streamed when sent, used instead of Data
+	Headers      headerList
+	ProtoDefault string
+	GlobOff      bool
+	PathAsIs     bool // send /./ and /../ in the path unresolved
+	UserAgent    string
+	Referer      string
+	URL          string
+	URLs         []string // every URL of the command line, URL being the one fetched
+	Sources      *sourcePool
+	Resume       *resumePoint // set by retries continuing a partial download
+	UploadOffset int64        // set by retries continuing a partial -T upload
+	KeepAlive    bool         // more transfers follow, so connections are kept open for them
+	AllowHTTPS   bool         // a helper exchange, such as a DoH query, that may go over TLS
+
+	Output           string
+	RemoteName       bool
+	RemoteHeaderName bool
+	OutputDir        string
+	CreateDirs       bool
+	RemoveOnError    bool
+	TryPorts         portList
+	IPv4             bool // resolve and connect over IPv4 only
+	IPv6             bool // resolve and connect over IPv6 only
+	Interface        string
+	LocalPort        portRange
+	Resolve          resolveList
+	DNSServers       dnsServerList
+	DoHURL           string
+	DNSCacheTimeout  float64
+
+	Silent    bool
+	ShowError bool
+	NoBuffer  bool
+
+	Exports    exportList
+	ExportFile string
+	Filters    filterChain
+	NoColor    bool
+	Pretty     bool
+
+	Grep         grepPattern
+	GrepContext  int
+	RequireMatch bool
+
+	ExpandInput     bool
+	ContentEncoding string
+	DataType        string // the media type sniffed from a -d @file payload
+	WriteOut        string
+
+	Location  bool
+	MaxRedirs int
+	TTFBProbe bool
+
+	MaxTime        float64
+	ConnectTimeout float64
+	MaxBuffer      byteSize
+	InterruptGrace float64
+
+	Deterministic bool
+
+	Retry            int
+	RetryDelay       float64
+	RetryMaxTime     float64
+	RetryConnRefused bool
+	RetryAllErrors   bool
+	ResumeUpload     bool
+
+	SpeedLimit byteSize
+	SpeedTime  int
+	LimitRate  byteSize
+
+	IfMatch string
+
+	Expect100Timeout float64
+	VerboseSize      bool
+	Machine          bool
+
+	HalfClose bool
+	Linger    int
+
+	ReadTimeout float64
+
+	User        string
+	Digest      bool
+	NTLM        bool
+	AnyAuth     bool
+	BearerToken string
+	AWSSigV4    string
+	HMACSign    hmacSpec
+
+	OAuth2TokenURL     string
+	OAuth2ClientID     string
+	OAuth2ClientSecret string
+	OAuth2Scope        string
+
+	Netrc        bool
+	NetrcFile    string
+	NetrcEntries []netrcEntry
+
+	HostDB    bool
+	HostPrefs *hostPrefs
+
+	Cookies       headerList
+	CookieJar     *cookieJar
+	CookieJarPath string
+
+	JunkSessionCookies bool
+	CookieDebug        bool
 }
 
-// parseFlags parses and validates the command-line flags and arguments
-func parseFlags() (requestOptions, error) {
-	var opts requestOptions
+// parseFlags parses and validates the flags and arguments of one request
+// set of the command line
+func parseFlags(args []string) (requestOptions, error) {
+	opts := requestOptions{Sources: &sourcePool{}}
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
 
 	// Define command-line flags
-	flag.StringVar(&opts.Method, "X", "GET", "HTTP method")
-	flag.StringVar(&opts.Data, "d", "", "HTTP payload")
-	flag.Var(&opts.Headers, "H", "HTTP header")
-	flag.Usage = func() {
-		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] <URL>\n", os.Args[0])
-		flag.PrintDefaults()
+	fs.StringVar(&opts.Method, "X", "GET", "HTTP method")
+	fs.StringVar(&opts.Method, "request", "GET", "HTTP method")
+	fs.BoolVar(&opts.Head, "I", false, "Fetch the headers only, with a HEAD request")
+	fs.BoolVar(&opts.Head, "head", false, "Fetch the headers only, with a HEAD request")
+	fs.BoolVar(&opts.Get, "G", false, "Send the -d and --data-urlencode data as URL query parameters with GET")
+	fs.BoolVar(&opts.Get, "get", false, "Send the -d and --data-urlencode data as URL query parameters with GET")
+	fs.Var(&opts.URLQueries, "url-query", "Add a URL query parameter, encoded like --data-urlencode `content`; a + prefix adds it as-is")
+	fs.Var(dataFlag{&opts.DataArgs, dataPlain}, "d", "HTTP payload; repeat to join several with &")
+	fs.Var(dataFlag{&opts.DataArgs, dataPlain}, "data", "HTTP payload; repeat to join several with &")
+	fs.StringVar(&opts.UploadFile, "T", "", "Upload this `file` as the request body with PUT; \"-\" streams stdin")
+	fs.StringVar(&opts.UploadFile, "upload-file", "", "Upload this `file` as the request body with PUT; \"-\" streams stdin")
+	fs.Var(formFlag{&opts.FormArgs, formField}, "F", "Multipart form field: name=content, name=@file or name=<file, with optional ;type=, ;filename= and ;headers=")
+	fs.Var(formFlag{&opts.FormArgs, formField}, "form", "Multipart form field: name=content, name=@file or name=<file, with optional ;type=, ;filename= and ;headers=")
+	fs.Var(formFlag{&opts.FormArgs, formLiteral}, "form-string", "Multipart form field `name=content` taken literally")
+	fs.Var(formFlag{&opts.FormArgs, formRaw}, "form-raw-part", "Add a multipart part read byte for byte, headers included, from `file`")
+	fs.StringVar(&opts.FormBoundary, "form-boundary", "", "Use this `boundary` for the multipart body instead of a random one")
+	fs.StringVar(&opts.FormOrder, "form-order", "", "Send the multipart fields with these comma-separated `names` first, in this order")
+	fs.Var(dataFlag{&opts.DataArgs, dataBinary}, "data-binary", "HTTP payload sent exactly as given; @file is read without stripping newlines")
+	fs.Var(dataFlag{&opts.DataArgs, dataRaw}, "data-raw", "HTTP payload taken literally, even when it starts with @")
+	fs.Var(dataFlag{&opts.DataArgs, dataJSON}, "json", "Send JSON `data` (or @file) with POST, setting Content-Type and Accept to application/json")
+	fs.StringVar(&opts.GraphQL, "graphql", "", "Send a GraphQL `query` (or @file) as a JSON POST")
+	fs.Var(&opts.GraphQLVars, "graphql-var", "GraphQL variable as key=value, or key:=json for numbers, booleans and objects")
+	fs.StringVar(&opts.BodyTemplate, "body-template", "", "Render this Go text/template `file` into the request body, using --var values and environment variables")
+	fs.Var(&opts.TemplateVars, "var", "Template variable as key=value for --body-template")
+	fs.Var(dataFlag{&opts.DataArgs, dataURLEncode}, "data-urlencode", "HTTP payload to URL-encode: `content`, =content, name=content, @file or name@file")
+	fs.StringVar(&opts.UserAgent, "A", "", "Send this User-Agent instead of cccurl/<version>; empty leaves the header out")
+	fs.StringVar(&opts.UserAgent, "user-agent", "", "Send this User-Agent instead of cccurl/<version>; empty leaves the header out")
+	fs.StringVar(&opts.Referer, "e", "", "Send this `URL` as the Referer header")
+	fs.StringVar(&opts.Referer, "referer", "", "Send this `URL` as the Referer header")
+	fs.BoolVar(&opts.GlobOff, "g", false, "Turn off URL globbing, so {}[] in the URL are sent as-is")
+	fs.BoolVar(&opts.GlobOff, "globoff", false, "Turn off URL globbing, so {}[] in the URL are sent as-is")
+	fs.BoolVar(&opts.PathAsIs, "path-as-is", false, "Send /./ and /../ sequences in the URL path as given instead of resolving them")
+	fs.StringVar(&opts.ProtoDefault, "proto-default", "http", "Scheme assumed for a URL given without one")
+	fs.Var(&opts.Headers, "H", "HTTP header, or @file to read one header per line from a file")
+	fs.Var(&opts.Cookies, "b", "Send cookies: a \"name=value; other=2\" `string`, or a Netscape-format cookie file to pick matching cookies from")
+	fs.Var(&opts.Cookies, "cookie", "Send cookies: a \"name=value; other=2\" `string`, or a Netscape-format cookie file to pick matching cookies from")
+	fs.StringVar(&opts.CookieJarPath, "c", "", "Write the cookies received, along with those read with -b, to this Netscape-format `file` (\"-\" for stdout)")
+	fs.StringVar(&opts.CookieJarPath, "cookie-jar", "", "Write the cookies received, along with those read with -b, to this Netscape-format `file` (\"-\" for stdout)")
+	fs.BoolVar(&opts.JunkSessionCookies, "j", false, "Discard session cookies read from -b files")
+	fs.BoolVar(&opts.JunkSessionCookies, "junk-session-cookies", false, "Discard session cookies read from -b files")
+	fs.BoolVar(&opts.CookieDebug, "cookie-debug", false, "Explain which cookies are sent, held back, accepted or rejected, and why")
+	fs.StringVar(&opts.User, "u", "", "Server `user:password` for basic authentication; without a password it is prompted for")
+	fs.StringVar(&opts.User, "user", "", "Server `user:password` for basic authentication; without a password it is prompted for")
+	fs.BoolVar(&opts.Location, "L", false, "Follow redirects")
+	fs.BoolVar(&opts.Location, "location", false, "Follow redirects")
+	fs.IntVar(&opts.MaxRedirs, "max-redirs", 50, "Maximum number of redirects to follow with -L, -1 for unlimited")
+	fs.Float64Var(&opts.MaxTime, "m", 0, "Maximum time in `seconds` allowed for the whole transfer")
+	fs.Float64Var(&opts.MaxTime, "max-time", 0, "Maximum time in `seconds` allowed for the whole transfer")
+	fs.BoolVar(&opts.HostDB, "host-db", false, "Learn per-host preferences from responses and use them to tune later requests")
+	fs.Float64Var(&opts.ReadTimeout, "read-timeout", 0, "Abort when no data arrives for `seconds` while waiting on the server")
+	fs.Float64Var(&opts.ConnectTimeout, "connect-timeout", 0, "Maximum time in `seconds` allowed for name resolution and connecting")
+	fs.Float64Var(&opts.InterruptGrace, "interrupt-grace", 5, "With several URLs, let the transfer in flight run this many `seconds` after Ctrl-C before cancelling it")
+	fs.Var(&opts.MaxBuffer, "max-buffer", "Maximum `size` of a response body held in memory, e.g. 10M")
+	fs.Var(&opts.SpeedLimit, "Y", "Abort when slower than this many `bytes` per second for --speed-time")
+	fs.Var(&opts.SpeedLimit, "speed-limit", "Abort when slower than this many `bytes` per second for --speed-time")
+	fs.IntVar(&opts.SpeedTime, "y", 30, "Window in `seconds` for --speed-limit")
+	fs.IntVar(&opts.SpeedTime, "speed-time", 30, "Window in `seconds` for --speed-limit")
+	fs.Var(&opts.LimitRate, "limit-rate", "Limit upload and download `speed` to this many bytes per second, e.g. 500k")
+	fs.BoolVar(&opts.Machine, "machine", false, "Print sizes, speeds and durations in messages as raw numbers instead of human-readable units")
+	fs.BoolVar(&opts.VerboseSize, "verbose-size", false, "Print the request size, and the upload time estimated from --limit-rate, before sending")
+	fs.Float64Var(&opts.Expect100Timeout, "expect100-timeout", 1, "How many `seconds` to wait for 100 Continue before sending the body anyway")
+	fs.IntVar(&opts.Retry, "retry", 0, "Retry transient failures up to `num` times")
+	fs.Float64Var(&opts.RetryDelay, "retry-delay", 0, "Wait this many `seconds` between retries instead of backing off exponentially")
+	fs.Float64Var(&opts.RetryMaxTime, "retry-max-time", 0, "Stop retrying once this many `seconds` have passed")
+	fs.BoolVar(&opts.RetryConnRefused, "retry-connrefused", false, "With --retry, also retry when the connection is refused")
+	fs.BoolVar(&opts.RetryAllErrors, "retry-all-errors", false, "With --retry, retry on any error")
+	fs.BoolVar(&opts.ResumeUpload, "resume-upload", false, "With --retry, send only the part of a -T file the server has not stored, with Content-Range")
+	fs.BoolVar(&opts.Deterministic, "deterministic", false, "Generate byte-identical requests: stable header order and no random values")
+	fs.BoolVar(&opts.TTFBProbe, "time-to-first-byte", false, "Stop once the response headers arrive and report the time to first byte")
+	fs.StringVar(&opts.IfMatch, "if-match", "", "Send If-Match with this `etag`; \"auto\" fetches the current ETag first")
+	fs.BoolVar(&opts.ExpandInput, "expand-input", false, "Decompress gzip-compressed -d @file payloads before sending")
+	fs.Var(opts.Sources, "interface-rotate", "Comma-separated source addresses rotated across transfers")
+	fs.StringVar(&opts.Interface, "interface", "", "Bind outgoing connections to this network `interface` or source address")
+	fs.Var(&opts.Resolve, "resolve", "Connect to `host:port:address[,address...]` instead of resolving host; port may be *")
+	fs.Var(&opts.DNSServers, "dns-servers", "Resolve host names with these comma-separated DNS `servers`, as address[:port], instead of the system ones")
+	fs.StringVar(&opts.DoHURL, "doh-url", "", "Resolve host names with DNS over HTTPS queries (RFC 8484) to this `URL`")
+	fs.Float64Var(&opts.DNSCacheTimeout, "dns-cache-timeout", 60, "Keep resolved addresses for this many `seconds`; 0 disables the cache, -1 keeps them for the whole run")
+	fs.Var(&opts.LocalPort, "local-port", "Bind outgoing connections to a local port in this `range`, given as num or first-last")
+	fs.StringVar(&opts.BearerToken, "oauth2-bearer", "", "Send `token` as an OAuth 2 bearer token; @file and env:NAME read it from a file or variable")
+	fs.BoolVar(&opts.Netrc, "n", false, "Read credentials for the host from ~/.netrc")
+	fs.BoolVar(&opts.Netrc, "netrc", false, "Read credentials for the host from ~/.netrc")
+	fs.StringVar(&opts.NetrcFile, "netrc-file", "", "Read credentials for the host from this netrc `file`")
+	fs.StringVar(&opts.OAuth2TokenURL, "oauth2", "", "Fetch a bearer token from this token `URL` with the OAuth 2 client credentials grant")
+	fs.StringVar(&opts.OAuth2ClientID, "oauth2-client-id", "", "OAuth 2 client `id` for --oauth2")
+	fs.StringVar(&opts.OAuth2ClientSecret, "oauth2-client-secret", "", "OAuth 2 client `secret` for --oauth2; @file and env:NAME read it from a file or variable")
+	fs.StringVar(&opts.OAuth2Scope, "oauth2-scope", "", "Space-separated `scopes` to request with --oauth2")
+	fs.BoolVar(&opts.AnyAuth, "anyauth", false, "Probe the server and use the strongest authentication scheme it offers for -u")
+	fs.BoolVar(&opts.Digest, "digest", false, "Use HTTP Digest authentication with the -u credentials")
+	fs.BoolVar(&opts.NTLM, "ntlm", false, "Use NTLM authentication with the -u credentials, given as DOMAIN\\user")
+	fs.StringVar(&opts.AWSSigV4, "aws-sigv4", "", "Sign the request with AWS Signature Version 4 for `provider1[:provider2[:region[:service]]]`")
+	fs.Var(&opts.HMACSign, "hmac-sign", "Sign the request with an HMAC header, as `algo:key:Header: template` using {signature}")
+	fs.StringVar(&opts.Output, "o", "", "Write the response body to `file` instead of stdout")
+	fs.StringVar(&opts.Output, "output", "", "Write the response body to `file` instead of stdout")
+	fs.BoolVar(&opts.RemoteName, "O", false, "Write the response body to a file named like the remote file")
+	fs.BoolVar(&opts.RemoteName, "remote-name", false, "Write the response body to a file named like the remote file")
+	fs.BoolVar(&opts.RemoteHeaderName, "J", false, "With -O, use the file name from the Content-Disposition header")
+	fs.BoolVar(&opts.RemoteHeaderName, "remote-header-name", false, "With -O, use the file name from the Content-Disposition header")
+	fs.StringVar(&opts.OutputDir, "output-dir", "", "Directory to store files written by -o and -O")
+	fs.BoolVar(&opts.CreateDirs, "create-dirs", false, "Create missing directories for output files")
+	fs.BoolVar(&opts.RemoveOnError, "remove-on-error", false, "Delete a partially written output file when the transfer fails")
+	fs.BoolVar(&opts.HalfClose, "half-close", false, "Shut down the sending side of the connection once the request is sent")
+	fs.IntVar(&opts.Linger, "linger", -1, "Set SO_LINGER to `seconds` on the connection; 0 resets it on close instead of a normal shutdown")
+	fs.Var(&opts.TryPorts, "try-ports", "Comma-separated ports to probe in order, using the first that accepts")
+	fs.BoolVar(&opts.IPv4, "4", false, "Resolve names to IPv4 addresses only and connect over IPv4")
+	fs.BoolVar(&opts.IPv4, "ipv4", false, "Resolve names to IPv4 addresses only and connect over IPv4")
+	fs.BoolVar(&opts.IPv6, "6", false, "Resolve names to IPv6 addresses only and connect over IPv6")
+	fs.BoolVar(&opts.IPv6, "ipv6", false, "Resolve names to IPv6 addresses only and connect over IPv6")
+	fs.BoolVar(&opts.Silent, "s", false, "Silent mode: print only the response body")
+	fs.BoolVar(&opts.Silent, "silent", false, "Silent mode: print only the response body")
+	fs.BoolVar(&opts.ShowError, "S", false, "Show errors even when silent")
+	fs.BoolVar(&opts.ShowError, "show-error", false, "Show errors even when silent")
+	fs.BoolVar(&opts.NoBuffer, "N", false, "Write the response body as it arrives instead of buffering it")
+	fs.BoolVar(&opts.NoBuffer, "no-buffer", false, "Write the response body as it arrives instead of buffering it")
+	fs.StringVar(&opts.WriteOut, "w", "", "Print transfer facts after completion using a `format` with %{variable} references")
+	fs.StringVar(&opts.WriteOut, "write-out", "", "Print transfer facts after completion using a `format` with %{variable} references")
+	fs.Var(&opts.Exports, "export-env", "Print an export line for a response value, as NAME=json:.path, NAME=header:Name or NAME=status")
+	fs.StringVar(&opts.ExportFile, "export-file", "", "Write --export-env values to a dotenv `file` instead of stdout")
+	fs.BoolVar(&opts.NoColor, "no-color", false, "Disable colored output")
+	fs.BoolVar(&opts.Pretty, "pretty", false, "Indent JSON response bodies")
+	fs.Var(&opts.Grep, "grep", "Print only the body lines matching this regular `pattern`, with line numbers and a count")
+	fs.IntVar(&opts.GrepContext, "grep-context", 0, "Print `num` lines of context around each --grep match")
+	fs.BoolVar(&opts.RequireMatch, "require-match", false, "With --grep, fail when no line matches")
+	fs.Var(&opts.Filters, "filter", "Filter `pipeline` applied to the body before output, e.g. 'json|sort-keys', 'head:100', 'grep:pattern'")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [options] <URL>... [Header:value | key=value | key:=json | key@file ...] [--next [options] <URL>...]\n", os.Args[0])
+		fs.PrintDefaults()
 	}
 
 	// Parse flags
-	flag.Parse()
+	fs.Parse(args)
 
-	// Ensure that exactly one positional argument (the URL) is provided
-	if flag.NArg() != 1 {
-		flag.Usage()
-		return opts, fmt.Errorf("error: exactly one URL must be provided")
+	// Ensure that a URL is provided; more URLs and request items may follow it
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return opts, fmt.Errorf("error: at least one URL must be provided")
 	}
 
-	opts.URL = flag.Arg(0)
+	urls, items := splitPositional(fs.Args())
+	for _, rawURL := range urls {
+		opts.URLs = append(opts.URLs, withDefaultScheme(rawURL, opts.ProtoDefault))
+	}
+	opts.URL = opts.URLs[0]
+	headers, err := loadHeaderFiles(opts.Headers)
+	if err != nil {
+		return opts, err
+	}
+	opts.Headers = headers
+	// -A and -e are shorthands for headers, so -H still wins; an empty -A
+	// leaves User-Agent out
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	if (given["A"] || given["user-agent"]) && !opts.Headers.has("User-Agent") {
+		opts.Headers = append(headerList{"User-Agent: " + opts.UserAgent}, opts.Headers...)
+	}
+	if opts.Referer != "" && !opts.Headers.has("Referer") {
+		opts.Headers = append(opts.Headers, "Referer: "+opts.Referer)
+	}
 	opts.Method = strings.ToUpper(opts.Method)
+	if err := applyItems(&opts, items); err != nil {
+		return opts, err
+	}
+	if err := applyGraphQL(&opts); err != nil {
+		return opts, err
+	}
+	if err := applyBodyTemplate(&opts); err != nil {
+		return opts, err
+	}
+
+	if opts.Get && (len(opts.FormArgs) > 0 || opts.UploadFile != "" || slices.ContainsFunc(opts.DataArgs, func(arg dataArg) bool { return arg.kind == dataJSON })) {
+		return opts, fmt.Errorf("error: -G sends the data in the URL and cannot be combined with --json, -F, -T or request items")
+	}
+	dataGiven := len(opts.DataArgs) > 0 && !opts.Get
+	if err := resolveMethod(&opts, given["X"] || given["request"], dataGiven || len(opts.FormArgs) > 0); err != nil {
+		return opts, err
+	}
+
+	if err := applyJSON(&opts); err != nil {
+		return opts, err
+	}
+	if len(opts.DataArgs) > 0 && len(opts.FormArgs) > 0 {
+		return opts, fmt.Errorf("error: -F builds a multipart body and cannot be combined with -d data")
+	}
+	if opts.UploadFile != "" && (len(opts.DataArgs) > 0 || len(opts.FormArgs) > 0) {
+		return opts, fmt.Errorf("error: -T sends a file as the body and cannot be combined with -d or -F")
+	}
+	if (opts.FormBoundary != "" || opts.FormOrder != "") && len(opts.FormArgs) == 0 {
+		return opts, fmt.Errorf("error: --form-boundary and --form-order need a multipart body from -F or --form-raw-part")
+	}
+	if opts.FormBoundary != "" {
+		if err := validBoundary(opts.FormBoundary); err != nil {
+			return opts, err
+		}
+	}
+	if opts.Interface != "" && len(opts.Sources.addrs) > 0 {
+		return opts, fmt.Errorf("error: --interface and --interface-rotate cannot be combined")
+	}
+	if len(opts.TryPorts) > 0 {
+		for _, rawURL := range opts.URLs {
+			if u, err := url.Parse(rawURL); err == nil && u.Port() != "" {
+				return opts, fmt.Errorf("error: --try-ports picks the port and cannot be combined with the port in %s", rawURL)
+			}
+		}
+	}
+	if scheme, _, _ := strings.Cut(strings.ToLower(opts.DoHURL), "://"); opts.DoHURL != "" && scheme != "https" && scheme != "http" {
+		return opts, fmt.Errorf("error: --doh-url must be an https:// or http:// URL")
+	}
+	if opts.DoHURL != "" && len(opts.DNSServers) > 0 {
+		return opts, fmt.Errorf("error: --doh-url and --dns-servers cannot be combined")
+	}
+	if opts.IPv4 && opts.IPv6 {
+		return opts, fmt.Errorf("error: -4 and -6 cannot be combined")
+	}
+	if opts.RemoteHeaderName && !opts.RemoteName {
+		return opts, fmt.Errorf("error: -J requires -O")
+	}
+	if opts.TTFBProbe && (opts.Output != "" || opts.RemoteName) {
+		return opts, fmt.Errorf("error: --time-to-first-byte discards the body and cannot be combined with -o or -O")
+	}
+	if len(opts.Exports) > 0 && opts.NoBuffer {
+		return opts, fmt.Errorf("error: --export-env needs the buffered body and cannot be combined with -N")
+	}
+	if len(opts.Filters) > 0 && opts.NoBuffer {
+		return opts, fmt.Errorf("error: --filter needs the buffered body and cannot be combined with -N")
+	}
+	if opts.Pretty && opts.NoBuffer {
+		return opts, fmt.Errorf("error: --pretty needs the buffered body and cannot be combined with -N")
+	}
+	if opts.Grep.re != nil && (opts.Output != "" || opts.RemoteName || len(opts.Filters) > 0 || opts.Pretty || len(opts.Exports) > 0) {
+		return opts, fmt.Errorf("error: --grep prints matching lines instead of the body and cannot be combined with -o, -O, --filter, --pretty or --export-env")
+	}
+	if opts.RequireMatch && opts.Grep.re == nil {
+		return opts, fmt.Errorf("error: --require-match needs --grep")
+	}
 
 	return opts, nil
 }
 
-// buildHeaders constructs the headers map, incorporating default and user-provided headers
-func buildHeaders(options urlOptions, userHeaders headerList, data string) (map[string]string, error) {
-	headersMap := make(map[string]string)
-
+// buildHeaders constructs the request headers, incorporating default and
+// user-provided headers. A user header replaces a default of the same name;
+// headers given more than once are all sent, in command-line order. Headers
+// given as "Name:" are left out, defaults included
+func buildHeaders(options urlOptions, userHeaders headerList, bodySize int64, contentType string, keepAlive bool) (headerSet, error) {
 	// Set default headers
-	headersMap["Host"] = options.Host
-	headersMap["Accept"] = "*/*"
-	headersMap["Connection"] = "close"
+	connection := "close"
+	if keepAlive {
+		connection = "keep-alive"
+	}
+	headers := headerSet{
+		{Name: "Host", Value: options.hostHeader()},
+		{Name: "User-Agent", Value: userAgent()},
+		{Name: "Accept", Value: "*/*"},
+		{Name: "Connection", Value: connection},
+	}
+	defaults := len(headers)
 
 	// Parse and add user-provided headers
+	replaced := map[string]bool{}
 	for _, header := range userHeaders {
-		parts := strings.SplitN(header, ":", 2)
-		if len(parts) != 2 {
-			return nil, fmt.Errorf("invalid header format: %s. Expected 'Key: Value'", header)
+		key, value, remove, err := parseHeaderArg(header)
+		if err != nil {
+			return nil, err
+		}
+		if remove {
+			continue
+		}
+		isDefault := slices.ContainsFunc(headers[:defaults], func(field headerField) bool { return strings.EqualFold(field.Name, key) })
+		if isDefault && !replaced[strings.ToLower(key)] {
+			replaced[strings.ToLower(key)] = true
+			headers.set(key, value)
+			continue
 		}
-		key := strings.TrimSpace(parts[0])
-		value := strings.TrimSpace(parts[1])
-		headersMap[key] = value
+		headers.add(key, value)
 	}
 
-	// If data is provided, set the Content-Length header
-	if data != "" {
-		headersMap["Content-Length"] = fmt.Sprintf("%d", len(data))
-		// If Content-Type is not set, default to application/x-www-form-urlencoded
-		if _, exists := headersMap["Content-Type"]; !exists {
-			headersMap["Content-Type"] = "application/x-www-form-urlencoded"
-		}
+	// If a body is sent, announce its length, or chunked encoding when the
+	// length is unknown
+	if bodySize > 0 {
+		headers.set("Content-Length", fmt.Sprintf("%d", bodySize))
+	} else if bodySize < 0 {
+		headers.set("Transfer-Encoding", "chunked")
+	}
+	// If Content-Type is not set, default to the one describing the body
+	if !headers.has("Content-Type") && bodySize != 0 && contentType != "" {
+		headers.add("Content-Type", contentType)
+	}
+	for _, name := range userHeaders.removed() {
+		headers.remove(name)
 	}
 
-	return headersMap, nil
+	return headers, nil
 }
 
-// constructHTTPRequest builds the full HTTP request string
-func constructHTTPRequest(method string, path string, headers map[string]string, body string) string {
+// constructHTTPRequest builds the full HTTP request string, writing headers in order
+func constructHTTPRequest(method string, path string, headers headerSet, body string) string {
 	var requestBuilder strings.Builder
 
 	// Request line
 	requestBuilder.WriteString(fmt.Sprintf("%s %s HTTP/1.1\r\n", method, path))
 
 	// Headers
-	for k, v := range headers {
-		requestBuilder.WriteString(fmt.Sprintf("%s: %s\r\n", k, v))
+	for _, field := range headers {
+		requestBuilder.WriteString(fmt.Sprintf("%s: %s\r\n", field.Name, field.Value))
 	}
 
 	// Blank line to indicate end of headers
@@ -158,70 +552,137 @@ func constructHTTPRequest(method string, path string, headers map[string]string,
 	return requestBuilder.String()
 }
 
-// sendHTTPRequest sends the HTTP request over a TCP connection and returns the response
-func sendHTTPRequest(address string, request string) (string, error) {
-	// Establish TCP connection
-	conn, err := net.Dial("tcp", address)
-	if err != nil {
-		return "", fmt.Errorf("error connecting to %s: %v", address, err)
-	}
-	defer conn.Close()
+// sendHTTPRequest sends the HTTP request head and body over an established
+// connection and reads the response head, returning a reader for the body still
+// pending on the connection. A positive expectTimeout means the request carries
+// Expect: 100-continue, so the body is held back until the server asks for it.
+// With halfClose the sending side is shut down once the request is complete
+func sendHTTPRequest(conn net.Conn, method string, head string, body io.Reader, size int64, expectTimeout time.Duration, halfClose bool, stats *transferStats) (*httpResponse, io.Reader, error) {
+	stats.PreTransfer = time.Since(stats.Start)
+	pooled, _ := conn.(*pooledConn)
+	conn = &meteredConn{Conn: conn, total: &stats.Sent}
+	metered := &meteredReader{r: conn, total: &stats.Received}
+	reader := bufio.NewReader(metered)
 
-	// Send HTTP request
-	_, err = conn.Write([]byte(request))
+	var resp *httpResponse
+	var respBody io.Reader
+	var err error
+	var sent int64
+	if body != nil {
+		resp, respBody, sent, err = uploadExchange(conn, reader, method, head, body, size, expectTimeout, halfClose)
+	} else {
+		// Send HTTP request
+		if _, err := conn.Write([]byte(head)); err != nil {
+			return nil, nil, fmt.Errorf("error sending request: %v", err)
+		}
+		if halfClose {
+			if err := closeWrite(conn); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		// Read HTTP response
+		resp, respBody, err = readResponse(reader, method)
+	}
+	stats.SizeUpload = sent
+	stats.SizeRequest = int64(len(head)) + sent
 	if err != nil {
-		return "", fmt.Errorf("error sending request: %v", err)
+		return nil, nil, err
 	}
-
-	// Read HTTP response
-	var responseBuilder strings.Builder
-	respReader := bufio.NewReader(conn)
-	for {
-		line, err := respReader.ReadString('\n')
-		if err != nil {
-			break // EOF is expected when the server closes the connection
-		}
-		responseBuilder.WriteString(line)
+	stats.StartTransfer = metered.first.Sub(stats.Start)
+	stats.SizeHeader = int64(len(resp.Head))
+	// The connection can carry another request only once this one, body
+	// included, has been sent in full
+	if pooled != nil && (body == nil || sent == size) {
+		respBody = pooled.track(resp, respBody, reader)
 	}
-
-	return responseBuilder.String(), nil
+	return resp, respBody, nil
 }
 
-func main() {
-	// Parse command-line flags and arguments
-	requestOpts, err := parseFlags()
+// sendPrepared sends a request prepared by prepareRequest together with its
+// body, opened afresh so that every request sends it from the start
+func sendPrepared(conn net.Conn, opts *requestOptions, head string, headers headerSet, stats *transferStats) (*httpResponse, io.Reader, error) {
+	body, err := openRequestBody(opts)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		return nil, nil, err
 	}
+	if body == nil {
+		return sendHTTPRequest(conn, opts.Method, head, nil, 0, expectTimeout(opts, headers), opts.HalfClose, stats)
+	}
+	defer body.Close()
+	size := requestBodySize(opts)
+	if size < 0 {
+		framed := chunkedBody(body)
+		defer framed.Close()
+		return sendHTTPRequest(conn, opts.Method, head, framed, size, expectTimeout(opts, headers), opts.HalfClose, stats)
+	}
+	return sendHTTPRequest(conn, opts.Method, head, body, size, expectTimeout(opts, headers), opts.HalfClose, stats)
+}
 
+// prepareRequest builds the request head for the target URL using the current
+// options and prints the request about to be sent. It returns the parsed URL,
+// the head and the headers it carries
+func prepareRequest(opts *requestOptions, target string) (urlOptions, string, headerSet, error) {
 	// Parse the URL
-	options, err := parseURL(requestOpts.URL)
+	options, err := parseURL(target)
 	if err != nil {
-		fmt.Printf("Error parsing URL: %v\n", err)
-		os.Exit(1)
+		return urlOptions{}, "", nil, fmt.Errorf("Error parsing URL: %v", err)
 	}
 
-	// Ensure the protocol is supported
-	if options.Protocol != "http" {
-		fmt.Println("Error: Only HTTP protocol is supported")
-		os.Exit(1)
+	// Ensure the protocol is supported; only helper exchanges speak TLS
+	if options.Protocol != "http" && (options.Protocol != "https" || !opts.AllowHTTPS) {
+		return urlOptions{}, "", nil, fmt.Errorf("Error: Only HTTP protocol is supported")
 	}
 
-	// Build headers map
-	headersMap, err := buildHeaders(options, requestOpts.Headers, requestOpts.Data)
+	// Build headers
+	headers, err := buildHeaders(options, opts.Headers, requestBodySize(opts), requestContentType(opts), opts.keepsAlive())
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		return urlOptions{}, "", nil, err
+	}
+	// Headers added below are skipped when -H removes them
+	if !opts.Headers.has("Content-Encoding") && opts.ContentEncoding != "" {
+		headers.add("Content-Encoding", opts.ContentEncoding)
+	}
+	if !opts.Headers.has("Expect") && (requestBodySize(opts) < 0 || requestBodySize(opts) >= expectContinueThreshold) {
+		headers.add("Expect", "100-continue")
+	}
+	if !opts.Headers.has("Cookie") && opts.CookieJar != nil {
+		if cookies := opts.CookieJar.header(options, time.Now()); cookies != "" {
+			headers.add("Cookie", cookies)
+		}
+	}
+	if !opts.Headers.has("Authorization") {
+		if opts.AWSSigV4 != "" {
+			// Signing covers the other headers, so it comes last
+			if err := applySigV4(opts, options, &headers); err != nil {
+				return urlOptions{}, "", nil, err
+			}
+		} else if credentials := authorizationHeader(opts, options); credentials != "" {
+			headers.add("Authorization", credentials)
+		}
+	}
+	if opts.HMACSign.Algorithm != "" {
+		bodyHash, err := payloadHash(opts, sha256.New)
+		if err != nil {
+			return urlOptions{}, "", nil, err
+		}
+		opts.HMACSign.sign(opts.Method, options.Path, &headers, bodyHash, time.Now())
+	}
+	if opts.Deterministic {
+		headers = headers.sorted()
 	}
 
 	// Display connection details and request components
-	fmt.Printf("Connecting to %s\n", options.Host)
-	fmt.Printf("Sending request %s %s HTTP/1.1\n", requestOpts.Method, options.Path)
-	for key, value := range headersMap {
-		fmt.Printf("%s: %s\n", key, value)
+	if addrs, ok := opts.Resolve.lookup(options.Host, options.Port); ok {
+		out.Printf("Connecting to %s (%s from --resolve)\n", options.Host, (&sourcePool{addrs: addrs}).String())
+	} else {
+		out.Printf("Connecting to %s\n", options.Host)
 	}
-	fmt.Println()
+	out.Printf("Sending request %s %s HTTP/1.1\n", opts.Method, options.Path)
+	for _, field := range headers {
+		out.Printf("%s: %s\n", field.Name, field.Value)
+	}
+	out.Println()
 
 	/*
 		HTTP Request Anatomy
@@ -232,17 +693,52 @@ func main() {
 		Body (optional)
 	*/
 
-	// Construct the HTTP request
-	request := constructHTTPRequest(requestOpts.Method, options.Path, headersMap, requestOpts.Data)
+	// Construct the HTTP request head; the body follows separately
+	head := constructHTTPRequest(opts.Method, options.Path, headers, "")
+	if opts.VerboseSize {
+		printSizePreview(opts, head)
+	}
+	return options, head, headers, nil
+}
+
+// doRequest sends one request to the target URL using the current options and
+// returns the response head, a reader for its body and the connection carrying it
+func doRequest(ctx context.Context, opts *requestOptions, target string, stats *transferStats) (*httpResponse, io.Reader, net.Conn, error) {
+	options, head, headers, err := prepareRequest(opts, target)
+	if err != nil {
+		return nil, nil, nil, err
+	}
 
-	// Establish TCP connection address
-	address := net.JoinHostPort(options.Host, options.Port)
+	// Establish TCP connection, or take one left open by an earlier transfer.
+	// TLS connections are never pooled
+	var conn net.Conn
+	reused := false
+	if options.Protocol == "https" {
+		conn, err = connectTLS(ctx, options.Host, options.Port, opts, stats)
+	} else {
+		conn, reused, err = openConn(ctx, options.Host, options.Port, opts, stats)
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
 
-	// Send HTTP request and receive response
-	response, err := sendHTTPRequest(address, request)
+	// Send HTTP request and receive response. The server may have closed a
+	// reused connection while it sat idle, so the request is sent again on
+	// a new one when nothing came back
+	received := stats.Received.Load()
+	response, body, err := sendPrepared(conn, opts, head, headers, stats)
+	if err != nil && reused && ctx.Err() == nil && stats.Received.Load() == received {
+		conn.Close()
+		out.Printf("Reused connection failed: %v; connecting again\n", err)
+		conn, err = connect(ctx, options.Host, options.Port, opts, stats)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		response, body, err = sendPrepared(conn, opts, head, headers, stats)
+	}
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		conn.Close()
+		return nil, nil, nil, err
 	}
 
 	/*
@@ -255,6 +751,519 @@ func main() {
 		Body
 	*/
 
-	// Print the HTTP response
-	fmt.Print(response)
+	return response, body, conn, nil
+}
+
+// fetchResponse sends a request to opts.URL and reads the complete response,
+// for helper exchanges whose body is inspected rather than written out
+func fetchResponse(ctx context.Context, opts *requestOptions) (*httpResponse, error) {
+	response, body, conn, err := doRequest(ctx, opts, opts.URL, newTransferStats())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	response.Body, err = io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading body: %v", err)
+	}
+	return response, nil
+}
+
+// helperOptions returns the options of a helper exchange to rawURL, such as
+// a DoH query, a token request or a CORS check, carrying nothing the caller
+// does not add. The defaults of the command line apply, --linger included so
+// that its sockets close normally, and it may go over TLS
+func helperOptions(method string, rawURL string) requestOptions {
+	return requestOptions{
+		Method:          method,
+		URL:             rawURL,
+		Sources:         &sourcePool{},
+		Linger:          -1,
+		DNSCacheTimeout: 60,
+		AllowHTTPS:      true,
+	}
+}
+
+// helperFor returns the options of a helper exchange made on behalf of a
+// transfer, connecting the way the transfer does: with its name resolution,
+// address family, source address, connect timeout and --linger
+func (opts *requestOptions) helperFor(method string, rawURL string) requestOptions {
+	helper := helperOptions(method, rawURL)
+	helper.Sources = opts.Sources
+	helper.IPv4, helper.IPv6 = opts.IPv4, opts.IPv6
+	helper.Interface = opts.Interface
+	helper.LocalPort = opts.LocalPort
+	helper.Resolve = opts.Resolve
+	helper.DNSServers = opts.DNSServers
+	helper.DoHURL = opts.DoHURL
+	helper.DNSCacheTimeout = opts.DNSCacheTimeout
+	helper.ConnectTimeout = opts.ConnectTimeout
+	helper.Linger = opts.Linger
+	return helper
+}
+
+// transferResult is the outcome of a completed transfer
+type transferResult struct {
+	Response *httpResponse
+	Stats    *transferStats
+	Dest     string
+}
+
+// runTransfer performs one attempt of the transfer: it sends the request,
+// following redirects when asked to, prints the response head and saves the
+// body. When retryStatus is set, a response with a transient status code is
+// returned as a statusError before anything is written
+func runTransfer(parent context.Context, opts requestOptions, retryStatus bool) (*transferResult, error) {
+	ctx, cancel := attemptContext(parent, opts)
+	defer cancel()
+
+	stats := newTransferStats()
+	if opts.Resume != nil {
+		out.Printf("Resuming %s from byte %d\n", opts.Resume.Dest, opts.Resume.Offset)
+		opts = opts.Resume.withRangeHeaders(opts)
+	}
+	if opts.UploadOffset > 0 {
+		out.Printf("Resuming the upload of %s from byte %d\n", opts.UploadFile, opts.UploadOffset)
+		opts = withUploadRange(opts)
+	}
+	if opts.SpeedLimit > 0 {
+		var stopMonitor context.CancelFunc
+		ctx, stopMonitor = monitorLowSpeed(ctx, opts, stats)
+		defer stopMonitor()
+	}
+	if opts.ReadTimeout > 0 {
+		var stopWatch context.CancelFunc
+		ctx, stopWatch = monitorIdleReads(ctx, opts, stats)
+		defer stopWatch()
+	}
+	response, body, conn, err := followRedirects(ctx, &opts, stats)
+	if err != nil {
+		return nil, transferError(ctx, err, stats)
+	}
+	defer conn.Close()
+	result := &transferResult{Response: response, Stats: stats}
+
+	if retryStatus && transientStatus(response.StatusCode) {
+		return result, &statusError{resp: response}
+	}
+	if opts.Resume != nil && !opts.Resume.continues(response) {
+		out.Printf("Server did not resume at byte %d, restarting the download\n", opts.Resume.Offset)
+		opts.Resume = nil
+	}
+
+	meteredBody := &meteredReader{r: body}
+
+	// Print the response head, then write the body to its destination.
+	// With -I the head is the output, so it is shown even in silent mode
+	head := out
+	if opts.Head {
+		head.Silent = false
+	}
+	head.printHead(response)
+
+	if opts.Head {
+		// Only the head was asked for, even when -X picked a method with a body
+	} else if opts.Grep.re != nil {
+		matches, err := grepBody(opts, meteredBody)
+		stats.SizeDownload = meteredBody.n
+		if err != nil {
+			return result, transferError(ctx, err, stats)
+		}
+		out.Printf("\n%d matching lines\n", matches)
+		if matches == 0 && opts.RequireMatch {
+			return result, fmt.Errorf("no line of the body matched %q", opts.Grep.String())
+		}
+	} else if opts.TTFBProbe {
+		// The probe ends as soon as the head has arrived; the body is never read
+		ttfb := fmt.Sprintf("%.6fs", stats.StartTransfer.Seconds())
+		if !out.Machine {
+			ttfb = fmt.Sprintf("%.2f ms", float64(stats.StartTransfer.Microseconds())/1000)
+		}
+		out.Printf("Time to first byte: %s (HTTP %d)\n", ttfb, response.StatusCode)
+	} else {
+		result.Dest, err = saveBody(opts, response, meteredBody)
+		if err != nil {
+			stats.SizeDownload = meteredBody.n
+			return result, transferError(ctx, err, stats)
+		}
+	}
+
+	stats.SizeDownload = meteredBody.n
+	stats.Total = time.Since(stats.Start)
+	return result, nil
+}
+
+func main() {
+	// Dispatch subcommands before parsing the regular request flags
+	if len(os.Args) > 1 && os.Args[1] == "cors" {
+		if err := runCORS(os.Args[2:]); err != nil {
+			out.fatal(err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "header" {
+		if err := runHeader(os.Args[2:]); err != nil {
+			out.fatal(err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "hosts" {
+		if err := runHosts(os.Args[2:]); err != nil {
+			out.fatal(err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "info" {
+		if err := runInfo(os.Args[2:]); err != nil {
+			out.fatal(err)
+		}
+		return
+	}
+
+	// Parse every request set of the command line before sending anything,
+	// so a mistake in a later one does not leave the earlier ones half done
+	var sets []requestOptions
+	for _, args := range splitNext(os.Args[1:]) {
+		requestOpts, err := parseFlags(args)
+		out = requestOpts.console()
+		if err != nil {
+			out.fatal(err)
+		}
+		sets = append(sets, requestOpts)
+	}
+
+	// A run of several transfers stops starting new ones at the first Ctrl-C
+	// and gives the one in flight the longest --interrupt-grace any set asks
+	// for; a single transfer is cancelled right away
+	batch := &batchRun{}
+	var grace float64
+	for _, requestOpts := range sets {
+		batch.planned += requestOpts.transferCount()
+		grace = max(grace, requestOpts.InterruptGrace)
+	}
+	if batch.planned < 2 {
+		grace = 0
+	}
+	launch, ctx, stop := batchInterruptContexts(seconds(grace))
+	defer stop()
+	batch.launch = launch
+
+	// Cookies set during the run are kept for the rest of it, so a login
+	// followed by redirects, or by the requests after --next, stays logged in
+	jar := &cookieJar{}
+	jarPath := ""
+	var failure error
+	for i, requestOpts := range sets {
+		if batch.stopped() {
+			break
+		}
+		out = requestOpts.console()
+		if requestOpts.CookieJarPath != "" {
+			jarPath = requestOpts.CookieJarPath
+		}
+		if err := runRequestSet(ctx, requestOpts, jar, i == len(sets)-1, batch); err != nil {
+			failure = err
+		}
+	}
+	idleConns.closeAll()
+	if batch.stopped() && batch.planned > 1 {
+		failure = batch.summary()
+		out.Errorln(failure)
+	}
+
+	if jarPath != "" {
+		// The jar is written even when a transfer failed, like curl does
+		if err := jar.save(jarPath, time.Now()); err != nil {
+			out.fatal(err)
+		}
+	}
+	if failure != nil {
+		os.Exit(exitCode(failure))
+	}
+}
+
+// console returns the console configured by the output flags of the options
+func (opts requestOptions) console() console {
+	return console{
+		Silent:    opts.Silent,
+		ShowError: opts.ShowError,
+		Color:     colorEnabled(opts.NoColor),
+		Machine:   opts.Machine,
+	}
+}
+
+// splitNext splits the command-line arguments into the request sets
+// separated by --next (or -:), each with its own options and URLs
+func splitNext(args []string) [][]string {
+	sets := [][]string{{}}
+	for _, arg := range args {
+		if arg == "--next" || arg == "-next" || arg == "-:" {
+			sets = append(sets, []string{})
+			continue
+		}
+		sets[len(sets)-1] = append(sets[len(sets)-1], arg)
+	}
+	return sets
+}
+
+// batchRun tracks the transfers of an invocation, so that an interrupted run
+// can tell how far it got
+type batchRun struct {
+	launch  context.Context // cancelled by the first Ctrl-C, after which no transfer starts
+	planned int             // transfers the command line asks for, glob matches included
+	done    int
+	failed  int
+}
+
+// stopped reports whether Ctrl-C was pressed and no further transfer may start
+func (b *batchRun) stopped() bool {
+	return b.launch.Err() != nil
+}
+
+// summary reports an interrupted run: the transfers that completed, those
+// that failed, the one cancelled in flight among them, and those never started
+func (b *batchRun) summary() error {
+	return &exitError{
+		code: exitInterrupted,
+		err: fmt.Errorf("Interrupted: %d of %d transfers completed, %d failed, %d not started",
+			b.done, b.planned, b.failed, b.planned-b.done-b.failed),
+	}
+}
+
+// transferCount returns how many transfers the URLs of the options expand
+// to. A glob that does not parse counts once, its error comes when it is used
+func (opts *requestOptions) transferCount() int {
+	count := 0
+	for _, rawURL := range opts.URLs {
+		if !opts.GlobOff {
+			if expanded, err := expandGlob(rawURL); err == nil {
+				count += len(expanded)
+				continue
+			}
+		}
+		count++
+	}
+	return count
+}
+
+// runRequestSet prepares the body and credentials of one request set and
+// fetches its URLs in order, sharing the cookie jar with the other sets. Like
+// curl, a failed URL does not stop the others, only an interrupt does; the
+// error returned is the last failure, already reported. Connections are kept
+// open for the transfers that follow, unless this is the last set
+func runRequestSet(ctx context.Context, requestOpts requestOptions, jar *cookieJar, lastSet bool, batch *batchRun) error {
+	err := prepareRequestSet(ctx, &requestOpts, jar)
+	if err != nil {
+		out.Errorln(err)
+		return err
+	}
+
+	// Expand the URL globs into the URLs to fetch, one after the other. Like
+	// curl, -o names the file of the first URL given, glob matches included,
+	// and the other URLs are written to stdout unless -O names them
+	var urls []globURL
+	for i, rawURL := range requestOpts.URLs {
+		expanded := []globURL{{URL: rawURL}}
+		if !requestOpts.GlobOff {
+			expanded, err = expandGlob(rawURL)
+			if err != nil {
+				out.Errorln(err)
+				return err
+			}
+		}
+		for j := range expanded {
+			expanded[j].first = i == 0
+		}
+		urls = append(urls, expanded...)
+	}
+	var hosts hostDB
+	if requestOpts.HostDB {
+		hosts, err = loadHostDB(hostDBPath())
+		if err != nil {
+			out.Errorln(err)
+			return err
+		}
+	}
+
+	var failure error
+	for i, target := range urls {
+		if batch.stopped() {
+			break
+		}
+		opts := requestOpts
+		opts.KeepAlive = !lastSet || i < len(urls)-1
+		opts.URL = appendQuery(target.URL, requestOpts.Query)
+		if !opts.PathAsIs {
+			opts.URL = resolveURLDots(opts.URL)
+		}
+		if opts.Output != "" && target.first {
+			opts.Output = target.outputName(opts.Output)
+		} else {
+			opts.Output = ""
+		}
+		if err := transferURL(ctx, opts, hosts); err != nil {
+			out.Errorln(err)
+			failure = err
+			batch.failed++
+		} else {
+			batch.done++
+		}
+	}
+	return failure
+}
+
+// prepareRequestSet resolves what the options of a request set refer to: the
+// payload and upload bodies, the cookies to add to the shared jar, and the
+// credentials from prompts, files and token endpoints
+func prepareRequestSet(ctx context.Context, requestOpts *requestOptions, jar *cookieJar) error {
+	// Resolve the payload, reading it from a file for -d @file, or stream
+	// it when it comes from a pipe
+	var err error
+	requestOpts.Upload, requestOpts.ContentEncoding, err = stdinStream(requestOpts)
+	if err == nil && requestOpts.Upload == nil {
+		requestOpts.Data, requestOpts.ContentEncoding, err = loadRequestData(requestOpts.DataArgs, requestOpts.ExpandInput)
+		requestOpts.DataType = dataFileType(requestOpts.DataArgs, requestOpts.Data, requestOpts.ContentEncoding)
+	}
+	if err == nil && requestOpts.Get {
+		err = applyGet(requestOpts)
+	}
+	if err == nil {
+		err = applyURLQuery(requestOpts)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Cookies read with -b join those stored so far; name=value pairs are
+	// sent by this set only
+	loaded, err := loadCookies(requestOpts.Cookies, requestOpts.JunkSessionCookies)
+	if err != nil {
+		return err
+	}
+	jar.literal = loaded.literal
+	jar.cookies = append(jar.cookies, loaded.cookies...)
+	jar.debug = requestOpts.CookieDebug
+	requestOpts.CookieJar = jar
+
+	if len(requestOpts.FormArgs) > 0 {
+		requestOpts.Upload, err = newMultipartBody(requestOpts.FormArgs, requestOpts.FormBoundary, requestOpts.FormOrder, requestOpts.Deterministic)
+		if err != nil {
+			return err
+		}
+	}
+	if requestOpts.UploadFile != "" {
+		requestOpts.Upload, err = newUpload(requestOpts.UploadFile, requestOpts)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Ask for the password when -u names only the user
+	requestOpts.User, err = completeUser(requestOpts.User)
+	if err != nil {
+		return err
+	}
+	if requestOpts.Netrc || requestOpts.NetrcFile != "" {
+		path := requestOpts.NetrcFile
+		if path == "" {
+			path = defaultNetrcPath()
+		}
+		requestOpts.NetrcEntries, err = loadNetrc(path)
+		if err != nil {
+			return err
+		}
+	}
+	if requestOpts.BearerToken != "" {
+		requestOpts.BearerToken, err = loadSecret(requestOpts.BearerToken, "bearer token")
+		if err != nil {
+			return err
+		}
+	}
+
+	// Exchange the client credentials for the bearer token of the request
+	if requestOpts.OAuth2TokenURL != "" {
+		requestOpts.BearerToken, err = oauth2Token(ctx, *requestOpts)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// transferURL fetches one URL with the options of the command line, then
+// reports on it as asked with --export-env and -w
+func transferURL(ctx context.Context, requestOpts requestOptions, hosts hostDB) error {
+	var err error
+	if requestOpts.UploadFile != "" {
+		requestOpts.URL, err = uploadURL(requestOpts.URL, requestOpts.UploadFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Settle the port first, so the request is built for the one that answers
+	if len(requestOpts.TryPorts) > 0 {
+		requestOpts.URL, err = probePorts(ctx, &requestOpts)
+		if err != nil {
+			return err
+		}
+		requestOpts.TryPorts = nil
+	}
+
+	// Credentials in the URL are sent as basic auth over plain HTTP, readable
+	// by anyone on the path, and show up in the process list
+	if target, err := parseURL(requestOpts.URL); err == nil && target.User != nil {
+		out.Errorln("warning: the URL carries credentials, which are sent unencrypted over HTTP; prefer -u or --netrc")
+	}
+
+	// Turn --if-match into a conditional write, fetching the ETag first for "auto"
+	if requestOpts.IfMatch != "" {
+		header, err := ifMatchHeader(ctx, requestOpts)
+		if err != nil {
+			return err
+		}
+		requestOpts.Headers = requestOpts.Headers.with(header)
+	}
+
+	// Consult what earlier runs learned about the host
+	if hosts != nil {
+		key := hostKey(requestOpts.URL)
+		if prefs, ok := hosts[key]; ok {
+			out.Printf("Known host %s: %s\n", key, prefs)
+			requestOpts.HostPrefs = &prefs
+		}
+	}
+
+	// Perform the transfer, retrying transient failures when asked to
+	result, err := transferWithRetries(ctx, requestOpts)
+	if err != nil {
+		return err
+	}
+	response := result.Response
+
+	if hosts != nil {
+		hosts.learn(hostKey(result.Stats.URLEffective), response, result.Stats)
+		hosts.save(hostDBPath())
+	}
+
+	// Export requested response values for the calling shell
+	if len(requestOpts.Exports) > 0 {
+		if err := writeExports(requestOpts.Exports, response, requestOpts.ExportFile); err != nil {
+			return err
+		}
+	}
+
+	// Report transfer facts requested with -w
+	if requestOpts.WriteOut != "" {
+		format, err := loadWriteOutFormat(requestOpts.WriteOut)
+		if err != nil {
+			return err
+		}
+		fmt.Print(expandWriteOut(format, writeOutVariables(requestOpts, response, result.Stats, result.Dest), response))
+	}
+
+	if requestOpts.IfMatch != "" && response.StatusCode == 412 {
+		return preconditionError(requestOpts)
+	}
+	return nil
 }
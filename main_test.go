@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestMain runs the program itself when a test starts the test binary as
+// cccurl, so that behaviour tests go through the real command line, exit
+// status included
+func TestMain(m *testing.M) {
+	if os.Getenv("CCCURL_TEST_MAIN") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// cliResult is what one run of the program printed and its exit status
+type cliResult struct {
+	stdout string
+	stderr string
+	code   int
+}
+
+// runCLI runs the program with args in a child process, with stdin fed from
+// a pipe unless it is empty, and returns what it printed. HOME points at a
+// fresh directory so that the user's ~/.netrc, host database and token cache
+// are left alone
+func runCLI(t *testing.T, stdin string, args ...string) cliResult {
+	t.Helper()
+	return runCLIWithEnv(t, nil, stdin, args...)
+}
+
+// runCLIWithEnv is runCLI with extra NAME=value environment variables
+func runCLIWithEnv(t *testing.T, env []string, stdin string, args ...string) cliResult {
+	t.Helper()
+	home := t.TempDir()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "CCCURL_TEST_MAIN=1", "HOME="+home, "XDG_CACHE_HOME="+home+"/.cache", "NO_COLOR=1")
+	cmd.Env = append(cmd.Env, env...)
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	result := cliResult{stdout: stdout.String(), stderr: stderr.String()}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		result.code = exitErr.ExitCode()
+	} else if err != nil {
+		t.Fatalf("running %q: %v", args, err)
+	}
+	return result
+}
+
+// recordedRequest is a request received by a testServer, body included
+type recordedRequest struct {
+	Method string
+	URL    string
+	Header http.Header
+	Body   string
+	// ContentLength is -1 for a chunked body
+	ContentLength int64
+}
+
+// testServer is a local HTTP server recording the requests it receives and
+// counting the connections they came over
+type testServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []recordedRequest
+	conns    int
+}
+
+// newTestServer starts a server answering with handler, which is given each
+// request together with its body. It is closed when the test ends
+func newTestServer(t *testing.T, handler func(w http.ResponseWriter, r *http.Request, body string)) *testServer {
+	t.Helper()
+	s := &testServer{}
+	s.Server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.mu.Lock()
+		s.requests = append(s.requests, recordedRequest{
+			Method:        r.Method,
+			URL:           r.URL.String(),
+			Header:        r.Header.Clone(),
+			Body:          string(body),
+			ContentLength: r.ContentLength,
+		})
+		s.mu.Unlock()
+		handler(w, r, string(body))
+	}))
+	s.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			s.mu.Lock()
+			s.conns++
+			s.mu.Unlock()
+		}
+	}
+	s.Start()
+	t.Cleanup(s.Close)
+	return s
+}
+
+// connections returns how many connections the server has accepted
+func (s *testServer) connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conns
+}
+
+// received returns the requests received so far
+func (s *testServer) received() []recordedRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]recordedRequest(nil), s.requests...)
+}
+
+// last returns the latest request received, failing the test when there is none
+func (s *testServer) last(t *testing.T) recordedRequest {
+	t.Helper()
+	requests := s.received()
+	if len(requests) == 0 {
+		t.Fatal("the server received no request")
+	}
+	return requests[len(requests)-1]
+}
@@ -0,0 +1,29 @@
+package main
+
+import "fmt"
+
+// resolveMethod settles the request method from -X, -I, -T and -d the way
+// curl does: -d alone implies POST, -T implies PUT and -I alone implies HEAD.
+// Combinations that would send a malformed request are rejected with a hint
+// instead
+func resolveMethod(opts *requestOptions, methodGiven bool, dataGiven bool) error {
+	hasBody := dataGiven || opts.Data != "" || opts.UploadFile != ""
+	if opts.Head && hasBody {
+		return fmt.Errorf("error: -I fetches headers only and cannot send -d data; drop -d, or use -X POST with -d instead of -I")
+	}
+	if methodGiven {
+		if hasBody && opts.Method == "HEAD" {
+			return fmt.Errorf("error: a HEAD request cannot carry -d data; use -X POST or another method with a body")
+		}
+		return nil
+	}
+	switch {
+	case opts.Head:
+		opts.Method = "HEAD"
+	case opts.UploadFile != "":
+		opts.Method = "PUT"
+	case hasBody:
+		opts.Method = "POST"
+	}
+	return nil
+}
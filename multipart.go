@@ -0,0 +1,391 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// formKind tells the form flags apart
+type formKind int
+
+const (
+	formField   formKind = iota // -F: name=content with @file, <file and parameters
+	formLiteral                 // --form-string: no @file, <file or ;type= handling
+	formRaw                     // --form-raw-part: a file holding a whole part
+)
+
+// formArg is one -F, --form-string or --form-raw-part argument
+type formArg struct {
+	value string
+	kind  formKind
+}
+
+// formList holds the form arguments of all form flags in command-line order
+type formList []formArg
+
+// formFlag is a custom flag type appending form arguments to a shared formList
+type formFlag struct {
+	list *formList
+	kind formKind
+}
+
+// String returns the string representation of the arguments of this flag
+func (f formFlag) String() string {
+	if f.list == nil {
+		return ""
+	}
+	var values []string
+	for _, arg := range *f.list {
+		if arg.kind == f.kind {
+			values = append(values, arg.value)
+		}
+	}
+	return strings.Join(values, ", ")
+}
+
+// Set appends one argument to the formList
+func (f formFlag) Set(value string) error {
+	if f.kind != formRaw && !strings.Contains(value, "=") {
+		return fmt.Errorf("invalid form field %q: expected name=content", value)
+	}
+	*f.list = append(*f.list, formArg{value: value, kind: f.kind})
+	return nil
+}
+
+// formPart is one field of a multipart/form-data body. Its content is either
+// held in value or streamed from path when the body is sent. A raw part's
+// file holds its headers too, sent as they are after the boundary line
+type formPart struct {
+	name        string
+	value       string
+	path        string
+	size        int64
+	filename    string
+	contentType string
+	headers     []string
+	raw         bool
+}
+
+// multipartBody is a multipart/form-data request body (RFC 7578)
+type multipartBody struct {
+	boundary string
+	parts    []formPart
+}
+
+// newMultipartBody builds the form from the form arguments. File contents
+// are not read here, only their sizes so that the body can be announced with
+// a Content-Length. The boundary is the one given with --form-boundary, or a
+// fixed one with --deterministic so repeated runs send identical requests,
+// and the parts named in --form-order come first, in that order
+func newMultipartBody(args formList, boundary string, order string, deterministic bool) (*multipartBody, error) {
+	body := &multipartBody{boundary: boundary}
+	if boundary == "" && deterministic {
+		body.boundary = "------------------------cccurlformboundary"
+	} else if boundary == "" {
+		random := make([]byte, 12)
+		if _, err := rand.Read(random); err != nil {
+			return nil, fmt.Errorf("error generating form boundary: %v", err)
+		}
+		body.boundary = "------------------------" + hex.EncodeToString(random)
+	}
+	for _, arg := range args {
+		parse := parseFormArg
+		if arg.kind == formRaw {
+			parse = parseRawPart
+		}
+		part, err := parse(arg)
+		if err != nil {
+			return nil, err
+		}
+		body.parts = append(body.parts, part)
+	}
+	if order != "" {
+		if err := body.reorder(strings.Split(order, ",")); err != nil {
+			return nil, err
+		}
+	}
+	return body, nil
+}
+
+// reorder moves the parts with the given names to the front, in the order
+// of the list; the parts of one name keep their command-line order, and so
+// do the parts not listed, which follow
+func (m *multipartBody) reorder(names []string) error {
+	rank := map[string]int{}
+	for i, name := range names {
+		name = strings.TrimSpace(name)
+		if !slices.ContainsFunc(m.parts, func(part formPart) bool { return part.name == name }) {
+			return fmt.Errorf("error: --form-order names %q, which is not a form field", name)
+		}
+		if _, ok := rank[name]; !ok {
+			rank[name] = i
+		}
+	}
+	position := func(part formPart) int {
+		if i, ok := rank[part.name]; ok {
+			return i
+		}
+		return len(names)
+	}
+	slices.SortStableFunc(m.parts, func(a, b formPart) int { return position(a) - position(b) })
+	return nil
+}
+
+// validBoundary checks a --form-boundary value against RFC 2046: 1 to 70
+// characters from the allowed set, not ending with a space
+func validBoundary(boundary string) error {
+	const allowed = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ'()+_,-./:=? "
+	if len(boundary) == 0 || len(boundary) > 70 {
+		return fmt.Errorf("error: --form-boundary must be 1 to 70 characters long")
+	}
+	for _, c := range boundary {
+		if !strings.ContainsRune(allowed, c) {
+			return fmt.Errorf("error: --form-boundary may not contain %q", c)
+		}
+	}
+	if strings.HasSuffix(boundary, " ") {
+		return fmt.Errorf("error: --form-boundary may not end with a space")
+	}
+	return nil
+}
+
+// parseFormArg reads one form argument in curl's syntax: name=content sends
+// text, name=@file uploads a file and name=<file sends a file's content as
+// a text field. ";type=" sets the part's Content-Type and ";filename=" the
+// file name announced for uploads. ";headers=" adds a header line to the
+// part, or the lines of a file with ";headers=@file". A file of "-" is read
+// from stdin, which cannot be streamed twice and is therefore loaded up front
+func parseFormArg(arg formArg) (formPart, error) {
+	name, content, _ := strings.Cut(arg.value, "=")
+	part := formPart{name: name, value: content}
+	if arg.kind == formLiteral {
+		return part, nil
+	}
+
+	// Only ;type=, ;filename= and ;headers= are parameters, other semicolons
+	// are content
+	segments := strings.Split(content, ";")
+	content = segments[0]
+	for _, segment := range segments[1:] {
+		switch key, value, _ := strings.Cut(segment, "="); strings.ToLower(strings.TrimSpace(key)) {
+		case "type":
+			part.contentType = value
+		case "filename":
+			part.filename = value
+		case "headers":
+			headers, err := partHeaders(name, value)
+			if err != nil {
+				return part, err
+			}
+			part.headers = append(part.headers, headers...)
+		default:
+			content += ";" + segment
+		}
+	}
+	part.value = content
+
+	upload := strings.HasPrefix(content, "@")
+	if !upload && !strings.HasPrefix(content, "<") {
+		return part, nil
+	}
+	path := content[1:]
+	part.value = ""
+	if upload {
+		if part.filename == "" && path != "-" {
+			part.filename = filepath.Base(path)
+		}
+		if part.contentType == "" {
+			part.contentType = mime.TypeByExtension(filepath.Ext(path))
+		}
+		if part.contentType == "" {
+			part.contentType = "application/octet-stream"
+		}
+	}
+	if path == "-" {
+		raw, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return part, fmt.Errorf("error reading form field %s from stdin: %v", name, err)
+		}
+		part.value = string(raw)
+		return part, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return part, fmt.Errorf("error reading form field %s: %v", name, err)
+	}
+	if !info.Mode().IsRegular() {
+		return part, fmt.Errorf("error reading form field %s: %s is not a regular file", name, path)
+	}
+	part.path, part.size = path, info.Size()
+	return part, nil
+}
+
+// partHeaders returns the header lines a ";headers=" parameter adds to the
+// part of field name: the value itself, or the non-blank lines of the file
+// it names with @file
+func partHeaders(name string, value string) ([]string, error) {
+	lines := []string{value}
+	if path, ok := strings.CutPrefix(value, "@"); ok {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading the headers of form field %s: %v", name, err)
+		}
+		lines = nil
+		for _, line := range strings.Split(string(raw), "\n") {
+			if line = strings.TrimRight(line, "\r"); strings.TrimSpace(line) != "" {
+				lines = append(lines, line)
+			}
+		}
+	}
+	for _, line := range lines {
+		if key, _, ok := strings.Cut(line, ":"); !ok || strings.TrimSpace(key) == "" || strings.ContainsAny(line, "\r\n") {
+			return nil, fmt.Errorf("invalid header %q for form field %s: expected 'Key: Value'", line, name)
+		}
+	}
+	return lines, nil
+}
+
+// parseRawPart reads a --form-raw-part argument, a file holding a complete
+// part: its header lines, a blank line and the content, sent byte for byte.
+// The field name is taken from its Content-Disposition header, for
+// --form-order
+func parseRawPart(arg formArg) (formPart, error) {
+	part := formPart{path: arg.value, raw: true}
+	file, err := os.Open(arg.value)
+	if err != nil {
+		return part, fmt.Errorf("error reading raw form part: %v", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return part, fmt.Errorf("error reading raw form part: %v", err)
+	}
+	if !info.Mode().IsRegular() {
+		return part, fmt.Errorf("error reading raw form part: %s is not a regular file", arg.value)
+	}
+	part.size = info.Size()
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		if key, value, ok := strings.Cut(line, ":"); ok && strings.EqualFold(strings.TrimSpace(key), "Content-Disposition") {
+			if _, params, err := mime.ParseMediaType(value); err == nil {
+				part.name = params["name"]
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	return part, nil
+}
+
+// formEscape makes a name safe inside a quoted Content-Disposition parameter,
+// encoding quotes and line breaks as browsers do
+func formEscape(s string) string {
+	return strings.NewReplacer(`"`, "%22", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// partHead returns the boundary line and headers preceding a part's content.
+// A ";headers=" line replaces the generated header of the same name; a raw
+// part brings its own headers
+func (m *multipartBody) partHead(part formPart) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "--%s\r\n", m.boundary)
+	if part.raw {
+		return b.String()
+	}
+	given := func(name string) bool {
+		return slices.ContainsFunc(part.headers, func(line string) bool {
+			key, _, _ := strings.Cut(line, ":")
+			return strings.EqualFold(strings.TrimSpace(key), name)
+		})
+	}
+	if !given("Content-Disposition") {
+		fmt.Fprintf(&b, "Content-Disposition: form-data; name=\"%s\"", formEscape(part.name))
+		if part.filename != "" {
+			fmt.Fprintf(&b, "; filename=\"%s\"", formEscape(part.filename))
+		}
+		b.WriteString("\r\n")
+	}
+	if part.contentType != "" && !given("Content-Type") {
+		fmt.Fprintf(&b, "Content-Type: %s\r\n", part.contentType)
+	}
+	for _, line := range part.headers {
+		fmt.Fprintf(&b, "%s\r\n", line)
+	}
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+// closing returns the delimiter ending the body
+func (m *multipartBody) closing() string {
+	return "--" + m.boundary + "--\r\n"
+}
+
+// Size returns the length of the encoded body
+func (m *multipartBody) Size() int64 {
+	total := int64(len(m.closing()))
+	for _, part := range m.parts {
+		total += int64(len(m.partHead(part))) + int64(len(part.value)) + part.size + 2
+	}
+	return total
+}
+
+// ContentType returns the multipart media type naming the boundary
+func (m *multipartBody) ContentType() string {
+	return "multipart/form-data; boundary=" + m.boundary
+}
+
+// Open returns a reader producing the encoded body, with file parts read
+// from disk as the body is sent
+func (m *multipartBody) Open() (io.ReadCloser, error) {
+	var readers []io.Reader
+	var files multiCloser
+	for _, part := range m.parts {
+		readers = append(readers, strings.NewReader(m.partHead(part)))
+		if part.path != "" {
+			file, err := os.Open(part.path)
+			if err != nil {
+				files.Close()
+				return nil, fmt.Errorf("error reading form field %s: %v", part.name, err)
+			}
+			files = append(files, file)
+			readers = append(readers, io.LimitReader(file, part.size))
+		} else {
+			readers = append(readers, strings.NewReader(part.value))
+		}
+		readers = append(readers, strings.NewReader("\r\n"))
+	}
+	readers = append(readers, strings.NewReader(m.closing()))
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(readers...), files}, nil
+}
+
+// multiCloser closes every file of a body once it has been sent
+type multiCloser []*os.File
+
+// Close closes all files, reporting the first error
+func (c multiCloser) Close() error {
+	var first error
+	for _, file := range c {
+		if err := file.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
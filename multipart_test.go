@@ -0,0 +1,238 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestValidBoundary(t *testing.T) {
+	tests := []struct {
+		boundary string
+		wantErr  bool
+	}{
+		{boundary: "simple"},
+		{boundary: "with space inside"},
+		{boundary: "'()+_,-./:=?"},
+		{boundary: strings.Repeat("x", 70)},
+		{boundary: "", wantErr: true},
+		{boundary: strings.Repeat("x", 71), wantErr: true},
+		{boundary: "trailing ", wantErr: true},
+		{boundary: "semi;colon", wantErr: true},
+		{boundary: "quote\"", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		if err := validBoundary(tt.boundary); (err != nil) != tt.wantErr {
+			t.Errorf("validBoundary(%q) error = %v, want error %v", tt.boundary, err, tt.wantErr)
+		}
+	}
+}
+
+func TestParseFormArg(t *testing.T) {
+	dir := t.TempDir()
+	upload := filepath.Join(dir, "photo.png")
+	if err := os.WriteFile(upload, []byte("12345"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	headerFile := filepath.Join(dir, "headers.txt")
+	if err := os.WriteFile(headerFile, []byte("X-One: 1\r\n\nX-Two: 2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		arg     formArg
+		want    formPart
+		wantErr bool
+	}{
+		{
+			name: "text",
+			arg:  formArg{value: "name=a;b", kind: formField},
+			want: formPart{name: "name", value: "a;b"},
+		},
+		{
+			name: "type parameter",
+			arg:  formArg{value: "doc={\"a\": 1};type=application/json", kind: formField},
+			want: formPart{name: "doc", value: "{\"a\": 1}", contentType: "application/json"},
+		},
+		{
+			name: "literal keeps everything",
+			arg:  formArg{value: "name=@file;type=x", kind: formLiteral},
+			want: formPart{name: "name", value: "@file;type=x"},
+		},
+		{
+			name: "upload",
+			arg:  formArg{value: "img=@" + upload, kind: formField},
+			want: formPart{name: "img", path: upload, size: 5, filename: "photo.png", contentType: "image/png"},
+		},
+		{
+			name: "upload with filename and type",
+			arg:  formArg{value: "img=@" + upload + ";filename=x.bin;type=application/x-test", kind: formField},
+			want: formPart{name: "img", path: upload, size: 5, filename: "x.bin", contentType: "application/x-test"},
+		},
+		{
+			name: "file content as text",
+			arg:  formArg{value: "text=<" + upload, kind: formField},
+			want: formPart{name: "text", path: upload, size: 5},
+		},
+		{
+			name: "headers",
+			arg:  formArg{value: "a=1;headers=X-Tag: v;headers=@" + headerFile, kind: formField},
+			want: formPart{name: "a", value: "1", headers: []string{"X-Tag: v", "X-One: 1", "X-Two: 2"}},
+		},
+		{name: "malformed header", arg: formArg{value: "a=1;headers=novalue", kind: formField}, wantErr: true},
+		{name: "missing file", arg: formArg{value: "a=@" + filepath.Join(dir, "none"), kind: formField}, wantErr: true},
+		{name: "directory", arg: formArg{value: "a=<" + dir, kind: formField}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseFormArg(tt.arg)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseFormArg(%q) = %+v, want an error", tt.arg.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseFormArg(%q) error = %v", tt.arg.value, err)
+			}
+			if !slices.Equal(got.headers, tt.want.headers) {
+				t.Errorf("headers = %q, want %q", got.headers, tt.want.headers)
+			}
+			got.headers, tt.want.headers = nil, nil
+			if got.name != tt.want.name || got.value != tt.want.value || got.path != tt.want.path || got.size != tt.want.size ||
+				got.filename != tt.want.filename || got.contentType != tt.want.contentType || got.raw != tt.want.raw {
+				t.Errorf("parseFormArg(%q) = %+v, want %+v", tt.arg.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMultipartBody(t *testing.T) {
+	upload := filepath.Join(t.TempDir(), "a.txt")
+	if err := os.WriteFile(upload, []byte("file data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	args := formList{
+		{value: "name=Jo \"J\"", kind: formField},
+		{value: "file=@" + upload, kind: formField},
+	}
+	want := "--B\r\n" +
+		"Content-Disposition: form-data; name=\"name\"\r\n\r\nJo \"J\"\r\n" +
+		"--B\r\n" +
+		"Content-Disposition: form-data; name=\"file\"; filename=\"a.txt\"\r\nContent-Type: text/plain; charset=utf-8\r\n\r\nfile data\r\n" +
+		"--B--\r\n"
+
+	body, err := newMultipartBody(args, "B", "", false)
+	if err != nil {
+		t.Fatalf("newMultipartBody error = %v", err)
+	}
+	reader, err := body.Open()
+	if err != nil {
+		t.Fatalf("Open error = %v", err)
+	}
+	defer reader.Close()
+	got, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("reading the body: %v", err)
+	}
+	if string(got) != want {
+		t.Errorf("body = %q\nwant %q", got, want)
+	}
+	if body.Size() != int64(len(got)) {
+		t.Errorf("Size() = %d, want %d", body.Size(), len(got))
+	}
+	if want := "multipart/form-data; boundary=B"; body.ContentType() != want {
+		t.Errorf("ContentType() = %q, want %q", body.ContentType(), want)
+	}
+}
+
+func TestMultipartControls(t *testing.T) {
+	dir := t.TempDir()
+	upload := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(upload, []byte("file data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	raw := filepath.Join(dir, "raw.part")
+	if err := os.WriteFile(raw, []byte("Content-Disposition: form-data; name=\"rawpart\"\r\nX-Raw: yes\r\n\r\nraw data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	args := formList{
+		{value: "name=Jo \"J\"", kind: formField},
+		{value: "file=@" + upload, kind: formField},
+		{value: raw, kind: formRaw},
+		{value: "note=x;type=text/plain;headers=Content-Type: text/x-note", kind: formField},
+	}
+
+	tests := []struct {
+		name     string
+		order    string
+		want     string
+		errorMsg string
+	}{
+		{
+			name: "command-line order",
+			want: "--B\r\n" +
+				"Content-Disposition: form-data; name=\"name\"\r\n\r\nJo \"J\"\r\n" +
+				"--B\r\n" +
+				"Content-Disposition: form-data; name=\"file\"; filename=\"a.txt\"\r\nContent-Type: text/plain; charset=utf-8\r\n\r\nfile data\r\n" +
+				"--B\r\n" +
+				"Content-Disposition: form-data; name=\"rawpart\"\r\nX-Raw: yes\r\n\r\nraw data\r\n" +
+				"--B\r\n" +
+				"Content-Disposition: form-data; name=\"note\"\r\nContent-Type: text/x-note\r\n\r\nx\r\n" +
+				"--B--\r\n",
+		},
+		{
+			name:  "reordered",
+			order: "rawpart, note",
+			want: "--B\r\n" +
+				"Content-Disposition: form-data; name=\"rawpart\"\r\nX-Raw: yes\r\n\r\nraw data\r\n" +
+				"--B\r\n" +
+				"Content-Disposition: form-data; name=\"note\"\r\nContent-Type: text/x-note\r\n\r\nx\r\n" +
+				"--B\r\n" +
+				"Content-Disposition: form-data; name=\"name\"\r\n\r\nJo \"J\"\r\n" +
+				"--B\r\n" +
+				"Content-Disposition: form-data; name=\"file\"; filename=\"a.txt\"\r\nContent-Type: text/plain; charset=utf-8\r\n\r\nfile data\r\n" +
+				"--B--\r\n",
+		},
+		{name: "unknown field in order", order: "missing", errorMsg: "not a form field"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := newMultipartBody(args, "B", tt.order, false)
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("newMultipartBody error = %v, want one containing %q", err, tt.errorMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newMultipartBody error = %v", err)
+			}
+			reader, err := body.Open()
+			if err != nil {
+				t.Fatalf("Open error = %v", err)
+			}
+			defer reader.Close()
+			got, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("reading the body: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("body = %q\nwant %q", got, tt.want)
+			}
+			if body.Size() != int64(len(got)) {
+				t.Errorf("Size() = %d, want %d", body.Size(), len(got))
+			}
+			if want := "multipart/form-data; boundary=B"; body.ContentType() != want {
+				t.Errorf("ContentType() = %q, want %q", body.ContentType(), want)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// netrcEntry is one machine (or default) entry of a .netrc file
+type netrcEntry struct {
+	Machine  string // empty for the default entry
+	Login    string
+	Password string
+}
+
+// defaultNetrcPath returns ~/.netrc, or $NETRC when it is set
+func defaultNetrcPath() string {
+	if path := os.Getenv("NETRC"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".netrc"
+	}
+	return filepath.Join(home, ".netrc")
+}
+
+// loadNetrc parses a .netrc file into its entries. Macro definitions are
+// skipped, as are account tokens
+func loadNetrc(path string) ([]netrcEntry, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading netrc file: %v", err)
+	}
+
+	var entries []netrcEntry
+	var current *netrcEntry
+	lines := strings.Split(string(content), "\n")
+	for i := 0; i < len(lines); i++ {
+		fields := strings.Fields(lines[i])
+		for j := 0; j < len(fields); j++ {
+			next := func() string {
+				if j+1 < len(fields) {
+					j++
+					return fields[j]
+				}
+				return ""
+			}
+			switch fields[j] {
+			case "machine":
+				entries = append(entries, netrcEntry{Machine: next()})
+				current = &entries[len(entries)-1]
+			case "default":
+				entries = append(entries, netrcEntry{})
+				current = &entries[len(entries)-1]
+			case "login":
+				if value := next(); current != nil {
+					current.Login = value
+				}
+			case "password":
+				if value := next(); current != nil {
+					current.Password = value
+				}
+			case "account":
+				next()
+			case "macdef":
+				// A macro runs until the next empty line
+				for i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != "" {
+					i++
+				}
+				j = len(fields)
+			default:
+				if strings.HasPrefix(fields[j], "#") {
+					j = len(fields)
+				}
+			}
+		}
+	}
+	return entries, nil
+}
+
+// netrcCredentials returns the user:password pair for host, falling back to
+// the default entry, or "" when the file has none
+func netrcCredentials(entries []netrcEntry, host string) string {
+	var fallback *netrcEntry
+	for i, entry := range entries {
+		if entry.Machine == "" {
+			if fallback == nil {
+				fallback = &entries[i]
+			}
+			continue
+		}
+		if strings.EqualFold(entry.Machine, host) {
+			return entry.Login + ":" + entry.Password
+		}
+	}
+	if fallback != nil && fallback.Login != "" {
+		return fallback.Login + ":" + fallback.Password
+	}
+	return ""
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestLoadNetrc(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".netrc")
+	content := `# comment line
+machine api.example.com login alice password s3cret
+machine other.example.com
+  login bob # trailing comment
+  account ignored
+  password hunter2
+
+macdef init
+machine macro.example.com login mallory password nope
+
+default login anon password guest
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := loadNetrc(path)
+	if err != nil {
+		t.Fatalf("loadNetrc error = %v", err)
+	}
+	want := []netrcEntry{
+		{Machine: "api.example.com", Login: "alice", Password: "s3cret"},
+		{Machine: "other.example.com", Login: "bob", Password: "hunter2"},
+		{Login: "anon", Password: "guest"},
+	}
+	if !slices.Equal(entries, want) {
+		t.Errorf("loadNetrc = %+v, want %+v", entries, want)
+	}
+
+	if _, err := loadNetrc(path + ".missing"); err == nil {
+		t.Error("loadNetrc of a missing file gave no error")
+	}
+}
+
+func TestNetrcCredentials(t *testing.T) {
+	entries := []netrcEntry{
+		{Machine: "api.example.com", Login: "alice", Password: "s3cret"},
+		{Login: "anon", Password: "guest"},
+	}
+	tests := []struct {
+		host    string
+		entries []netrcEntry
+		want    string
+	}{
+		{host: "API.example.com", entries: entries, want: "alice:s3cret"},
+		{host: "elsewhere.example.com", entries: entries, want: "anon:guest"},
+		{host: "elsewhere.example.com", entries: entries[:1]},
+		{host: "api.example.com"},
+	}
+
+	for _, tt := range tests {
+		if got := netrcCredentials(tt.entries, tt.host); got != tt.want {
+			t.Errorf("netrcCredentials(%s) = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestNetrcRequest(t *testing.T) {
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request, body string) { w.Write([]byte("ok")) })
+	netrc := filepath.Join(t.TempDir(), "netrc")
+	if err := os.WriteFile(netrc, []byte("machine 127.0.0.1 login alice password s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	basic := func(userinfo string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(userinfo))
+	}
+
+	tests := []struct {
+		name string
+		env  []string
+		args []string
+		want string
+	}{
+		{name: "--netrc-file", args: []string{"--netrc-file", netrc}, want: basic("alice:s3cret")},
+		{name: "-n with $NETRC", env: []string{"NETRC=" + netrc}, args: []string{"-n"}, want: basic("alice:s3cret")},
+		{name: "-u wins", args: []string{"--netrc-file", netrc, "-u", "bob:pw"}, want: basic("bob:pw")},
+		{name: "not asked for", env: []string{"NETRC=" + netrc}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := runCLIWithEnv(t, tt.env, "", append(append([]string{"-s", "-S"}, tt.args...), server.URL+"/")...)
+			if result.code != 0 {
+				t.Fatalf("exit status %d, stderr:\n%s", result.code, result.stderr)
+			}
+			if auth := server.last(t).Header.Get("Authorization"); auth != tt.want {
+				t.Errorf("Authorization = %q, want %q", auth, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"net"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// NTLM negotiate flags used by the handshake, from MS-NLMP section 2.2.2.5
+const (
+	ntlmNegotiateUnicode         = 0x00000001
+	ntlmNegotiateOEM             = 0x00000002
+	ntlmRequestTarget            = 0x00000004
+	ntlmNegotiateNTLM            = 0x00000200
+	ntlmNegotiateAlwaysSign      = 0x00008000
+	ntlmNegotiateExtendedSession = 0x00080000
+	ntlmNegotiateTargetInfo      = 0x00800000
+	ntlmNegotiate128             = 0x20000000
+	ntlmNegotiate56              = 0x80000000
+
+	ntlmFlags = ntlmNegotiateUnicode | ntlmNegotiateOEM | ntlmRequestTarget | ntlmNegotiateNTLM |
+		ntlmNegotiateAlwaysSign | ntlmNegotiateExtendedSession | ntlmNegotiateTargetInfo |
+		ntlmNegotiate128 | ntlmNegotiate56
+)
+
+// ntlmSignature starts every NTLM message
+var ntlmSignature = []byte("NTLMSSP\x00")
+
+// md4Sum computes the MD4 digest of data as specified by RFC 1320. MD4 is
+// broken and absent from the standard library, but NTLM derives its password
+// hash from it
+func md4Sum(data []byte) [16]byte {
+	msg := append(slices.Clone(data), 0x80)
+	for len(msg)%64 != 56 {
+		msg = append(msg, 0)
+	}
+	msg = binary.LittleEndian.AppendUint64(msg, uint64(len(data))*8)
+
+	state := [4]uint32{0x67452301, 0xefcdab89, 0x98badcfe, 0x10325476}
+	rounds := []struct {
+		f      func(x, y, z uint32) uint32
+		add    uint32
+		order  [16]int
+		shifts [4]int
+	}{
+		{func(x, y, z uint32) uint32 { return x&y | ^x&z }, 0,
+			[16]int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}, [4]int{3, 7, 11, 19}},
+		{func(x, y, z uint32) uint32 { return x&y | x&z | y&z }, 0x5a827999,
+			[16]int{0, 4, 8, 12, 1, 5, 9, 13, 2, 6, 10, 14, 3, 7, 11, 15}, [4]int{3, 5, 9, 13}},
+		{func(x, y, z uint32) uint32 { return x ^ y ^ z }, 0x6ed9eba1,
+			[16]int{0, 8, 4, 12, 2, 10, 6, 14, 1, 9, 5, 13, 3, 11, 7, 15}, [4]int{3, 9, 11, 15}},
+	}
+	for block := 0; block < len(msg); block += 64 {
+		var x [16]uint32
+		for i := range x {
+			x[i] = binary.LittleEndian.Uint32(msg[block+4*i:])
+		}
+		a, b, c, d := state[0], state[1], state[2], state[3]
+		for _, round := range rounds {
+			for i, k := range round.order {
+				a = bits.RotateLeft32(a+round.f(b, c, d)+x[k]+round.add, round.shifts[i%4])
+				a, b, c, d = d, a, b, c
+			}
+		}
+		state[0] += a
+		state[1] += b
+		state[2] += c
+		state[3] += d
+	}
+
+	var sum [16]byte
+	for i, v := range state {
+		binary.LittleEndian.PutUint32(sum[4*i:], v)
+	}
+	return sum
+}
+
+// utf16LE encodes s as little-endian UTF-16, the string encoding of NTLM
+func utf16LE(s string) []byte {
+	var b []byte
+	for _, unit := range utf16.Encode([]rune(s)) {
+		b = binary.LittleEndian.AppendUint16(b, unit)
+	}
+	return b
+}
+
+// hmacMD5 computes HMAC-MD5 over the concatenated parts
+func hmacMD5(key []byte, parts ...[]byte) []byte {
+	mac := hmac.New(md5.New, key)
+	for _, part := range parts {
+		mac.Write(part)
+	}
+	return mac.Sum(nil)
+}
+
+// ntlmNegotiateMessage builds the type 1 message opening the handshake
+func ntlmNegotiateMessage() []byte {
+	msg := slices.Clone(ntlmSignature)
+	msg = binary.LittleEndian.AppendUint32(msg, 1)
+	msg = binary.LittleEndian.AppendUint32(msg, ntlmFlags)
+	// Empty domain and workstation fields
+	return append(msg, make([]byte, 16)...)
+}
+
+// ntlmChallenge holds the parts of the server's type 2 message the answer needs
+type ntlmChallenge struct {
+	flags      uint32
+	challenge  []byte
+	targetInfo []byte
+}
+
+// parseNTLMChallenge decodes the type 2 message sent in WWW-Authenticate
+func parseNTLMChallenge(resp *httpResponse) (*ntlmChallenge, error) {
+	var encoded string
+	for _, h := range resp.Headers {
+		scheme, rest, _ := strings.Cut(h.Value, " ")
+		if strings.EqualFold(h.Name, "WWW-Authenticate") && strings.EqualFold(scheme, "NTLM") && rest != "" {
+			encoded = strings.TrimSpace(rest)
+		}
+	}
+	if encoded == "" {
+		return nil, nil
+	}
+	msg, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(msg) < 32 || !bytes.Equal(msg[:8], ntlmSignature) || binary.LittleEndian.Uint32(msg[8:]) != 2 {
+		return nil, errors.New("malformed NTLM challenge from the server")
+	}
+	challenge := &ntlmChallenge{
+		flags:     binary.LittleEndian.Uint32(msg[20:]),
+		challenge: msg[24:32],
+	}
+	if len(msg) >= 48 {
+		length := int(binary.LittleEndian.Uint16(msg[40:]))
+		offset := int(binary.LittleEndian.Uint32(msg[44:]))
+		if offset+length > len(msg) {
+			return nil, errors.New("malformed NTLM challenge from the server")
+		}
+		challenge.targetInfo = msg[offset : offset+length]
+	}
+	return challenge, nil
+}
+
+// timestamp returns the server time announced in the target information
+// (MsvAvTimestamp), if any
+func (c *ntlmChallenge) timestamp() []byte {
+	info := c.targetInfo
+	for len(info) >= 4 {
+		id := binary.LittleEndian.Uint16(info)
+		length := int(binary.LittleEndian.Uint16(info[2:]))
+		if id == 0 || len(info) < 4+length {
+			break
+		}
+		if id == 7 && length == 8 {
+			return info[4:12]
+		}
+		info = info[4+length:]
+	}
+	return nil
+}
+
+// ntlmAuthenticateMessage builds the type 3 message answering the challenge
+// with NTLMv2 responses. The user may be given as DOMAIN\user
+func ntlmAuthenticateMessage(c *ntlmChallenge, credentials string, clientChallenge []byte) []byte {
+	user, password, _ := strings.Cut(credentials, ":")
+	domain := ""
+	if d, u, ok := strings.Cut(user, `\`); ok {
+		domain, user = d, u
+	}
+
+	ntHash := md4Sum(utf16LE(password))
+	responseKey := hmacMD5(ntHash[:], utf16LE(strings.ToUpper(user)+domain))
+
+	serverTime := c.timestamp()
+	timestamp := serverTime
+	if timestamp == nil {
+		// Windows FILETIME: 100-nanosecond intervals since 1601
+		filetime := uint64(time.Now().UnixNano()/100) + 116444736000000000
+		timestamp = binary.LittleEndian.AppendUint64(nil, filetime)
+	}
+	temp := []byte{1, 1, 0, 0, 0, 0, 0, 0}
+	temp = append(temp, timestamp...)
+	temp = append(temp, clientChallenge...)
+	temp = append(temp, 0, 0, 0, 0)
+	temp = append(temp, c.targetInfo...)
+	temp = append(temp, 0, 0, 0, 0)
+	ntResponse := append(hmacMD5(responseKey, c.challenge, temp), temp...)
+
+	// With a server timestamp the LMv2 response must be left zeroed
+	lmResponse := make([]byte, 24)
+	if serverTime == nil {
+		lmResponse = append(hmacMD5(responseKey, c.challenge, clientChallenge), clientChallenge...)
+	}
+
+	fields := [][]byte{lmResponse, ntResponse, utf16LE(domain), utf16LE(user), nil, nil}
+	msg := slices.Clone(ntlmSignature)
+	msg = binary.LittleEndian.AppendUint32(msg, 3)
+	offset := 8 + 4 + 8*len(fields) + 4
+	for _, field := range fields {
+		msg = binary.LittleEndian.AppendUint16(msg, uint16(len(field)))
+		msg = binary.LittleEndian.AppendUint16(msg, uint16(len(field)))
+		msg = binary.LittleEndian.AppendUint32(msg, uint32(offset))
+		offset += len(field)
+	}
+	msg = binary.LittleEndian.AppendUint32(msg, c.flags&ntlmFlags)
+	for _, field := range fields {
+		msg = append(msg, field...)
+	}
+	return msg
+}
+
+// newClientChallenge returns the 8-byte client challenge; with --deterministic
+// it is derived from the server challenge instead of being random
+func newClientChallenge(opts *requestOptions, serverChallenge []byte) []byte {
+	if opts.Deterministic {
+		sum := sha256.Sum256(serverChallenge)
+		return sum[:8]
+	}
+	b := make([]byte, 8)
+	rand.Read(b)
+	return b
+}
+
+// ntlmRequest performs the NTLM handshake. NTLM authenticates the connection
+// rather than the request, so the negotiate message, the server's challenge
+// and the final request carrying the answer all travel over one kept-alive
+// connection
+func ntlmRequest(ctx context.Context, opts *requestOptions, target string, stats *transferStats) (*httpResponse, io.Reader, net.Conn, error) {
+	options, err := parseURL(target)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("Error parsing URL: %v", err)
+	}
+	credentials := credentials(opts, options)
+	if credentials == "" {
+		return doRequest(ctx, opts, target, stats)
+	}
+
+	// The negotiate leg carries no body, the final request sends it
+	negotiate := *opts
+	negotiate.Data, negotiate.Upload, negotiate.ContentEncoding = "", nil, ""
+	negotiate.Headers = opts.Headers.
+		with("Authorization: NTLM " + base64.StdEncoding.EncodeToString(ntlmNegotiateMessage())).
+		with("Connection: keep-alive")
+	options, head, _, err := prepareRequest(&negotiate, target)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	conn, err := connect(ctx, options.Host, options.Port, opts, stats)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	resp, body, err := sendHTTPRequest(conn, negotiate.Method, head, nil, 0, 0, false, stats)
+	if err != nil {
+		conn.Close()
+		return nil, nil, nil, err
+	}
+	if resp.StatusCode != 401 {
+		return resp, body, conn, nil
+	}
+	challenge, err := parseNTLMChallenge(resp)
+	if err != nil || challenge == nil {
+		conn.Close()
+		if err == nil {
+			err = errors.New("server did not answer with an NTLM challenge")
+		}
+		return nil, nil, nil, err
+	}
+	out.printHead(resp)
+
+	// The challenge body must be consumed so the connection can carry the next request
+	if _, err := io.Copy(io.Discard, body); err != nil {
+		conn.Close()
+		return nil, nil, nil, fmt.Errorf("error reading NTLM challenge: %v", err)
+	}
+	if strings.EqualFold(resp.header("Connection"), "close") {
+		conn.Close()
+		return nil, nil, nil, errors.New("server closed the connection during the NTLM handshake")
+	}
+
+	authenticate := *opts
+	answer := ntlmAuthenticateMessage(challenge, credentials, newClientChallenge(opts, challenge.challenge))
+	authenticate.Headers = opts.Headers.with("Authorization: NTLM " + base64.StdEncoding.EncodeToString(answer))
+	_, head, headers, err := prepareRequest(&authenticate, target)
+	if err != nil {
+		conn.Close()
+		return nil, nil, nil, err
+	}
+	resp, body, err = sendPrepared(conn, &authenticate, head, headers, stats)
+	if err != nil {
+		conn.Close()
+		return nil, nil, nil, err
+	}
+	return resp, body, conn, nil
+}
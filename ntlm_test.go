@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestMD4Sum(t *testing.T) {
+	// RFC 1320 appendix A.5
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"", "31d6cfe0d16ae931b73c59d7e0c089c0"},
+		{"a", "bde52cb31de33e46245e05fbdbd6fb24"},
+		{"abc", "a448017aaf21d8525fc10ae87aa6729d"},
+		{"message digest", "d9130a8164549fe818874806e1c7014b"},
+		{"abcdefghijklmnopqrstuvwxyz", "d79e1c308aa5bbcdeea8ed63df412da9"},
+		{"ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789", "043f8582f241db351ce627e153e7f0e4"},
+		{strings.Repeat("1234567890", 8), "e33b4ddc9c38f2199c3e7b164fcc0536"},
+	}
+
+	for _, tt := range tests {
+		sum := md4Sum([]byte(tt.in))
+		if got := hex.EncodeToString(sum[:]); got != tt.want {
+			t.Errorf("md4Sum(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNTLMPasswordHashes(t *testing.T) {
+	// MS-NLMP section 4.2.2.1.2 and 4.2.4.1.1
+	ntHash := md4Sum(utf16LE("Password"))
+	if got := hex.EncodeToString(ntHash[:]); got != "a4f49c406510bdcab6824ee7c30fd852" {
+		t.Errorf("NTOWFv1 = %s, want a4f49c406510bdcab6824ee7c30fd852", got)
+	}
+	responseKey := hmacMD5(ntHash[:], utf16LE("USER"+"Domain"))
+	if got := hex.EncodeToString(responseKey); got != "0c868a403bfd7a93a3001ef22ef02e3f" {
+		t.Errorf("NTOWFv2 = %s, want 0c868a403bfd7a93a3001ef22ef02e3f", got)
+	}
+}
+
+// ntlmTestChallenge builds a type 2 message with the given server challenge
+// and target information, as a server sends it
+func ntlmTestChallenge(serverChallenge []byte, targetInfo []byte) string {
+	msg := append([]byte{}, ntlmSignature...)
+	msg = binary.LittleEndian.AppendUint32(msg, 2)
+	msg = append(msg, make([]byte, 8)...) // no target name
+	msg = binary.LittleEndian.AppendUint32(msg, ntlmFlags)
+	msg = append(msg, serverChallenge...)
+	msg = append(msg, make([]byte, 8)...) // reserved
+	msg = binary.LittleEndian.AppendUint16(msg, uint16(len(targetInfo)))
+	msg = binary.LittleEndian.AppendUint16(msg, uint16(len(targetInfo)))
+	msg = binary.LittleEndian.AppendUint32(msg, 48)
+	msg = append(msg, targetInfo...)
+	return "NTLM " + base64.StdEncoding.EncodeToString(msg)
+}
+
+// ntlmField returns the i-th security buffer of a type 3 message
+func ntlmField(msg []byte, i int) []byte {
+	header := msg[12+8*i:]
+	length := int(binary.LittleEndian.Uint16(header))
+	offset := int(binary.LittleEndian.Uint32(header[4:]))
+	return msg[offset : offset+length]
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestNTLMAuthenticateMessage(t *testing.T) {
+	// The target information of MS-NLMP section 4.2.4: domain "Domain" and
+	// server "Server"; the second variant carries a server timestamp instead
+	noTimestamp := "02000c0044006f006d00610069006e0001000c0053006500720076006500720000000000"
+	withTimestamp := "02000c0044006f006d00610069006e00070008000090d336b734c30100000000"
+
+	tests := []struct {
+		name       string
+		targetInfo string
+		lmResponse string
+		ntProof    string // "" when it depends on the current time
+	}{
+		{
+			name:       "client timestamp",
+			targetInfo: noTimestamp,
+			// MS-NLMP section 4.2.4.2.1
+			lmResponse: "86c35097ac9cec102554764a57cccc19aaaaaaaaaaaaaaaa",
+		},
+		{
+			name:       "server timestamp",
+			targetInfo: withTimestamp,
+			lmResponse: strings.Repeat("00", 24),
+			ntProof:    "cd833d911d4a3d55302808c4cf62922a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverChallenge := mustHex(t, "0123456789abcdef")
+			clientChallenge := bytes.Repeat([]byte{0xaa}, 8)
+			targetInfo := mustHex(t, tt.targetInfo)
+			resp := &httpResponse{Headers: []headerField{{Name: "WWW-Authenticate", Value: ntlmTestChallenge(serverChallenge, targetInfo)}}}
+			challenge, err := parseNTLMChallenge(resp)
+			if err != nil || challenge == nil {
+				t.Fatalf("parseNTLMChallenge() = %v, %v", challenge, err)
+			}
+			if !bytes.Equal(challenge.challenge, serverChallenge) || !bytes.Equal(challenge.targetInfo, targetInfo) {
+				t.Fatalf("parseNTLMChallenge() = %x %x, want %x %x", challenge.challenge, challenge.targetInfo, serverChallenge, targetInfo)
+			}
+
+			msg := ntlmAuthenticateMessage(challenge, `Domain\User:Password`, clientChallenge)
+			if !bytes.HasPrefix(msg, ntlmSignature) || binary.LittleEndian.Uint32(msg[8:]) != 3 {
+				t.Fatalf("message does not start as a type 3 message: %x", msg[:12])
+			}
+			if got := hex.EncodeToString(ntlmField(msg, 0)); got != tt.lmResponse {
+				t.Errorf("LMv2 response = %s, want %s", got, tt.lmResponse)
+			}
+			ntResponse := ntlmField(msg, 1)
+			if tt.ntProof != "" {
+				if got := hex.EncodeToString(ntResponse[:16]); got != tt.ntProof {
+					t.Errorf("NTProofStr = %s, want %s", got, tt.ntProof)
+				}
+			}
+			if !bytes.Contains(ntResponse[16:], targetInfo) || !bytes.Equal(ntResponse[32:40], clientChallenge) {
+				t.Errorf("NTLMv2 blob %x does not carry the client challenge and target information", ntResponse[16:])
+			}
+			if got := ntlmField(msg, 2); !bytes.Equal(got, utf16LE("Domain")) {
+				t.Errorf("domain = %x, want %x", got, utf16LE("Domain"))
+			}
+			if got := ntlmField(msg, 3); !bytes.Equal(got, utf16LE("User")) {
+				t.Errorf("user = %x, want %x", got, utf16LE("User"))
+			}
+		})
+	}
+}
+
+func TestParseNTLMChallengeErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		wantNil bool
+	}{
+		{name: "no challenge", header: "NTLM", wantNil: true},
+		{name: "other scheme", header: `Basic realm="x"`, wantNil: true},
+		{name: "not base64", header: "NTLM !!!"},
+		{name: "too short", header: "NTLM " + base64.StdEncoding.EncodeToString([]byte("NTLMSSP\x00"))},
+		{name: "wrong type", header: "NTLM " + base64.StdEncoding.EncodeToString(append([]byte("NTLMSSP\x00\x01\x00\x00\x00"), make([]byte, 40)...))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &httpResponse{Headers: []headerField{{Name: "WWW-Authenticate", Value: tt.header}}}
+			challenge, err := parseNTLMChallenge(resp)
+			if tt.wantNil {
+				if challenge != nil || err != nil {
+					t.Errorf("parseNTLMChallenge() = %v, %v, want nil, nil", challenge, err)
+				}
+				return
+			}
+			if err == nil {
+				t.Errorf("parseNTLMChallenge() = %v, want an error", challenge)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// oauth2ExpiryMargin is how long before its expiry a cached token is
+// considered stale, so it does not run out mid-request
+const oauth2ExpiryMargin = 30 * time.Second
+
+// cachedToken is an access token kept on disk between runs
+type cachedToken struct {
+	AccessToken string    `json:"access_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// oauth2CacheDir returns the directory holding cached access tokens
+func oauth2CacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "cccurl", "oauth2")
+}
+
+// oauth2CachePath returns the cache file for one token URL, client and scope
+func oauth2CachePath(opts requestOptions) string {
+	sum := sha256.Sum256([]byte(opts.OAuth2TokenURL + "\n" + opts.OAuth2ClientID + "\n" + opts.OAuth2Scope))
+	return filepath.Join(oauth2CacheDir(), hex.EncodeToString(sum[:16])+".json")
+}
+
+// readCachedToken returns the cached token when it is still valid
+func readCachedToken(path string) string {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	var token cachedToken
+	if json.Unmarshal(content, &token) != nil || time.Until(token.ExpiresAt) < oauth2ExpiryMargin {
+		return ""
+	}
+	return token.AccessToken
+}
+
+// writeCachedToken stores the token, readable only by the current user.
+// Failing to cache is not fatal, the token is simply fetched again next time
+func writeCachedToken(path string, token cachedToken) {
+	content, err := json.Marshal(token)
+	if err != nil {
+		return
+	}
+	if os.MkdirAll(filepath.Dir(path), 0700) == nil {
+		os.WriteFile(path, content, 0600)
+	}
+}
+
+// oauth2Token obtains an access token with the client credentials grant
+// (RFC 6749 section 4.4), reusing a cached one until shortly before it expires.
+// The token endpoint is usually https and is reached the way the transfer
+// connects, --resolve and --connect-timeout included
+func oauth2Token(ctx context.Context, opts requestOptions) (string, error) {
+	if opts.OAuth2ClientID == "" {
+		return "", fmt.Errorf("error: --oauth2 needs --oauth2-client-id")
+	}
+	path := oauth2CachePath(opts)
+	if token := readCachedToken(path); token != "" {
+		out.Printf("Using cached access token from %s\n\n", path)
+		return token, nil
+	}
+
+	secret, err := loadSecret(opts.OAuth2ClientSecret, "client secret")
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if opts.OAuth2Scope != "" {
+		form.Set("scope", opts.OAuth2Scope)
+	}
+
+	out.Printf("Fetching an access token from %s\n", opts.OAuth2TokenURL)
+	helper := opts.helperFor("POST", opts.OAuth2TokenURL)
+	helper.Data = form.Encode()
+	helper.User = url.QueryEscape(opts.OAuth2ClientID) + ":" + url.QueryEscape(secret)
+	helper.Headers = headerList{"Accept: application/json"}
+	resp, err := fetchResponse(ctx, &helper)
+	if err != nil {
+		return "", err
+	}
+
+	var answer struct {
+		AccessToken      string `json:"access_token"`
+		TokenType        string `json:"token_type"`
+		ExpiresIn        int64  `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.Unmarshal(resp.Body, &answer); err != nil && resp.StatusCode == 200 {
+		return "", fmt.Errorf("error reading token response: %v", err)
+	}
+	if resp.StatusCode != 200 || answer.AccessToken == "" {
+		reason := answer.Error
+		if answer.ErrorDescription != "" {
+			reason += ": " + answer.ErrorDescription
+		}
+		return "", fmt.Errorf("error fetching access token: %s returned %d %s", opts.OAuth2TokenURL, resp.StatusCode, reason)
+	}
+	out.Printf("Got a %s token expiring in %s\n\n", answer.TokenType, out.duration(time.Duration(answer.ExpiresIn)*time.Second))
+
+	// Tokens without an expiry are not cached, there is no telling when they stop working
+	if answer.ExpiresIn > 0 {
+		writeCachedToken(path, cachedToken{
+			AccessToken: answer.AccessToken,
+			ExpiresAt:   time.Now().Add(time.Duration(answer.ExpiresIn) * time.Second),
+		})
+	}
+	return answer.AccessToken, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tokenHandler answers a client credentials grant for client:secret with
+// the token tok, and any other request with invalid_client
+func tokenHandler(t *testing.T, tok string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		user, pass, _ := r.BasicAuth()
+		r.ParseForm()
+		if r.Method != "POST" || user != "client" || pass != "secret" || r.PostForm.Get("grant_type") != "client_credentials" {
+			w.WriteHeader(401)
+			w.Write([]byte(`{"error":"invalid_client","error_description":"bad credentials"}`))
+			return
+		}
+		if scope := r.PostForm.Get("scope"); scope != "read write" {
+			t.Errorf("token request scope = %q, want %q", scope, "read write")
+		}
+		w.Write([]byte(`{"access_token":"` + tok + `","token_type":"Bearer","expires_in":3600}`))
+	}
+}
+
+func TestOAuth2(t *testing.T) {
+	resource := newTestServer(t, func(w http.ResponseWriter, r *http.Request, body string) { w.Write([]byte("ok")) })
+	tokenServer := httptest.NewServer(tokenHandler(t, "plain-token"))
+	t.Cleanup(tokenServer.Close)
+	tlsTokenServer := httptest.NewTLSServer(tokenHandler(t, "tls-token"))
+	t.Cleanup(tlsTokenServer.Close)
+
+	// The child trusts the certificate of the TLS token server
+	roots := filepath.Join(t.TempDir(), "roots.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsTokenServer.Certificate().Raw})
+	if err := os.WriteFile(roots, cert, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, tokenPort, _ := net.SplitHostPort(tokenServer.Listener.Addr().String())
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantToken  string
+		wantStderr string
+	}{
+		{name: "http", args: []string{"--oauth2", tokenServer.URL + "/token"}, wantToken: "plain-token"},
+		{name: "https", args: []string{"--oauth2", tlsTokenServer.URL + "/token"}, wantToken: "tls-token"},
+		{
+			name:      "resolved like the transfer",
+			args:      []string{"--oauth2", "http://auth.invalid:" + tokenPort + "/token", "--resolve", "auth.invalid:" + tokenPort + ":127.0.0.1"},
+			wantToken: "plain-token",
+		},
+		{
+			name:       "rejected",
+			args:       []string{"--oauth2", tokenServer.URL + "/token", "--oauth2-client-secret", "wrong"},
+			wantStderr: "invalid_client: bad credentials",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"-s", "-S", "--oauth2-client-id", "client", "--oauth2-client-secret", "secret", "--oauth2-scope", "read write"}, tt.args...)
+			result := runCLIWithEnv(t, []string{"SSL_CERT_FILE=" + roots}, "", append(args, resource.URL+"/data")...)
+			if tt.wantStderr != "" {
+				if result.code == 0 || !strings.Contains(result.stderr, tt.wantStderr) {
+					t.Fatalf("exit status %d, stderr:\n%s\nwant a failure mentioning %q", result.code, result.stderr, tt.wantStderr)
+				}
+				return
+			}
+			if result.code != 0 {
+				t.Fatalf("exit status %d, stderr:\n%s", result.code, result.stderr)
+			}
+			if auth := resource.last(t).Header.Get("Authorization"); auth != "Bearer "+tt.wantToken {
+				t.Errorf("Authorization = %q, want %q", auth, "Bearer "+tt.wantToken)
+			}
+		})
+	}
+}
+
+func TestOAuth2CachePath(t *testing.T) {
+	base := requestOptions{OAuth2TokenURL: "https://auth.example/token", OAuth2ClientID: "client", OAuth2Scope: "read"}
+	other := base
+	other.OAuth2Scope = "write"
+	if oauth2CachePath(base) == oauth2CachePath(other) {
+		t.Error("tokens for different scopes share a cache file")
+	}
+	if oauth2CachePath(base) != oauth2CachePath(base) {
+		t.Error("the cache file of a token is not stable")
+	}
+}
+
+func TestCachedToken(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		expires time.Duration
+		want    string
+	}{
+		{name: "valid", expires: time.Hour, want: "tok"},
+		{name: "within the margin", expires: oauth2ExpiryMargin / 2},
+		{name: "expired", expires: -time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "cache", tt.name+".json")
+			writeCachedToken(path, cachedToken{AccessToken: "tok", ExpiresAt: time.Now().Add(tt.expires)})
+			if got := readCachedToken(path); got != tt.want {
+				t.Errorf("readCachedToken = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
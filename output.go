@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// remoteFileName derives a local file name from the last segment of the URL path
+func remoteFileName(rawURL string) (string, error) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	name := sanitizeFileName(path.Base(parsedURL.Path))
+	if name == "" {
+		return "", fmt.Errorf("remote file name has no length: %s", rawURL)
+	}
+	return name, nil
+}
+
+// contentDispositionFileName extracts the file name from a Content-Disposition header value
+func contentDispositionFileName(value string) string {
+	if value == "" {
+		return ""
+	}
+	_, params, err := mime.ParseMediaType(value)
+	if err != nil {
+		return ""
+	}
+	return sanitizeFileName(params["filename"])
+}
+
+// sanitizeFileName strips any directory components from a server- or URL-supplied
+// name so it cannot escape the current directory
+func sanitizeFileName(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	name = path.Base(name)
+	if name == "." || name == ".." || name == "/" {
+		return ""
+	}
+	return name
+}
+
+// outputPath decides where the response body should be written; an empty
+// result means standard output
+func outputPath(opts requestOptions, resp *httpResponse) (string, error) {
+	if opts.Output != "" {
+		if opts.Output == "-" {
+			return "", nil
+		}
+		return inOutputDir(opts.OutputDir, opts.Output), nil
+	}
+	if !opts.RemoteName {
+		return "", nil
+	}
+
+	if opts.RemoteHeaderName {
+		if name := contentDispositionFileName(resp.header("Content-Disposition")); name != "" {
+			name = inOutputDir(opts.OutputDir, name)
+			if _, err := os.Stat(name); err == nil {
+				return "", fmt.Errorf("refusing to overwrite %s: file exists", name)
+			}
+			return name, nil
+		}
+	}
+	name, err := remoteFileName(opts.URL)
+	if err != nil {
+		return "", err
+	}
+	return inOutputDir(opts.OutputDir, name), nil
+}
+
+// inOutputDir places a relative output name inside dir, leaving absolute paths untouched
+func inOutputDir(dir string, name string) string {
+	if dir == "" || filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(dir, name)
+}
+
+// openDestination opens the body destination, creating missing parent
+// directories when --create-dirs is set
+func openDestination(dest string, opts requestOptions) (io.WriteCloser, error) {
+	if dest == "" {
+		// An explicit "-o -" means the user accepts binary output on the terminal
+		if opts.Output != "-" && isTerminal(os.Stdout) {
+			return nopWriteCloser{&binaryGuard{w: os.Stdout}}, nil
+		}
+		return nopWriteCloser{os.Stdout}, nil
+	}
+	if opts.CreateDirs {
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return nil, fmt.Errorf("error creating output directory: %v", err)
+		}
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if opts.Resume != nil {
+		flags = os.O_WRONLY | os.O_APPEND
+	}
+	f, err := os.OpenFile(dest, flags, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("error writing output file: %v", err)
+	}
+	return f, nil
+}
+
+// nopWriteCloser wraps a writer, such as stdout, that must not be closed
+type nopWriteCloser struct {
+	io.Writer
+}
+
+// Close does nothing
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// errBinaryOutput is returned when a binary body would be written to a terminal
+var errBinaryOutput = errors.New(`Warning: Binary output can mess up your terminal. Use "--output -" to tell cccurl to output it to your terminal anyway, or consider "--output <FILE>" to save to a file.`)
+
+// binaryGuard refuses to pass on data that looks binary
+type binaryGuard struct {
+	w io.Writer
+}
+
+// Write forwards p unless it contains a NUL byte, the same heuristic curl uses
+func (g *binaryGuard) Write(p []byte) (int, error) {
+	if bytes.IndexByte(p, 0) >= 0 {
+		return 0, errBinaryOutput
+	}
+	return g.w.Write(p)
+}
+
+// renderBody applies the --filter pipeline and JSON pretty-printing to a
+// buffered body. JSON is indented on request, or automatically when an
+// unfiltered JSON body goes to a terminal
+func renderBody(opts requestOptions, resp *httpResponse, dest string) ([]byte, error) {
+	body, err := applyFilters(opts.Filters, resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	toTerminal := dest == "" && isTerminal(os.Stdout)
+	autoPretty := toTerminal && len(opts.Filters) == 0 && isJSONContentType(resp.header("Content-Type"))
+	if opts.Pretty || autoPretty {
+		body = prettyJSON(body, toTerminal && out.Color)
+	}
+	return body, nil
+}
+
+// saveBody writes the response body to its destination, buffering it first
+// when it has to be transformed, and returns the destination path. A resumed
+// download is appended to the file of the attempt it continues
+func saveBody(opts requestOptions, resp *httpResponse, body io.Reader) (string, error) {
+	if opts.Resume != nil {
+		return opts.Resume.Dest, streamBody(opts.Resume.Dest, body, opts)
+	}
+	dest, err := outputPath(opts, resp)
+	if err != nil {
+		return "", err
+	}
+	if !bufferBody(opts, dest) {
+		return dest, streamBody(dest, body, opts)
+	}
+
+	resp.Body, err = readAllLimited(body, int64(opts.MaxBuffer))
+	if err != nil {
+		// Flush whatever arrived before the failure, untransformed, unless
+		// --remove-on-error wants no partial file left behind
+		if len(resp.Body) > 0 {
+			writeBody(dest, resp.Body, opts)
+			discardPartial(dest, opts)
+		}
+		return dest, fmt.Errorf("error reading body: %v", err)
+	}
+	rendered, err := renderBody(opts, resp, dest)
+	if err != nil {
+		return dest, err
+	}
+	return dest, writeBody(dest, rendered, opts)
+}
+
+// bufferBody reports whether the body must be held in memory before output,
+// which --filter, --pretty and --export-env need. Bodies saved to files are
+// otherwise streamed to disk as they arrive
+func bufferBody(opts requestOptions, dest string) bool {
+	if opts.NoBuffer {
+		return false
+	}
+	return dest == "" || len(opts.Filters) > 0 || opts.Pretty || len(opts.Exports) > 0
+}
+
+// discardPartial deletes a partially written output file when --remove-on-error is set
+func discardPartial(dest string, opts requestOptions) {
+	if dest != "" && opts.RemoveOnError {
+		os.Remove(dest)
+	}
+}
+
+// writeBody writes a fully buffered response body to the chosen destination
+func writeBody(dest string, body []byte, opts requestOptions) error {
+	w, err := openDestination(dest, opts)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		w.Close()
+		discardPartial(dest, opts)
+		if errors.Is(err, errBinaryOutput) {
+			return err
+		}
+		return fmt.Errorf("error writing output: %v", err)
+	}
+	return w.Close()
+}
+
+// streamBody copies the body to the destination as it arrives, so each
+// chunk is written out without waiting for the transfer to finish
+func streamBody(dest string, body io.Reader, opts requestOptions) error {
+	w, err := openDestination(dest, opts)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, body); err != nil {
+		w.Close()
+		discardPartial(dest, opts)
+		if errors.Is(err, errBinaryOutput) {
+			return err
+		}
+		return fmt.Errorf("error reading body: %v", err)
+	}
+	return w.Close()
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRemoteFileName(t *testing.T) {
+	tests := []struct {
+		url     string
+		want    string
+		wantErr bool
+	}{
+		{url: "http://example.com/files/report.pdf", want: "report.pdf"},
+		{url: "http://example.com/files/report.pdf?download=1#top", want: "report.pdf"},
+		{url: "http://example.com/a%20b.txt", want: "a b.txt"},
+		{url: "http://example.com/..%2F..%2Fetc%2Fpasswd", want: "passwd"},
+		{url: "http://example.com/", wantErr: true},
+		{url: "http://example.com", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := remoteFileName(tt.url)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("remoteFileName(%q) = %q, want an error", tt.url, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("remoteFileName(%q) = %q, %v, want %q", tt.url, got, err, tt.want)
+		}
+	}
+}
+
+func TestContentDispositionFileName(t *testing.T) {
+	tests := map[string]string{
+		`attachment; filename="report.pdf"`:     "report.pdf",
+		`attachment; filename=plain.txt`:        "plain.txt",
+		`attachment; filename="../../evil.sh"`:  "evil.sh",
+		`attachment; filename="C:\\dir\\x.exe"`: "x.exe",
+		`attachment; filename=".."`:             "",
+		`attachment`:                            "",
+		`attachment; filename="unterminated`:    "",
+		``:                                      "",
+	}
+	for value, want := range tests {
+		if got := contentDispositionFileName(value); got != want {
+			t.Errorf("contentDispositionFileName(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
+
+func TestRemoteNameDownload(t *testing.T) {
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request, body string) {
+		if disposition := r.URL.Query().Get("disposition"); disposition != "" {
+			w.Header().Set("Content-Disposition", disposition)
+		}
+		w.Write([]byte("content of " + r.URL.Path))
+	})
+
+	tests := []struct {
+		name     string
+		args     []string
+		path     string
+		existing string
+		want     string
+		wantErr  string
+	}{
+		{name: "-O", args: []string{"-O"}, path: "/files/data.csv?disposition=attachment%3B+filename%3Dother.csv", want: "data.csv"},
+		{name: "-O -J", args: []string{"-O", "-J"}, path: "/files/data.csv?disposition=attachment%3B+filename%3Dother.csv", want: "other.csv"},
+		{name: "-J without a header", args: []string{"-O", "-J"}, path: "/files/data.csv", want: "data.csv"},
+		{name: "-J with a path", args: []string{"-O", "-J"}, path: "/x?disposition=attachment%3B+filename%3D%22..%2F..%2Fevil.sh%22", want: "evil.sh"},
+		{
+			name: "-J does not overwrite", args: []string{"-O", "-J"}, path: "/x?disposition=attachment%3B+filename%3Dtaken.txt",
+			existing: "taken.txt", wantErr: "refusing to overwrite",
+		},
+		{name: "-O without a file name", args: []string{"-O"}, path: "/", wantErr: "remote file name has no length"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tt.existing != "" {
+				if err := os.WriteFile(filepath.Join(dir, tt.existing), []byte("keep"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			args := append([]string{"-s", "-S", "--output-dir", dir}, tt.args...)
+			result := runCLI(t, "", append(args, server.URL+tt.path)...)
+			if tt.wantErr != "" {
+				if result.code == 0 || !strings.Contains(result.stderr, tt.wantErr) {
+					t.Errorf("exit status %d, stderr:\n%s\nwant a failure mentioning %q", result.code, result.stderr, tt.wantErr)
+				}
+				if tt.existing != "" {
+					if content, _ := os.ReadFile(filepath.Join(dir, tt.existing)); string(content) != "keep" {
+						t.Errorf("the existing file now holds %q", content)
+					}
+				}
+				return
+			}
+			if result.code != 0 {
+				t.Fatalf("exit status %d, stderr:\n%s", result.code, result.stderr)
+			}
+			entries, _ := os.ReadDir(dir)
+			if len(entries) != 1 || entries[0].Name() != tt.want {
+				t.Fatalf("the output directory holds %v, want only %s", entries, tt.want)
+			}
+			if content, _ := os.ReadFile(filepath.Join(dir, tt.want)); !strings.HasPrefix(string(content), "content of ") {
+				t.Errorf("%s holds %q", tt.want, content)
+			}
+		})
+	}
+}
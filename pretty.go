@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"strings"
+)
+
+// ANSI color for JSON literals such as true, false and null
+const ansiMagenta = "\x1b[35m"
+
+// isJSONContentType reports whether a Content-Type value denotes JSON,
+// including structured suffixes such as application/problem+json
+func isJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// prettyJSON indents a JSON body, optionally colorizing it; bodies that are
+// not valid JSON are returned unchanged
+func prettyJSON(body []byte, color bool) []byte {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, body, "", "  "); err != nil {
+		return body
+	}
+	buf.WriteByte('\n')
+	if !color {
+		return buf.Bytes()
+	}
+	return colorizeJSON(buf.Bytes())
+}
+
+// colorizeJSON styles already valid JSON: keys cyan, strings green, numbers
+// yellow and literals magenta
+func colorizeJSON(src []byte) []byte {
+	var b bytes.Buffer
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '"':
+			end := i + 1
+			for end < len(src) && src[end] != '"' {
+				if src[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			end++
+			// A string followed by a colon is an object key
+			next := end
+			for next < len(src) && (src[next] == ' ' || src[next] == '\n') {
+				next++
+			}
+			style := ansiGreen
+			if next < len(src) && src[next] == ':' {
+				style = ansiBold + ansiCyan
+			}
+			b.WriteString(style)
+			b.Write(src[i:end])
+			b.WriteString(ansiReset)
+			i = end
+		case c == '-' || (c >= '0' && c <= '9'):
+			end := i + 1
+			for end < len(src) && strings.IndexByte("0123456789.eE+-", src[end]) >= 0 {
+				end++
+			}
+			b.WriteString(ansiYellow)
+			b.Write(src[i:end])
+			b.WriteString(ansiReset)
+			i = end
+		case c == 't' || c == 'f' || c == 'n':
+			end := i + 1
+			for end < len(src) && src[end] >= 'a' && src[end] <= 'z' {
+				end++
+			}
+			b.WriteString(ansiMagenta)
+			b.Write(src[i:end])
+			b.WriteString(ansiReset)
+			i = end
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,24 @@
+package main
+
+import "time"
+
+// printSizePreview shows what the request is about to put on the wire for
+// --verbose-size: the head and body sizes and, with --limit-rate, how long
+// the upload should take at that rate
+func printSizePreview(opts *requestOptions, head string) {
+	body := requestBodySize(opts)
+	if body < 0 {
+		out.Printf("Request size: head %s, body of unknown length sent with chunked encoding\n\n", out.size(int64(len(head))))
+		return
+	}
+	total := int64(len(head)) + body
+	out.Printf("Request size: %s (head %s, body %s)\n", out.size(total), out.size(int64(len(head))), out.size(body))
+	if opts.ContentEncoding != "" {
+		out.Printf("Body encoding: %s, sent as is\n", opts.ContentEncoding)
+	}
+	if opts.LimitRate > 0 {
+		estimate := time.Duration(float64(total) / float64(opts.LimitRate) * float64(time.Second))
+		out.Printf("Estimated upload time at %s: %s\n", out.speed(int64(opts.LimitRate)), out.duration(estimate))
+	}
+	out.Println()
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	_ "embed"
+	"strings"
+	"sync"
+)
+
+// publicSuffixList is the Public Suffix List (https://publicsuffix.org/list/)
+// in its own format: one rule per line, "*." matching any label and "!"
+// marking an exception to a wildcard. Any single label is a public suffix
+// even when not listed, per the list's default rule. Update it by replacing
+// public_suffix_list.dat with the current copy from publicsuffix.org
+//
+//go:embed public_suffix_list.dat
+var publicSuffixList string
+
+// publicSuffixes holds the rules of publicSuffixList for lookups, parsed the
+// first time a cookie domain is checked. Rules written in Unicode are stored
+// in their Punycode form, the one cookie domains arrive in
+var publicSuffixes = sync.OnceValue(func() map[string]bool {
+	rules := map[string]bool{}
+	for _, line := range strings.Split(publicSuffixList, "\n") {
+		rule, _, _ := strings.Cut(strings.TrimSpace(line), " ")
+		if rule == "" || strings.HasPrefix(rule, "//") {
+			continue
+		}
+		prefix := ""
+		for _, p := range []string{"!", "*."} {
+			if rest, ok := strings.CutPrefix(rule, p); ok {
+				prefix, rule = p, rest
+			}
+		}
+		if ascii, err := idnToASCII(rule); err == nil {
+			rule = ascii
+		}
+		rules[prefix+rule] = true
+	}
+	return rules
+})
+
+// isPublicSuffix reports whether domain is a public suffix, a name under
+// which anyone can register, such as com, co.uk or github.io. Cookies set for
+// one would be sent to every site below it
+func isPublicSuffix(domain string) bool {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	rules := publicSuffixes()
+	if rules["!"+domain] {
+		return false
+	}
+	if rules[domain] || !strings.Contains(domain, ".") {
+		return true
+	}
+	_, parent, _ := strings.Cut(domain, ".")
+	return rules["*."+parent]
+}
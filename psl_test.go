@@ -0,0 +1,57 @@
+package main
+
+import "testing"
+
+func TestIsPublicSuffix(t *testing.T) {
+	tests := []struct {
+		domain string
+		want   bool
+	}{
+		{"com", true},
+		{"uk", true},
+		{"co.uk", true},
+		{"CO.UK.", true},
+		{"example.co.uk", false},
+		{"example.com", false},
+		{"github.io", true},
+		{"user.github.io", false},
+		// Wildcard rule *.kawasaki.jp with the exception !city.kawasaki.jp
+		{"kawasaki.jp", false},
+		{"anything.kawasaki.jp", true},
+		{"city.kawasaki.jp", false},
+		{"www.city.kawasaki.jp", false},
+		// Wildcard rule *.ck with the exception !www.ck
+		{"ck", true},
+		{"anything.ck", true},
+		{"www.ck", false},
+		{"example.www.ck", false},
+		{"com.pl", true},
+		{"example.com.pl", false},
+		{"co.at", true},
+		{"example.co.at", false},
+		{"herokuapp.com", true},
+		{"app.herokuapp.com", false},
+		{"s3.amazonaws.com", true},
+		// Unicode rules are matched in their Punycode form: 公司.cn
+		{"xn--55qx5d.cn", true},
+		{"example.xn--55qx5d.cn", false},
+	}
+
+	for _, tt := range tests {
+		if got := isPublicSuffix(tt.domain); got != tt.want {
+			t.Errorf("isPublicSuffix(%q) = %v, want %v", tt.domain, got, tt.want)
+		}
+	}
+}
+
+func TestPublicSuffixListEmbedded(t *testing.T) {
+	rules := publicSuffixes()
+	if len(rules) < 9000 {
+		t.Errorf("%d public suffix rules, want the full list", len(rules))
+	}
+	for rule := range rules {
+		if !isASCII(rule) {
+			t.Errorf("rule %q is not in its ASCII form", rule)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// tokenBucket paces a byte stream to a fixed rate
+type tokenBucket struct {
+	rate   float64 // bytes per second
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket creates an empty bucket refilling at rate bytes per second
+func newTokenBucket(rate int64) *tokenBucket {
+	return &tokenBucket{rate: float64(rate), last: time.Now()}
+}
+
+// chunk returns the largest piece of n bytes worth sending in one go, so
+// bursts never exceed one second of traffic
+func (b *tokenBucket) chunk(n int) int {
+	return max(1, min(n, int(b.rate)))
+}
+
+// wait accounts for n transferred bytes and blocks until the bucket is no
+// longer in debt, returning early when ctx ends
+func (b *tokenBucket) wait(ctx context.Context, n int) error {
+	now := time.Now()
+	b.tokens = min(b.rate, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(time.Duration(-b.tokens / b.rate * float64(time.Second)))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// throttledConn limits reads and writes on a connection with separate
+// download and upload buckets for --limit-rate
+type throttledConn struct {
+	net.Conn
+	ctx      context.Context
+	download *tokenBucket
+	upload   *tokenBucket
+}
+
+// newThrottledConn wraps conn so that each direction moves at most rate bytes per second
+func newThrottledConn(ctx context.Context, conn net.Conn, rate int64) *throttledConn {
+	return &throttledConn{
+		Conn:     conn,
+		ctx:      ctx,
+		download: newTokenBucket(rate),
+		upload:   newTokenBucket(rate),
+	}
+}
+
+// Read reads from the connection, then waits until the download budget allows more
+func (c *throttledConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p[:c.download.chunk(len(p))])
+	if n > 0 {
+		if waitErr := c.download.wait(c.ctx, n); waitErr != nil && err == nil {
+			err = waitErr
+		}
+	}
+	return n, err
+}
+
+// Write sends p in rate-sized pieces, waiting for the upload budget before each one
+func (c *throttledConn) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		size := c.upload.chunk(len(p) - written)
+		if err := c.upload.wait(c.ctx, size); err != nil {
+			return written, err
+		}
+		n, err := c.Conn.Write(p[written : written+size])
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
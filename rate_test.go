@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	bucket := newTokenBucket(10000)
+	if got := bucket.chunk(50000); got != 10000 {
+		t.Errorf("chunk(50000) = %d, want one second of traffic", got)
+	}
+	if got := bucket.chunk(10); got != 10 {
+		t.Errorf("chunk(10) = %d, want 10", got)
+	}
+	if got := newTokenBucket(0).chunk(10); got != 1 {
+		t.Errorf("chunk of a zero rate = %d, want 1", got)
+	}
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := bucket.wait(context.Background(), 1000); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond || elapsed > time.Second {
+		t.Errorf("4000 bytes at 10000 a second took %v, want about 400ms", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := bucket.wait(ctx, 100000); !errors.Is(err, context.Canceled) {
+		t.Errorf("wait on an ended context = %v, want context.Canceled", err)
+	}
+}
+
+func TestLimitRate(t *testing.T) {
+	payload := strings.Repeat("x", 30000)
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request, body string) { w.Write([]byte(payload)) })
+
+	// The same transfer unthrottled, to tell the throttling from the cost of
+	// starting the program
+	start := time.Now()
+	if result := runCLI(t, "", "-s", "-S", "-o", "/dev/null", server.URL+"/"); result.code != 0 {
+		t.Fatalf("without --limit-rate: exit status %d, stderr:\n%s", result.code, result.stderr)
+	}
+	unthrottled := time.Since(start)
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "download"},
+		{name: "upload", args: []string{"-d", payload}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			args := append([]string{"-s", "-S", "-o", "/dev/null", "--limit-rate", "20k"}, tt.args...)
+			result := runCLI(t, "", append(args, server.URL+"/")...)
+			if result.code != 0 {
+				t.Fatalf("exit status %d, stderr:\n%s", result.code, result.stderr)
+			}
+			// 30000 bytes at 20480 a second, starting with an empty bucket
+			if elapsed := time.Since(start); elapsed < unthrottled+time.Second {
+				t.Errorf("the transfer took %v, %v unthrottled, want at least a second more", elapsed, unthrottled)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// exitTooManyRedirects is the exit status used when --max-redirs is reached,
+// matching curl's status for the same condition
+const exitTooManyRedirects = 47
+
+// exitRedirectLoop is the exit status used when a redirect chain comes back
+// to a request it already made. curl has no such check, so the status lies
+// past the range curl uses
+const exitRedirectLoop = 100
+
+// isRedirect reports whether the status code asks the client to follow a Location header
+func isRedirect(code int) bool {
+	switch code {
+	case 301, 302, 303, 307, 308:
+		return true
+	}
+	return false
+}
+
+// resolveRedirect resolves a possibly relative Location value against the current URL
+func resolveRedirect(current string, location string) (string, error) {
+	base, err := url.Parse(current)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(location)
+	if err != nil {
+		return "", fmt.Errorf("invalid redirect location %q: %v", location, err)
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+// redirectKey normalizes a method and URL so equivalent spellings of the same
+// target compare equal: scheme and host are lowercased, default ports, empty
+// paths and fragments are dropped and dot segments are resolved
+func redirectKey(method string, rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return method + " " + rawURL
+	}
+	u = u.ResolveReference(&url.URL{})
+	u.Scheme = strings.ToLower(u.Scheme)
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if port != "" {
+		host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	u.Host = host
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	u.Fragment = ""
+	return method + " " + u.String()
+}
+
+// followRedirects sends the request and, with -L, keeps following Location
+// headers until a final response arrives. Revisiting a (method, URL) pair
+// aborts immediately instead of running into --max-redirs
+func followRedirects(ctx context.Context, opts *requestOptions, stats *transferStats) (*httpResponse, io.Reader, net.Conn, error) {
+	target := opts.URL
+	visited := map[string]bool{}
+	for {
+		resp, body, conn, err := authenticatedRequest(ctx, opts, target, stats)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		stats.URLEffective = target
+		if opts.CookieJar != nil {
+			if options, err := parseURL(target); err == nil {
+				opts.CookieJar.store(options, resp, time.Now())
+			}
+		}
+
+		location := resp.header("Location")
+		if !opts.Location || !isRedirect(resp.StatusCode) || location == "" {
+			return resp, body, conn, nil
+		}
+		out.printHead(resp)
+		conn.Close()
+
+		next, err := resolveRedirect(target, location)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		visited[redirectKey(opts.Method, target)] = true
+
+		// Like curl, 303 always switches to GET, and POST becomes GET on 301 and 302
+		if (resp.StatusCode == 303 && opts.Method != "HEAD") ||
+			((resp.StatusCode == 301 || resp.StatusCode == 302) && opts.Method == "POST") {
+			opts.Method = "GET"
+			opts.dropBody()
+		}
+		// A redirect keeping the method sends the body again, which a stream
+		// that has been read cannot do
+		if _, ok := opts.Upload.(*streamUpload); ok {
+			return nil, nil, nil, fmt.Errorf("error: cannot follow the redirect to %s, the request body was streamed from stdin and cannot be sent again", next)
+		}
+
+		if visited[redirectKey(opts.Method, next)] {
+			return nil, nil, nil, &exitError{
+				code: exitRedirectLoop,
+				err:  fmt.Errorf("redirect loop detected: %s %s was already visited", opts.Method, next),
+			}
+		}
+		if opts.MaxRedirs >= 0 && stats.NumRedirects >= opts.MaxRedirs {
+			return nil, nil, nil, &exitError{
+				code: exitTooManyRedirects,
+				err:  fmt.Errorf("maximum (%d) redirects followed", opts.MaxRedirs),
+			}
+		}
+		stats.NumRedirects++
+		target = next
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRedirectKey(t *testing.T) {
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{a: "http://Example.COM/a", b: "http://example.com/a", same: true},
+		{a: "http://example.com:80/a", b: "http://example.com/a", same: true},
+		{a: "http://example.com", b: "http://example.com/", same: true},
+		{a: "http://example.com/x/../a#top", b: "http://example.com/a", same: true},
+		{a: "http://[::1]:80/", b: "http://[::1]/", same: true},
+		{a: "http://example.com:8080/a", b: "http://example.com/a"},
+		{a: "http://example.com/a?x=1", b: "http://example.com/a"},
+	}
+
+	for _, tt := range tests {
+		if got := redirectKey("GET", tt.a) == redirectKey("GET", tt.b); got != tt.same {
+			t.Errorf("redirectKey(%q) == redirectKey(%q) is %v, want %v", tt.a, tt.b, got, tt.same)
+		}
+	}
+	if redirectKey("GET", "http://example.com/") == redirectKey("POST", "http://example.com/") {
+		t.Error("redirectKey ignores the method")
+	}
+}
+
+func TestResolveRedirect(t *testing.T) {
+	tests := []struct {
+		location string
+		want     string
+	}{
+		{location: "/b", want: "http://example.com/b"},
+		{location: "c", want: "http://example.com/dir/c"},
+		{location: "../d?q=1", want: "http://example.com/d?q=1"},
+		{location: "//other.example/e", want: "http://other.example/e"},
+		{location: "https://secure.example/", want: "https://secure.example/"},
+	}
+
+	for _, tt := range tests {
+		got, err := resolveRedirect("http://example.com/dir/page", tt.location)
+		if err != nil || got != tt.want {
+			t.Errorf("resolveRedirect(%q) = %q, %v, want %q", tt.location, got, err, tt.want)
+		}
+	}
+}
+
+func TestFollowRedirects(t *testing.T) {
+	upload := filepath.Join(t.TempDir(), "a.txt")
+	if err := os.WriteFile(upload, []byte("file data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// redirects maps a path to the status and Location it answers with
+	redirects := map[string][2]string{
+		"/moved":     {"302", "/final"},
+		"/see-other": {"303", "/final"},
+		"/temporary": {"307", "/final"},
+		"/loop-a":    {"302", "/loop-b"},
+		"/loop-b":    {"302", "/loop-a"},
+		"/hop-1":     {"302", "/hop-2"},
+		"/hop-2":     {"302", "/hop-3"},
+		"/hop-3":     {"302", "/final"},
+	}
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request, body string) {
+		if redirect, ok := redirects[r.URL.Path]; ok {
+			w.Header().Set("Location", redirect[1])
+			w.WriteHeader(map[string]int{"302": 302, "303": 303, "307": 307}[redirect[0]])
+			return
+		}
+		w.Write([]byte("final"))
+	})
+
+	tests := []struct {
+		name       string
+		args       []string
+		path       string
+		wantCode   int
+		wantStderr string
+		wantLast   string // method, Content-Type and body of the last request
+		wantCount  int
+	}{
+		{name: "not followed", path: "/moved", wantLast: "GET  ", wantCount: 1},
+		{name: "followed", args: []string{"-L"}, path: "/moved", wantLast: "GET  ", wantCount: 2},
+		{name: "307 keeps the body", args: []string{"-L", "-d", "a=1"}, path: "/temporary", wantLast: "POST application/x-www-form-urlencoded a=1", wantCount: 2},
+		{name: "303 drops -d", args: []string{"-L", "-d", "a=1"}, path: "/see-other", wantLast: "GET  ", wantCount: 2},
+		{name: "303 drops -F", args: []string{"-L", "-F", "file=@" + upload}, path: "/see-other", wantLast: "GET  ", wantCount: 2},
+		{name: "303 drops -T", args: []string{"-L", "-T", upload}, path: "/see-other", wantLast: "GET  ", wantCount: 2},
+		{name: "302 drops a POST body", args: []string{"-L", "--data-binary", "x"}, path: "/moved", wantLast: "GET  ", wantCount: 2},
+		{name: "loop", args: []string{"-L"}, path: "/loop-a", wantCode: exitRedirectLoop, wantStderr: "redirect loop detected: GET " + server.URL + "/loop-a", wantCount: 2},
+		{name: "too many", args: []string{"-L", "--max-redirs", "2"}, path: "/hop-1", wantCode: exitTooManyRedirects, wantStderr: "maximum (2) redirects followed", wantCount: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(server.received())
+			result := runCLI(t, "", append(append([]string{"-s", "-S"}, tt.args...), server.URL+tt.path)...)
+			if result.code != tt.wantCode {
+				t.Fatalf("exit status %d, want %d, stderr:\n%s", result.code, tt.wantCode, result.stderr)
+			}
+			if !strings.Contains(result.stderr, tt.wantStderr) {
+				t.Errorf("stderr = %q, want it to contain %q", result.stderr, tt.wantStderr)
+			}
+			requests := server.received()[before:]
+			if len(requests) != tt.wantCount {
+				t.Fatalf("%d requests, want %d", len(requests), tt.wantCount)
+			}
+			last := requests[len(requests)-1]
+			if got := last.Method + " " + last.Header.Get("Content-Type") + " " + last.Body; tt.wantLast != "" && got != tt.wantLast {
+				t.Errorf("last request = %q, want %q", got, tt.wantLast)
+			}
+		})
+	}
+}
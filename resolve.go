@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// resolveOverride maps a host and port to fixed addresses, as given to --resolve
+type resolveOverride struct {
+	host  string
+	port  string // "*" matches any port
+	addrs []net.IP
+}
+
+// resolveList is a custom flag type holding the --resolve overrides in
+// command-line order
+type resolveList []resolveOverride
+
+// String returns the string representation of the resolveList
+func (r *resolveList) String() string {
+	entries := make([]string, len(*r))
+	for i, override := range *r {
+		addrs := make([]string, len(override.addrs))
+		for j, ip := range override.addrs {
+			addrs[j] = ip.String()
+		}
+		entries[i] = override.host + ":" + override.port + ":" + strings.Join(addrs, ",")
+	}
+	return strings.Join(entries, " ")
+}
+
+// Set parses a host:port:address[,address...] override; the port may be *
+// for any port, and IPv6 addresses may be given in brackets
+func (r *resolveList) Set(value string) error {
+	host, rest, ok := strings.Cut(value, ":")
+	port, list, ok2 := strings.Cut(rest, ":")
+	if !ok || !ok2 || host == "" || list == "" {
+		return fmt.Errorf("invalid --resolve entry %q: expected host:port:address", value)
+	}
+	if n, err := strconv.Atoi(port); port != "*" && (err != nil || n < 1 || n > 65535) {
+		return fmt.Errorf("invalid --resolve entry %q: invalid port %s", value, port)
+	}
+	override := resolveOverride{host: host, port: port}
+	for _, addr := range strings.Split(list, ",") {
+		addr = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(addr), "["), "]")
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return fmt.Errorf("invalid --resolve entry %q: invalid address %s", value, addr)
+		}
+		override.addrs = append(override.addrs, ip)
+	}
+	*r = append(*r, override)
+	return nil
+}
+
+// lookup returns the addresses of the first override matching host and
+// port, host names compared case-insensitively
+func (r resolveList) lookup(host string, port string) ([]net.IP, bool) {
+	for _, override := range r {
+		if strings.EqualFold(override.host, host) && (override.port == "*" || override.port == port) {
+			return override.addrs, true
+		}
+	}
+	return nil, false
+}
+
+// dnsServerList is a custom flag type holding the DNS servers to query
+// instead of the system ones, as host:port addresses
+type dnsServerList []string
+
+// String returns the string representation of the dnsServerList
+func (d *dnsServerList) String() string {
+	return strings.Join(*d, ",")
+}
+
+// Set parses a comma-separated list of server addresses, each an IP address
+// with an optional port, 53 by default
+func (d *dnsServerList) Set(value string) error {
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if ip := net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(part, "["), "]")); ip != nil {
+			*d = append(*d, net.JoinHostPort(ip.String(), "53"))
+			continue
+		}
+		host, port, err := net.SplitHostPort(part)
+		n, portErr := strconv.Atoi(port)
+		if err != nil || net.ParseIP(host) == nil || portErr != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("invalid DNS server: %s", part)
+		}
+		*d = append(*d, part)
+	}
+	return nil
+}
+
+// resolver returns the resolver used to look up host names: the system one,
+// or one sending its queries to the given servers. Each query goes to the
+// next server in turn, so a retried query after a timeout tries another one
+func (d dnsServerList) resolver() *net.Resolver {
+	if len(d) == 0 {
+		return net.DefaultResolver
+	}
+	var next atomic.Uint32
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network string, _ string) (net.Conn, error) {
+			server := d[int(next.Add(1)-1)%len(d)]
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// resolvedHosts caches the addresses host names resolved to, for
+// --dns-cache-timeout, so the transfers of a glob, redirects and retries to
+// the same host do not query the resolver again and their timings compare
+var resolvedHosts = &dnsCache{}
+
+// dnsCache holds resolved addresses by query until they expire; a zero
+// expiry time never does
+type dnsCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedAddrs
+}
+
+// cachedAddrs is one cached answer and the time it stops being valid
+type cachedAddrs struct {
+	addrs   []net.IP
+	expires time.Time
+}
+
+// get returns the cached addresses for key when they have not expired yet
+func (c *dnsCache) get(key string, now time.Time) ([]net.IP, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || (!entry.expires.IsZero() && !now.Before(entry.expires)) {
+		return nil, false
+	}
+	return entry.addrs, true
+}
+
+// put stores the addresses for key until expires, or for good when it is zero
+func (c *dnsCache) put(key string, addrs []net.IP, expires time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = map[string]cachedAddrs{}
+	}
+	c.entries[key] = cachedAddrs{addrs: addrs, expires: expires}
+}
+
+// lookupHost returns the addresses to connect to for host and port: those
+// given with --resolve, keeping the ones of the -4 or -6 family, or else the
+// ones found by resolving the name
+func lookupHost(ctx context.Context, host string, port string, opts *requestOptions) ([]net.IP, error) {
+	network := opts.network()
+	overridden, ok := opts.Resolve.lookup(host, port)
+	if !ok {
+		return resolveName(ctx, host, network, opts)
+	}
+	var addrs []net.IP
+	for _, ip := range overridden {
+		if (network == "ip4" && ip.To4() == nil) || (network == "ip6" && ip.To4() != nil) {
+			continue
+		}
+		addrs = append(addrs, ip)
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no %s address given for %s with --resolve", familyName(network), host)
+	}
+	return addrs, nil
+}
+
+// resolveName resolves a host name with DoH when --doh-url is given, or else
+// the system resolver or --dns-servers. The addresses are cached for
+// --dns-cache-timeout seconds, for good when it is negative and not at all
+// when it is 0
+func resolveName(ctx context.Context, host string, network string, opts *requestOptions) ([]net.IP, error) {
+	if net.ParseIP(host) != nil {
+		return resolveHost(ctx, net.DefaultResolver, host, network)
+	}
+	key := fmt.Sprintf("%s %s %s %s", opts.DoHURL, opts.DNSServers.String(), strings.ToLower(host), network)
+	now := time.Now()
+	if opts.DNSCacheTimeout != 0 {
+		if addrs, ok := resolvedHosts.get(key, now); ok {
+			return addrs, nil
+		}
+	}
+
+	var addrs []net.IP
+	var err error
+	if opts.DoHURL != "" {
+		addrs, err = resolveDoH(ctx, opts, host, network)
+	} else {
+		addrs, err = resolveHost(ctx, opts.DNSServers.resolver(), host, network)
+	}
+	if err != nil || opts.DNSCacheTimeout == 0 {
+		return addrs, err
+	}
+	var expires time.Time
+	if opts.DNSCacheTimeout > 0 {
+		expires = now.Add(seconds(opts.DNSCacheTimeout))
+	}
+	resolvedHosts.put(key, addrs, expires)
+	return addrs, nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestResolveListSet(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr string
+	}{
+		{value: "example.com:443:192.0.2.1", want: "example.com:443:192.0.2.1"},
+		{value: "example.com:*:192.0.2.1, [2001:db8::1]", want: "example.com:*:192.0.2.1,2001:db8::1"},
+		{value: "example.com:443", wantErr: "expected host:port:address"},
+		{value: ":443:192.0.2.1", wantErr: "expected host:port:address"},
+		{value: "example.com:0:192.0.2.1", wantErr: "invalid port 0"},
+		{value: "example.com:https:192.0.2.1", wantErr: "invalid port https"},
+		{value: "example.com:443:not-an-ip", wantErr: "invalid address not-an-ip"},
+	}
+
+	for _, tt := range tests {
+		var list resolveList
+		err := list.Set(tt.value)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Set(%q) error = %v, want one mentioning %q", tt.value, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || list.String() != tt.want {
+			t.Errorf("Set(%q) = %q, %v, want %q", tt.value, list.String(), err, tt.want)
+		}
+	}
+}
+
+func TestResolveLookup(t *testing.T) {
+	var list resolveList
+	for _, value := range []string{"a.example:443:192.0.2.1", "A.example:*:192.0.2.2", "b.example:80:192.0.2.3,2001:db8::3"} {
+		if err := list.Set(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		host, port string
+		want       string
+	}{
+		{host: "a.example", port: "443", want: "192.0.2.1"},
+		{host: "a.EXAMPLE", port: "8080", want: "192.0.2.2"},
+		{host: "b.example", port: "80", want: "192.0.2.3"},
+		{host: "b.example", port: "443"},
+		{host: "c.example", port: "80"},
+	}
+
+	for _, tt := range tests {
+		var got string
+		if addrs, ok := list.lookup(tt.host, tt.port); ok {
+			got = addrs[0].String()
+		}
+		if got != tt.want {
+			t.Errorf("lookup(%s, %s) starts with %q, want %q", tt.host, tt.port, got, tt.want)
+		}
+	}
+}
+
+func TestLookupHostFamilies(t *testing.T) {
+	opts := &requestOptions{}
+	opts.Resolve.Set("dual.example:80:192.0.2.1,2001:db8::1")
+	opts.Resolve.Set("v4.example:80:192.0.2.2")
+
+	tests := []struct {
+		name    string
+		host    string
+		ipv4    bool
+		ipv6    bool
+		want    []string
+		wantErr string
+	}{
+		{name: "both", host: "dual.example", want: []string{"192.0.2.1", "2001:db8::1"}},
+		{name: "-4", host: "dual.example", ipv4: true, want: []string{"192.0.2.1"}},
+		{name: "-6", host: "dual.example", ipv6: true, want: []string{"2001:db8::1"}},
+		{name: "-6 without an IPv6 address", host: "v4.example", ipv6: true, wantErr: "no IPv6 address given for v4.example with --resolve"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts.IPv4, opts.IPv6 = tt.ipv4, tt.ipv6
+			addrs, err := lookupHost(context.Background(), tt.host, "80", opts)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("lookupHost error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			var got []string
+			for _, addr := range addrs {
+				got = append(got, addr.String())
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") || err != nil {
+				t.Errorf("lookupHost = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveRequest(t *testing.T) {
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request, body string) { w.Write([]byte(r.Host)) })
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	url := "http://pinned.invalid:" + port + "/"
+
+	tests := []struct {
+		name    string
+		resolve string
+	}{
+		{name: "host and port", resolve: "pinned.invalid:" + port + ":127.0.0.1"},
+		{name: "any port", resolve: "PINNED.invalid:*:127.0.0.1"},
+		// Nothing listens on 127.0.0.2, so the second address is used
+		{name: "falls back to the next address", resolve: "pinned.invalid:" + port + ":127.0.0.2,127.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := runCLI(t, "", "-s", "-S", "--resolve", tt.resolve, url)
+			if result.code != 0 {
+				t.Fatalf("exit status %d, stderr:\n%s", result.code, result.stderr)
+			}
+			if want := "pinned.invalid:" + port; result.stdout != want {
+				t.Errorf("the server saw Host %q, want %q", result.stdout, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httputil"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// headerField is a single header name/value pair
+type headerField struct {
+	Name  string
+	Value string
+}
+
+// httpResponse holds the parsed components of an HTTP response
+type httpResponse struct {
+	Proto      string
+	StatusCode int
+	Status     string
+	Headers    []headerField
+	Head       string // status line and header lines exactly as received
+	Body       []byte
+}
+
+// header returns the first value of the named response header, matched case-insensitively
+func (r *httpResponse) header(name string) string {
+	for _, h := range r.Headers {
+		if strings.EqualFold(h.Name, name) {
+			return h.Value
+		}
+	}
+	return ""
+}
+
+// readResponseHead reads a status line and header block from the reader
+func readResponseHead(reader *bufio.Reader) (*httpResponse, error) {
+	var head strings.Builder
+
+	statusLine, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("error reading status line: %v", err)
+	}
+	head.WriteString(statusLine)
+
+	parts := strings.SplitN(strings.TrimRight(statusLine, "\r\n"), " ", 3)
+	if len(parts) < 2 || !strings.HasPrefix(parts[0], "HTTP/") {
+		return nil, fmt.Errorf("malformed status line: %q", statusLine)
+	}
+	code, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed status code: %q", parts[1])
+	}
+	resp := &httpResponse{Proto: parts[0], StatusCode: code}
+	if len(parts) == 3 {
+		resp.Status = parts[2]
+	}
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("error reading headers: %v", err)
+		}
+		head.WriteString(line)
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		resp.Headers = append(resp.Headers, headerField{
+			Name:  strings.TrimSpace(name),
+			Value: strings.TrimSpace(value),
+		})
+	}
+
+	resp.Head = head.String()
+	return resp, nil
+}
+
+// readResponse reads the final response head, skipping interim 1xx responses,
+// and returns a reader positioned at the decoded body
+func readResponse(reader *bufio.Reader, method string) (*httpResponse, io.Reader, error) {
+	for {
+		resp, err := readResponseHead(reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		if resp.StatusCode < 100 || resp.StatusCode >= 200 || resp.StatusCode == 101 {
+			return resp, bodyReader(reader, resp, method), nil
+		}
+	}
+}
+
+// readHTTPResponse reads a complete response, including its body
+func readHTTPResponse(reader *bufio.Reader, method string) (*httpResponse, error) {
+	resp, body, err := readResponse(reader, method)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body, err = io.ReadAll(body)
+	if err != nil {
+		return resp, fmt.Errorf("error reading body: %v", err)
+	}
+	return resp, nil
+}
+
+// bodyReader returns a reader limited to the response body, decoding chunked transfer encoding
+func bodyReader(reader *bufio.Reader, resp *httpResponse, method string) io.Reader {
+	// HEAD responses and these status codes never carry a body
+	if method == "HEAD" || resp.StatusCode == 204 || resp.StatusCode == 304 {
+		return strings.NewReader("")
+	}
+
+	if strings.Contains(strings.ToLower(resp.header("Transfer-Encoding")), "chunked") {
+		return &chunkedReader{r: httputil.NewChunkedReader(reader), conn: reader}
+	}
+
+	if cl := resp.header("Content-Length"); cl != "" {
+		if n, err := strconv.ParseInt(cl, 10, 64); err == nil {
+			return &exactReader{r: io.LimitReader(reader, n), remaining: n}
+		}
+	}
+
+	// Without framing the body runs until the server closes the connection
+	return closeDelimitedReader{reader}
+}
+
+// chunkedReader decodes a chunked body and, once the last chunk is read,
+// skips the trailer fields after it, so that the connection is left at the
+// end of the response
+type chunkedReader struct {
+	r    io.Reader
+	conn *bufio.Reader
+}
+
+// Read reads decoded body bytes, consuming the trailer at the end
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if err == io.EOF {
+		for {
+			line, lineErr := c.conn.ReadString('\n')
+			if lineErr != nil {
+				return n, fmt.Errorf("error reading the trailer: %v", lineErr)
+			}
+			if strings.TrimRight(line, "\r\n") == "" {
+				break
+			}
+		}
+		c.r = eofReader{}
+	}
+	return n, err
+}
+
+// eofReader is an exhausted reader
+type eofReader struct{}
+
+// Read always reports the end of the stream
+func (eofReader) Read([]byte) (int, error) {
+	return 0, io.EOF
+}
+
+// closeDelimitedReader reads a body that ends when the server closes the
+// connection. A server that resets the connection instead of closing it
+// cleanly has still ended the body, so the reset is reported as EOF
+type closeDelimitedReader struct {
+	r io.Reader
+}
+
+// Read reads from the underlying reader, turning a connection reset into EOF
+func (c closeDelimitedReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if errors.Is(err, syscall.ECONNRESET) {
+		return n, io.EOF
+	}
+	return n, err
+}
+
+// exactReader reports an error when the underlying stream ends before
+// the advertised Content-Length has been read
+type exactReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+// Read reads from the underlying reader, tracking the bytes still expected
+func (e *exactReader) Read(p []byte) (int, error) {
+	n, err := e.r.Read(p)
+	e.remaining -= int64(n)
+	if err == io.EOF && e.remaining > 0 {
+		return n, fmt.Errorf("transfer closed with %s remaining to read", out.size(e.remaining))
+	}
+	return n, err
+}
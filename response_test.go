@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadResponseFraming(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		raw      string
+		status   int
+		body     string
+		rest     string // what is left on the connection after the body
+		errorMsg string
+	}{
+		{
+			name:   "content length",
+			method: "GET",
+			raw:    "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhelloNEXT",
+			status: 200,
+			body:   "hello",
+			rest:   "NEXT",
+		},
+		{
+			name:   "chunked",
+			method: "GET",
+			raw:    "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n7\r\n, world\r\n0\r\n\r\n",
+			status: 200,
+			body:   "hello, world",
+		},
+		{
+			name:   "chunked with extensions",
+			method: "GET",
+			raw:    "HTTP/1.1 200 OK\r\nTransfer-Encoding: gzip, Chunked\r\n\r\n3;ext=1\r\nabc\r\n0\r\n\r\n",
+			status: 200,
+			body:   "abc",
+		},
+		{
+			name:   "chunked with trailer",
+			method: "GET",
+			raw:    "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n2\r\nhi\r\n0\r\nExpires: never\r\nX-Sum: 1\r\n\r\nNEXT",
+			status: 200,
+			body:   "hi",
+			rest:   "NEXT",
+		},
+		{
+			name:   "close delimited",
+			method: "GET",
+			raw:    "HTTP/1.0 200 OK\r\nContent-Type: text/plain\r\n\r\nuntil the end",
+			status: 200,
+			body:   "until the end",
+		},
+		{
+			name:   "chunked wins over content length",
+			method: "GET",
+			raw:    "HTTP/1.1 200 OK\r\nContent-Length: 100\r\nTransfer-Encoding: chunked\r\n\r\n2\r\nok\r\n0\r\n\r\n",
+			status: 200,
+			body:   "ok",
+		},
+		{
+			name:   "head has no body",
+			method: "HEAD",
+			raw:    "HTTP/1.1 200 OK\r\nContent-Length: 1234\r\n\r\n",
+			status: 200,
+		},
+		{
+			name:   "no content",
+			method: "GET",
+			raw:    "HTTP/1.1 204 No Content\r\n\r\nNEXT",
+			status: 204,
+			rest:   "NEXT",
+		},
+		{
+			name:   "not modified",
+			method: "GET",
+			raw:    "HTTP/1.1 304 Not Modified\r\nContent-Length: 10\r\n\r\n",
+			status: 304,
+		},
+		{
+			name:   "interim responses skipped",
+			method: "POST",
+			raw:    "HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 103 Early Hints\r\nLink: </a.css>\r\n\r\nHTTP/1.1 201 Created\r\nContent-Length: 2\r\n\r\nok",
+			status: 201,
+			body:   "ok",
+		},
+		{
+			name:     "short content length",
+			method:   "GET",
+			raw:      "HTTP/1.1 200 OK\r\nContent-Length: 10\r\n\r\nshort",
+			status:   200,
+			errorMsg: "transfer closed with",
+		},
+		{
+			name:     "truncated chunk",
+			method:   "GET",
+			raw:      "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\na\r\nabc",
+			status:   200,
+			errorMsg: "unexpected EOF",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := bufio.NewReader(strings.NewReader(tt.raw))
+			resp, body, err := readResponse(reader, tt.method)
+			if err != nil {
+				t.Fatalf("readResponse() error = %v", err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			got, err := io.ReadAll(body)
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("reading body: error = %v, want one containing %q", err, tt.errorMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("reading body: %v", err)
+			}
+			if string(got) != tt.body {
+				t.Errorf("body = %q, want %q", got, tt.body)
+			}
+			rest, _ := io.ReadAll(reader)
+			if string(rest) != tt.rest {
+				t.Errorf("left on the connection = %q, want %q", rest, tt.rest)
+			}
+		})
+	}
+}
+
+func TestReadResponseHead(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		proto   string
+		status  int
+		reason  string
+		headers []headerField
+		wantErr bool
+	}{
+		{
+			name:    "status and headers",
+			raw:     "HTTP/1.1 404 Not Found\r\nContent-Type: text/html\r\nX-Spaced :  value  \r\n\r\n",
+			proto:   "HTTP/1.1",
+			status:  404,
+			reason:  "Not Found",
+			headers: []headerField{{"Content-Type", "text/html"}, {"X-Spaced", "value"}},
+		},
+		{
+			name:   "no reason phrase",
+			raw:    "HTTP/1.1 200\r\n\r\n",
+			proto:  "HTTP/1.1",
+			status: 200,
+		},
+		{
+			name:    "bare line feeds",
+			raw:     "HTTP/1.0 200 OK\nA: 1\n\n",
+			proto:   "HTTP/1.0",
+			status:  200,
+			reason:  "OK",
+			headers: []headerField{{"A", "1"}},
+		},
+		{name: "not http", raw: "SSH-2.0-OpenSSH\r\n\r\n", wantErr: true},
+		{name: "bad code", raw: "HTTP/1.1 abc OK\r\n\r\n", wantErr: true},
+		{name: "headers cut short", raw: "HTTP/1.1 200 OK\r\nA: 1\r\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := readResponseHead(bufio.NewReader(strings.NewReader(tt.raw)))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("readResponseHead() = %+v, want an error", resp)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readResponseHead() error = %v", err)
+			}
+			if resp.Proto != tt.proto || resp.StatusCode != tt.status || resp.Status != tt.reason {
+				t.Errorf("status line = %s %d %q, want %s %d %q", resp.Proto, resp.StatusCode, resp.Status, tt.proto, tt.status, tt.reason)
+			}
+			if len(resp.Headers) != len(tt.headers) {
+				t.Fatalf("headers = %v, want %v", resp.Headers, tt.headers)
+			}
+			for i, h := range tt.headers {
+				if resp.Headers[i] != h {
+					t.Errorf("header %d = %v, want %v", i, resp.Headers[i], h)
+				}
+			}
+			if resp.Head != tt.raw {
+				t.Errorf("Head = %q, want %q", resp.Head, tt.raw)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// resumePoint records where a failed download to a file stopped, so that the
+// next retry can ask for the rest with a Range request
+type resumePoint struct {
+	Dest      string
+	Offset    int64
+	Validator string // ETag, or Last-Modified when there is no strong ETag
+}
+
+// newResumePoint returns the point to resume a failed attempt from, or nil
+// when the download cannot be resumed: it must have been a GET streamed to a
+// file, from a server announcing byte ranges (now, or on an earlier run known
+// from --host-db) and a validator to check that the resource has not changed
+// in the meantime
+func newResumePoint(opts requestOptions, result *transferResult) *resumePoint {
+	resp := result.Response
+	if result.Dest == "" || bufferBody(opts, result.Dest) || opts.RemoveOnError || opts.Method != "GET" {
+		return nil
+	}
+	ranges := strings.EqualFold(resp.header("Accept-Ranges"), "bytes") || opts.HostPrefs != nil && opts.HostPrefs.AcceptRanges
+	if resp.StatusCode != 206 && (resp.StatusCode != 200 || !ranges) {
+		return nil
+	}
+	validator := resp.header("ETag")
+	if validator == "" || strings.HasPrefix(validator, "W/") {
+		validator = resp.header("Last-Modified")
+	}
+	if validator == "" {
+		return nil
+	}
+	info, err := os.Stat(result.Dest)
+	if err != nil || info.Size() == 0 {
+		return nil
+	}
+	return &resumePoint{Dest: result.Dest, Offset: info.Size(), Validator: validator}
+}
+
+// withRangeHeaders returns a copy of the options asking for the rest of the
+// resource. If-Range makes the server send the whole resource instead when it
+// has changed since the failed attempt
+func (r *resumePoint) withRangeHeaders(opts requestOptions) requestOptions {
+	opts.Headers = opts.Headers.with(fmt.Sprintf("Range: bytes=%d-", r.Offset)).with("If-Range: " + r.Validator)
+	return opts
+}
+
+// continues reports whether the response carries the rest of the resource
+// starting exactly where the failed attempt stopped
+func (r *resumePoint) continues(resp *httpResponse) bool {
+	if resp.StatusCode != 206 {
+		return false
+	}
+	spec, ok := strings.CutPrefix(resp.header("Content-Range"), "bytes ")
+	if !ok {
+		return false
+	}
+	first, _, _ := strings.Cut(spec, "-")
+	start, err := strconv.ParseInt(first, 10, 64)
+	return err == nil && start == r.Offset
+}
+
+// uploadResumeOffset asks the server with a HEAD request how much of the -T
+// file of a failed attempt it has stored, and returns the offset to send the
+// rest from. It returns 0, sending the whole file again, when the upload is
+// not a regular file or the server reports no part of it. The server must
+// keep what a broken-off PUT delivered and accept Content-Range on the next
+// one, which --resume-upload asserts
+func uploadResumeOffset(ctx context.Context, opts requestOptions) int64 {
+	upload, ok := opts.Upload.(*fileUpload)
+	if !ok {
+		return 0
+	}
+	// The probe goes out like the upload itself, with its credentials and
+	// connection settings, but without its body
+	probe := opts
+	probe.Method = "HEAD"
+	probe.dropBody()
+	resp, body, conn, err := authenticatedRequest(ctx, &probe, probe.URL, newTransferStats())
+	if err != nil {
+		return 0
+	}
+	defer conn.Close()
+	io.Copy(io.Discard, body)
+	stored, err := strconv.ParseInt(resp.header("Content-Length"), 10, 64)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 || err != nil || stored <= 0 || stored >= upload.size {
+		return 0
+	}
+	return stored
+}
+
+// withUploadRange returns a copy of the options sending the -T file from
+// UploadOffset on, with a Content-Range header placing that part
+func withUploadRange(opts requestOptions) requestOptions {
+	upload := *opts.Upload.(*fileUpload)
+	upload.offset = opts.UploadOffset
+	opts.Upload = &upload
+	opts.Headers = opts.Headers.with(fmt.Sprintf("Content-Range: bytes %d-%d/%d", upload.offset, upload.size-1, upload.size))
+	return opts
+}
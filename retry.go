@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// maxRetryBackoff caps the exponential delay between retries
+const maxRetryBackoff = 10 * time.Minute
+
+// statusError reports a response whose status code marks a transient server problem
+type statusError struct {
+	resp *httpResponse
+}
+
+// Error describes the failed response
+func (e *statusError) Error() string {
+	return fmt.Sprintf("HTTP error %d", e.resp.StatusCode)
+}
+
+// transientStatus reports whether a status code is worth retrying, using the same set as curl
+func transientStatus(code int) bool {
+	switch code {
+	case 408, 429, 500, 502, 503, 504:
+		return true
+	}
+	return false
+}
+
+// shouldRetry decides whether a failed attempt may be retried. Timeouts and
+// transient HTTP statuses always qualify, refused connections only with
+// --retry-connrefused and anything else only with --retry-all-errors.
+// An interrupted transfer is never retried
+func shouldRetry(err error, opts requestOptions) bool {
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		return true
+	}
+	var exitErr *exitError
+	if errors.As(err, &exitErr) {
+		switch exitErr.code {
+		case exitInterrupted:
+			return false
+		case exitOperationTimedOut:
+			return true
+		}
+	}
+	if opts.RetryConnRefused && errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	return opts.RetryAllErrors
+}
+
+// retryWait picks the delay before the next attempt: a Retry-After value sent
+// with the failed response wins, then --retry-delay, then exponential backoff
+func retryWait(err error, opts requestOptions, backoff time.Duration) time.Duration {
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		if secs, convErr := strconv.Atoi(statusErr.resp.header("Retry-After")); convErr == nil && secs >= 0 {
+			return time.Duration(secs) * time.Second
+		}
+	}
+	if opts.RetryDelay > 0 {
+		return seconds(opts.RetryDelay)
+	}
+	return backoff
+}
+
+// transferWithRetries runs the transfer, retrying failed attempts up to
+// --retry times. The final attempt keeps transient response statuses so its
+// body is written out like any other response, and a download that broke off
+// midway is resumed from where it stopped when the server allows it, as is a
+// -T upload with --resume-upload
+func transferWithRetries(ctx context.Context, opts requestOptions) (*transferResult, error) {
+	start := time.Now()
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		left := opts.Retry - attempt
+		result, err := runTransfer(ctx, opts, left > 0)
+		if err == nil || left <= 0 || !shouldRetry(err, opts) {
+			return result, err
+		}
+		// Continue a download that died mid-body instead of starting over;
+		// an attempt that failed before any response keeps the earlier point
+		if result != nil {
+			opts.Resume = newResumePoint(opts, result)
+		}
+		// Likewise an upload that broke off before any response came back
+		if result == nil && opts.ResumeUpload {
+			opts.UploadOffset = uploadResumeOffset(ctx, opts)
+		}
+
+		wait := retryWait(err, opts, backoff)
+		if opts.RetryMaxTime > 0 && time.Since(start)+wait > seconds(opts.RetryMaxTime) {
+			return result, err
+		}
+		out.Errorln(fmt.Sprintf("Warning: %v. Will retry in %s. %d retries left.", err, out.duration(wait), left))
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return result, &exitError{code: exitInterrupted, err: fmt.Errorf("Interrupted while waiting to retry")}
+		}
+		backoff = min(backoff*2, maxRetryBackoff)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestShouldRetry(t *testing.T) {
+	refused := fmt.Errorf("error connecting: %w", syscall.ECONNREFUSED)
+	other := errors.New("error reading response: unexpected EOF")
+	status := &statusError{resp: &httpResponse{StatusCode: 503}}
+	timedOut := &exitError{code: exitOperationTimedOut, err: errors.New("timed out")}
+	interrupted := &exitError{code: exitInterrupted, err: errors.New("interrupted")}
+
+	tests := []struct {
+		name string
+		err  error
+		opts requestOptions
+		want bool
+	}{
+		{name: "transient status", err: status, want: true},
+		{name: "timeout", err: timedOut, want: true},
+		{name: "refused", err: refused},
+		{name: "refused with --retry-connrefused", err: refused, opts: requestOptions{RetryConnRefused: true}, want: true},
+		{name: "other", err: other},
+		{name: "other with --retry-all-errors", err: other, opts: requestOptions{RetryAllErrors: true}, want: true},
+		{name: "interrupted with --retry-all-errors", err: interrupted, opts: requestOptions{RetryAllErrors: true}},
+	}
+
+	for _, tt := range tests {
+		if got := shouldRetry(tt.err, tt.opts); got != tt.want {
+			t.Errorf("%s: shouldRetry = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRetryWait(t *testing.T) {
+	withRetryAfter := &statusError{resp: &httpResponse{StatusCode: 429, Headers: []headerField{{Name: "Retry-After", Value: "3"}}}}
+	withoutRetryAfter := &statusError{resp: &httpResponse{StatusCode: 503}}
+
+	tests := []struct {
+		name string
+		err  error
+		opts requestOptions
+		want time.Duration
+	}{
+		{name: "Retry-After wins", err: withRetryAfter, opts: requestOptions{RetryDelay: 1}, want: 3 * time.Second},
+		{name: "--retry-delay", err: withoutRetryAfter, opts: requestOptions{RetryDelay: 0.5}, want: 500 * time.Millisecond},
+		{name: "backoff", err: withoutRetryAfter, want: 4 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := retryWait(tt.err, tt.opts, 4*time.Second); got != tt.want {
+			t.Errorf("%s: retryWait = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// failingHandler answers the first failures requests with 503 and later ones with ok
+func failingHandler(failures int) func(w http.ResponseWriter, r *http.Request, body string) {
+	return func(w http.ResponseWriter, r *http.Request, body string) {
+		if failures > 0 {
+			failures--
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(503)
+			w.Write([]byte("busy"))
+			return
+		}
+		w.Write([]byte("ok"))
+	}
+}
+
+func TestRetryTransientStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		failures   int
+		wantStdout string
+		wantTries  int
+	}{
+		{name: "recovers", failures: 2, wantStdout: "ok", wantTries: 3},
+		{name: "gives up with the last response", failures: 5, wantStdout: "busy", wantTries: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(t, failingHandler(tt.failures))
+			result := runCLI(t, "", "-s", "-S", "--retry", "2", server.URL+"/")
+			if result.code != 0 {
+				t.Fatalf("exit status %d, stderr:\n%s", result.code, result.stderr)
+			}
+			if result.stdout != tt.wantStdout {
+				t.Errorf("stdout = %q, want %q", result.stdout, tt.wantStdout)
+			}
+			if tries := len(server.received()); tries != tt.wantTries {
+				t.Errorf("server received %d requests, want %d", tries, tt.wantTries)
+			}
+		})
+	}
+}
+
+func TestRetryConnRefused(t *testing.T) {
+	// A port nothing listens on any more
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "http://" + ln.Addr().String() + "/"
+	ln.Close()
+
+	tests := []struct {
+		name        string
+		args        []string
+		wantRetries int
+	}{
+		{name: "not retried", args: []string{"--retry", "2"}},
+		{name: "--retry-connrefused", args: []string{"--retry", "2", "--retry-connrefused"}, wantRetries: 2},
+		{name: "--retry-all-errors", args: []string{"--retry", "1", "--retry-all-errors"}, wantRetries: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"-s", "-S", "--retry-delay", "0.01"}, tt.args...)
+			result := runCLI(t, "", append(args, url)...)
+			if result.code == 0 {
+				t.Fatalf("exit status 0 connecting to a closed port, stderr:\n%s", result.stderr)
+			}
+			if retries := strings.Count(result.stderr, "Will retry"); retries != tt.wantRetries {
+				t.Errorf("retried %d times, want %d, stderr:\n%s", retries, tt.wantRetries, result.stderr)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// sigV4Scope describes the signing parameters named by --aws-sigv4, given as
+// provider1[:provider2[:region[:service]]] like curl
+type sigV4Scope struct {
+	provider1 string
+	provider2 string
+	region    string
+	service   string
+}
+
+// parseSigV4Scope parses the --aws-sigv4 value, taking a missing region and
+// service from a host named like service.region.amazonaws.com
+func parseSigV4Scope(value string, host string) (sigV4Scope, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) > 4 || parts[0] == "" {
+		return sigV4Scope{}, fmt.Errorf("invalid --aws-sigv4 value: %s", value)
+	}
+	scope := sigV4Scope{provider1: strings.ToLower(parts[0]), provider2: strings.ToLower(parts[0])}
+	if len(parts) > 1 && parts[1] != "" {
+		scope.provider2 = strings.ToLower(parts[1])
+	}
+	labels := strings.Split(host, ".")
+	if len(parts) > 2 {
+		scope.region = parts[2]
+	} else if len(labels) > 2 {
+		scope.region = labels[1]
+	}
+	if len(parts) > 3 {
+		scope.service = parts[3]
+	} else if len(labels) > 2 {
+		scope.service = labels[0]
+	}
+	if scope.region == "" || scope.service == "" {
+		return sigV4Scope{}, fmt.Errorf("--aws-sigv4 needs a region and service, e.g. aws:amz:us-east-1:s3")
+	}
+	return scope, nil
+}
+
+// awsCredentials returns the access key, secret key and optional session
+// token: -u key:secret when given, the AWS_* environment variables otherwise
+func awsCredentials(opts *requestOptions, target urlOptions) (string, string, string, error) {
+	if user := credentials(opts, target); user != "" {
+		key, secret, _ := strings.Cut(user, ":")
+		return key, secret, "", nil
+	}
+	key, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if key == "" || secret == "" {
+		return "", "", "", errors.New("--aws-sigv4 needs -u key:secret or AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	return key, secret, os.Getenv("AWS_SESSION_TOKEN"), nil
+}
+
+// awsEscape percent-encodes s the way SigV4 requires: everything but the
+// RFC 3986 unreserved characters, optionally keeping slashes
+func awsEscape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (keepSlash && c == '/') {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// canonicalQuery sorts and re-encodes the query parameters
+func canonicalQuery(rawQuery string) string {
+	values, _ := url.ParseQuery(rawQuery)
+	var pairs []string
+	for key, list := range values {
+		for _, value := range list {
+			pairs = append(pairs, awsEscape(key, false)+"="+awsEscape(value, false))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// hmacSHA256 computes HMAC-SHA256 of data under key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// signSigV4 adds the date, payload hash and Authorization headers signing the
+// request with AWS Signature Version 4, given the hex SHA-256 of the body.
+// Every header except the hop-by-hop Connection and Expect is signed
+func signSigV4(scope sigV4Scope, key string, secret string, token string, method string, requestPath string, headers *headerSet, bodyHash string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	day := amzDate[:8]
+	prefix := "X-" + strings.ToUpper(scope.provider2[:1]) + scope.provider2[1:]
+
+	headers.set(prefix+"-Date", amzDate)
+	if scope.service == "s3" {
+		headers.set(prefix+"-Content-Sha256", bodyHash)
+	}
+	if token != "" {
+		headers.set(prefix+"-Security-Token", token)
+	}
+
+	// Repeated headers are signed as one, their values joined with commas
+	canonical := map[string]string{}
+	for _, field := range *headers {
+		lower := strings.ToLower(field.Name)
+		if lower == "connection" || lower == "expect" || lower == "authorization" {
+			continue
+		}
+		value := strings.Join(strings.Fields(field.Value), " ")
+		if previous, ok := canonical[lower]; ok {
+			value = previous + "," + value
+		}
+		canonical[lower] = value
+	}
+	names := make([]string, 0, len(canonical))
+	for name := range canonical {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + canonical[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	// S3 signs the path as sent, other services encode it once more
+	path, rawQuery, _ := strings.Cut(requestPath, "?")
+	if scope.service != "s3" {
+		path = awsEscape(path, true)
+	}
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		path,
+		canonicalQuery(rawQuery),
+		canonicalHeaders.String(),
+		signedHeaders,
+		bodyHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	algorithm := strings.ToUpper(scope.provider1) + "4-HMAC-SHA256"
+	credentialScope := strings.Join([]string{day, scope.region, scope.service, scope.provider1 + "4_request"}, "/")
+	stringToSign := strings.Join([]string{algorithm, amzDate, credentialScope, hex.EncodeToString(requestHash[:])}, "\n")
+
+	signingKey := hmacSHA256([]byte(strings.ToUpper(scope.provider1)+"4"+secret), day)
+	signingKey = hmacSHA256(signingKey, scope.region)
+	signingKey = hmacSHA256(signingKey, scope.service)
+	signingKey = hmacSHA256(signingKey, scope.provider1+"4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	headers.set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		algorithm, key, credentialScope, signedHeaders, signature))
+}
+
+// applySigV4 signs the prepared request headers for --aws-sigv4
+func applySigV4(opts *requestOptions, target urlOptions, headers *headerSet) error {
+	scope, err := parseSigV4Scope(opts.AWSSigV4, target.Host)
+	if err != nil {
+		return err
+	}
+	key, secret, token, err := awsCredentials(opts, target)
+	if err != nil {
+		return err
+	}
+	bodyHash, err := payloadHash(opts, sha256.New)
+	if err != nil {
+		return err
+	}
+	signSigV4(scope, key, secret, token, opts.Method, target.Path, headers, bodyHash, time.Now())
+	return nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSigV4Scope(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		host    string
+		want    sigV4Scope
+		wantErr bool
+	}{
+		{
+			name:  "everything given",
+			value: "aws:amz:eu-west-1:s3",
+			host:  "example.com",
+			want:  sigV4Scope{provider1: "aws", provider2: "amz", region: "eu-west-1", service: "s3"},
+		},
+		{
+			name:  "region and service from the host",
+			value: "aws:amz",
+			host:  "sqs.us-east-2.amazonaws.com",
+			want:  sigV4Scope{provider1: "aws", provider2: "amz", region: "us-east-2", service: "sqs"},
+		},
+		{
+			name:  "second provider defaults to the first",
+			value: "OSC",
+			host:  "api.eu-west-2.outscale.com",
+			want:  sigV4Scope{provider1: "osc", provider2: "osc", region: "eu-west-2", service: "api"},
+		},
+		{name: "no region for a short host", value: "aws:amz", host: "localhost", wantErr: true},
+		{name: "empty provider", value: ":amz:r:s", host: "example.com", wantErr: true},
+		{name: "too many parts", value: "a:b:c:d:e", host: "example.com", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSigV4Scope(tt.value, tt.host)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseSigV4Scope(%q, %q) = %+v, want an error", tt.value, tt.host, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseSigV4Scope(%q, %q) error = %v", tt.value, tt.host, err)
+			}
+			if got != tt.want {
+				t.Errorf("parseSigV4Scope(%q, %q) = %+v, want %+v", tt.value, tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalQuery(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"", ""},
+		{"Param2=value2&Param1=value1", "Param1=value1&Param2=value2"},
+		{"b=2&a=1&a=0", "a=0&a=1&b=2"},
+		{"q=a+b&x=%2F~", "q=a%20b&x=%2F~"},
+		{"flag", "flag="},
+	}
+
+	for _, tt := range tests {
+		if got := canonicalQuery(tt.raw); got != tt.want {
+			t.Errorf("canonicalQuery(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestAWSEscape(t *testing.T) {
+	tests := []struct {
+		in        string
+		keepSlash bool
+		want      string
+	}{
+		{"AZaz09-_.~", false, "AZaz09-_.~"},
+		{"a b/c", false, "a%20b%2Fc"},
+		{"/a b/c", true, "/a%20b/c"},
+		{"/a%20b", true, "/a%2520b"},
+		{"é", false, "%C3%A9"},
+	}
+
+	for _, tt := range tests {
+		if got := awsEscape(tt.in, tt.keepSlash); got != tt.want {
+			t.Errorf("awsEscape(%q, %v) = %q, want %q", tt.in, tt.keepSlash, got, tt.want)
+		}
+	}
+}
+
+func TestSignSigV4(t *testing.T) {
+	// The credentials and date of the AWS Signature Version 4 test suite
+	const (
+		accessKey = "AKIDEXAMPLE"
+		secretKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+		emptyHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	)
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	service := sigV4Scope{provider1: "aws", provider2: "amz", region: "us-east-1", service: "service"}
+	s3 := sigV4Scope{provider1: "aws", provider2: "amz", region: "us-east-1", service: "s3"}
+
+	tests := []struct {
+		name     string
+		scope    sigV4Scope
+		method   string
+		path     string
+		headers  headerSet
+		bodyHash string
+		want     string
+	}{
+		{
+			name:     "get-vanilla",
+			scope:    service,
+			method:   "GET",
+			path:     "/",
+			headers:  headerSet{{Name: "Host", Value: "example.amazonaws.com"}},
+			bodyHash: emptyHash,
+			want:     "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name:     "get-vanilla-query-order-key-case",
+			scope:    service,
+			method:   "GET",
+			path:     "/?Param2=value2&Param1=value1",
+			headers:  headerSet{{Name: "Host", Value: "example.amazonaws.com"}},
+			bodyHash: emptyHash,
+			want:     "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+		{
+			name:     "post-vanilla",
+			scope:    service,
+			method:   "POST",
+			path:     "/",
+			headers:  headerSet{{Name: "Host", Value: "example.amazonaws.com"}},
+			bodyHash: emptyHash,
+			want:     "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b",
+		},
+		{
+			name:   "repeated headers, encoded path, hop-by-hop skipped",
+			scope:  service,
+			method: "GET",
+			path:   "/a%20b/c",
+			headers: headerSet{
+				{Name: "Host", Value: "example.amazonaws.com"},
+				{Name: "X-Custom", Value: "  a   b "},
+				{Name: "Connection", Value: "close"},
+				{Name: "X-Custom", Value: "c"},
+			},
+			bodyHash: emptyHash,
+			want:     "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date;x-custom, Signature=777788858ea14cae4dcb2d88b8619f34c6a18c5fd7de43a66a93c2f979b42f05",
+		},
+		{
+			name:     "s3 signs the payload hash and the path as sent",
+			scope:    s3,
+			method:   "PUT",
+			path:     "/my%20key",
+			headers:  headerSet{{Name: "Host", Value: "bucket.s3.us-east-1.amazonaws.com"}},
+			bodyHash: "3a6eb0790f39ac87c94f3856b2dd2c5d110e6811602261a9a923d3bb23adc8b7",
+			want:     "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/s3/aws4_request, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=15ad492c298e9045d959133b96a05f56cc745108c0d3775cbf7ef94626ba10f0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := tt.headers
+			signSigV4(tt.scope, accessKey, secretKey, "", tt.method, tt.path, &headers, tt.bodyHash, now)
+			if got, _ := headers.get("Authorization"); got != tt.want {
+				t.Errorf("Authorization = %s\nwant %s", got, tt.want)
+			}
+			if got, _ := headers.get("X-Amz-Date"); got != "20150830T123600Z" {
+				t.Errorf("X-Amz-Date = %s, want 20150830T123600Z", got)
+			}
+		})
+	}
+}
+
+func TestSignSigV4SessionToken(t *testing.T) {
+	scope := sigV4Scope{provider1: "aws", provider2: "amz", region: "us-east-1", service: "service"}
+	headers := headerSet{{Name: "Host", Value: "example.amazonaws.com"}}
+	signSigV4(scope, "AKIDEXAMPLE", "secret", "token123", "GET", "/", &headers, "", time.Unix(0, 0))
+	if got, _ := headers.get("X-Amz-Security-Token"); got != "token123" {
+		t.Errorf("X-Amz-Security-Token = %q, want token123", got)
+	}
+	if got, _ := headers.get("Authorization"); !strings.Contains(got, "SignedHeaders=host;x-amz-date;x-amz-security-token") {
+		t.Errorf("Authorization = %s, want the token signed", got)
+	}
+}
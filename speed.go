@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// speedSample is the running byte count observed at one moment
+type speedSample struct {
+	at    time.Time
+	bytes int64
+}
+
+// monitorLowSpeed watches the bytes sent and received during the transfer
+// and cancels the returned context once throughput has stayed below
+// --speed-limit for a full --speed-time window, so an upload going at full
+// speed is not taken for a stalled download
+func monitorLowSpeed(parent context.Context, opts requestOptions, stats *transferStats) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(parent)
+	window := time.Duration(opts.SpeedTime) * time.Second
+	limit := int64(opts.SpeedLimit)
+
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		samples := []speedSample{{at: time.Now()}}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				samples = append(samples, speedSample{at: now, bytes: stats.Received.Load() + stats.Sent.Load()})
+				for len(samples) > 1 && now.Sub(samples[1].at) >= window {
+					samples = samples[1:]
+				}
+				oldest := samples[0]
+				elapsed := now.Sub(oldest.at)
+				if elapsed < window {
+					continue
+				}
+				if float64(samples[len(samples)-1].bytes-oldest.bytes)/elapsed.Seconds() < float64(limit) {
+					cancel(&exitError{
+						code: exitOperationTimedOut,
+						err: fmt.Errorf("Operation too slow. Less than %s transferred the last %s",
+							out.speed(limit), out.duration(window)),
+					})
+					return
+				}
+			}
+		}
+	}()
+
+	return ctx, func() { cancel(context.Canceled) }
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMonitorLowSpeed(t *testing.T) {
+	opts := requestOptions{SpeedLimit: 1000, SpeedTime: 1}
+
+	t.Run("stalled", func(t *testing.T) {
+		ctx, stop := monitorLowSpeed(context.Background(), opts, &transferStats{})
+		defer stop()
+		select {
+		case <-ctx.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatal("a stalled transfer was not aborted")
+		}
+		var exitErr *exitError
+		if cause := context.Cause(ctx); !errors.As(cause, &exitErr) || exitErr.code != exitOperationTimedOut {
+			t.Errorf("cause = %v, want an exit status %d", cause, exitOperationTimedOut)
+		}
+	})
+
+	t.Run("upload at full speed", func(t *testing.T) {
+		stats := &transferStats{}
+		ctx, stop := monitorLowSpeed(context.Background(), opts, stats)
+		defer stop()
+		deadline := time.After(2500 * time.Millisecond)
+		for {
+			select {
+			case <-ctx.Done():
+				t.Fatalf("a transfer sending 10000 bytes a second was aborted: %v", context.Cause(ctx))
+			case <-deadline:
+				return
+			case <-time.After(100 * time.Millisecond):
+				stats.Sent.Add(1000)
+			}
+		}
+	})
+}
+
+func TestSpeedLimitAbortsSlowResponse(t *testing.T) {
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request, body string) {
+		w.Header().Set("Content-Length", "1000")
+		w.WriteHeader(200)
+		for i := 0; i < 10; i++ {
+			w.Write([]byte("x"))
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(time.Second):
+			}
+		}
+	})
+
+	start := time.Now()
+	result := runCLI(t, "", "-s", "-S", "--speed-limit", "100", "--speed-time", "1", server.URL+"/")
+	if result.code != exitOperationTimedOut || !strings.Contains(result.stderr, "Operation too slow") {
+		t.Errorf("exit status %d, stderr:\n%s\nwant %d and a low speed error", result.code, result.stderr, exitOperationTimedOut)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("took %v to abort with a 1s window", elapsed)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// transferStats records the timings and sizes of a transfer
+type transferStats struct {
+	Start         time.Time
+	NameLookup    time.Duration
+	Connect       time.Duration
+	PreTransfer   time.Duration
+	StartTransfer time.Duration
+	Total         time.Duration
+
+	NumConnects  int
+	NumRedirects int
+	URLEffective string
+	RemoteIP     string
+	RemotePort   string
+	LocalIP      string
+	LocalPort    string
+	SizeRequest  int64
+	SizeUpload   int64
+	SizeHeader   int64
+	SizeDownload int64
+
+	// Received counts every byte read off the connection while the transfer
+	// runs, and Sent every byte written to it
+	Received atomic.Int64
+	Sent     atomic.Int64
+
+	// Reading counts reads blocked on the connection and LastActive holds the
+	// time since Start at which bytes last moved in either direction
+	Reading    atomic.Int32
+	LastActive atomic.Int64
+}
+
+// newTransferStats starts the clock for a new transfer
+func newTransferStats() *transferStats {
+	return &transferStats{Start: time.Now()}
+}
+
+// connected records the connect time and the endpoints of an established connection
+func (s *transferStats) connected(conn net.Conn) {
+	s.Connect = time.Since(s.Start)
+	s.NumConnects++
+	s.RemoteIP, s.RemotePort, _ = net.SplitHostPort(conn.RemoteAddr().String())
+	s.LocalIP, s.LocalPort, _ = net.SplitHostPort(conn.LocalAddr().String())
+}
+
+// reused records the endpoints of a connection left open by an earlier
+// transfer; no connect time is spent and no new connection counted
+func (s *transferStats) reused(conn net.Conn) {
+	s.RemoteIP, s.RemotePort, _ = net.SplitHostPort(conn.RemoteAddr().String())
+	s.LocalIP, s.LocalPort, _ = net.SplitHostPort(conn.LocalAddr().String())
+}
+
+// meteredReader counts the bytes read through it and remembers when the
+// first one arrived, optionally adding them to a shared running total
+type meteredReader struct {
+	r     io.Reader
+	n     int64
+	first time.Time
+	total *atomic.Int64
+}
+
+// Read reads from the underlying reader, updating the byte count
+func (m *meteredReader) Read(p []byte) (int, error) {
+	n, err := m.r.Read(p)
+	if n > 0 && m.first.IsZero() {
+		m.first = time.Now()
+	}
+	m.n += int64(n)
+	if m.total != nil {
+		m.total.Add(int64(n))
+	}
+	return n, err
+}
+
+// meteredConn is a connection counting the bytes written to it
+type meteredConn struct {
+	net.Conn
+	total *atomic.Int64
+}
+
+// Write writes to the underlying connection, updating the byte count
+func (m *meteredConn) Write(p []byte) (int, error) {
+	n, err := m.Conn.Write(p)
+	m.total.Add(int64(n))
+	return n, err
+}
+
+// touch records that bytes just moved on the connection
+func (s *transferStats) touch() {
+	s.LastActive.Store(int64(time.Since(s.Start)))
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// templateFuncs are the helpers --body-template files may call besides the
+// text/template builtins
+var templateFuncs = template.FuncMap{
+	// env returns an environment variable, or "" when it is unset
+	"env": os.Getenv,
+	// file returns the content of a file, so payloads can embed fixtures
+	"file": func(path string) (string, error) {
+		content, err := os.ReadFile(path)
+		return string(content), err
+	},
+	// json encodes a value as JSON, quoting and escaping strings
+	"json": func(v any) (string, error) {
+		encoded, err := json.Marshal(v)
+		return string(encoded), err
+	},
+}
+
+// applyBodyTemplate renders --body-template with Go's text/template and
+// sends the result as the body, exactly as rendered like --data-raw. Fields
+// such as {{.name}} come from --var name=value, falling back to environment
+// variables; a field that is neither is an error rather than an empty value
+func applyBodyTemplate(opts *requestOptions) error {
+	if opts.BodyTemplate == "" {
+		if len(opts.TemplateVars) > 0 {
+			return fmt.Errorf("error: --var needs --body-template")
+		}
+		return nil
+	}
+	if len(opts.DataArgs) > 0 || len(opts.FormArgs) > 0 || opts.UploadFile != "" || opts.GraphQL != "" {
+		return fmt.Errorf("error: --body-template builds the body and cannot be combined with -d, --json, --graphql, -F, -T or request items")
+	}
+	source, err := readDataFile(opts.BodyTemplate)
+	if err != nil {
+		return err
+	}
+	tmpl, err := template.New(opts.BodyTemplate).Funcs(templateFuncs).Option("missingkey=error").Parse(string(source))
+	if err != nil {
+		return fmt.Errorf("error parsing body template: %v", err)
+	}
+
+	values := map[string]string{}
+	for _, entry := range os.Environ() {
+		if key, value, ok := strings.Cut(entry, "="); ok {
+			values[key] = value
+		}
+	}
+	for _, variable := range opts.TemplateVars {
+		key, value, _ := strings.Cut(variable, "=")
+		values[key] = value
+	}
+
+	var body strings.Builder
+	if err := tmpl.Execute(&body, values); err != nil {
+		return fmt.Errorf("error rendering body template: %v", err)
+	}
+	opts.DataArgs = dataList{{kind: dataRaw, value: body.String()}}
+	return nil
+}
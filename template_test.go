@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestApplyBodyTemplate(t *testing.T) {
+	dir := t.TempDir()
+	fixture := filepath.Join(dir, "note.txt")
+	if err := os.WriteFile(fixture, []byte("line \"one\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	template := func(name, source string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	t.Setenv("CCCURL_TEMPLATE_USER", "from-env")
+
+	tests := []struct {
+		name    string
+		opts    requestOptions
+		want    string
+		wantErr string
+	}{
+		{name: "no template", opts: requestOptions{}},
+		{
+			name: "variables and environment",
+			opts: requestOptions{BodyTemplate: template("vars.tmpl", "{{.id}} {{.CCCURL_TEMPLATE_USER}}\n"), TemplateVars: varList{"id=7"}},
+			want: "7 from-env\n",
+		},
+		{
+			name: "--var overrides the environment",
+			opts: requestOptions{BodyTemplate: template("override.tmpl", "{{.CCCURL_TEMPLATE_USER}}"), TemplateVars: varList{"CCCURL_TEMPLATE_USER=given"}},
+			want: "given",
+		},
+		{
+			name: "file and json",
+			opts: requestOptions{BodyTemplate: template("funcs.tmpl", `{"note":{{file "`+fixture+`" | json}}}`)},
+			want: `{"note":"line \"one\"\n"}`,
+		},
+		{name: "missing field", opts: requestOptions{BodyTemplate: template("missing.tmpl", "{{.nope}}")}, wantErr: "error rendering body template"},
+		{name: "syntax error", opts: requestOptions{BodyTemplate: template("broken.tmpl", "{{.id")}, wantErr: "error parsing body template"},
+		{name: "--var without a template", opts: requestOptions{TemplateVars: varList{"id=1"}}, wantErr: "--var needs --body-template"},
+		{
+			name:    "with --graphql",
+			opts:    requestOptions{BodyTemplate: template("graphql.tmpl", "x"), GraphQL: "{ me }"},
+			wantErr: "cannot be combined",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			err := applyBodyTemplate(&opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("applyBodyTemplate error = %v, want one mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyBodyTemplate error = %v", err)
+			}
+			if tt.want == "" {
+				if len(opts.DataArgs) != 0 {
+					t.Errorf("DataArgs = %v, want none", opts.DataArgs)
+				}
+				return
+			}
+			if len(opts.DataArgs) != 1 || opts.DataArgs[0].kind != dataRaw || opts.DataArgs[0].value != tt.want {
+				t.Errorf("DataArgs = %v, want a raw body %q", opts.DataArgs, tt.want)
+			}
+		})
+	}
+}
+
+func TestBodyTemplateRequest(t *testing.T) {
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request, body string) { w.Write([]byte("ok")) })
+	body := filepath.Join(t.TempDir(), "body.tmpl")
+	if err := os.WriteFile(body, []byte("name={{.name}}&raw=@kept\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	result := runCLI(t, "", "-s", "-S", "--body-template", body, "--var", "name=a b", server.URL+"/")
+	if result.code != 0 {
+		t.Fatalf("exit status %d, stderr:\n%s", result.code, result.stderr)
+	}
+	last := server.last(t)
+	if last.Method != "POST" || last.Body != "name=a b&raw=@kept\n" {
+		t.Errorf("request %s with body %q, want the rendered template sent as is", last.Method, last.Body)
+	}
+}
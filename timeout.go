@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// exitOperationTimedOut is the exit status used when --max-time or
+// --connect-timeout expires, matching curl's status for the same condition
+const exitOperationTimedOut = 28
+
+// seconds converts a possibly fractional number of seconds to a duration
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// exitInterrupted is the exit status used when the transfer is cancelled with
+// Ctrl-C, following the shell convention of 128 plus the signal number
+const exitInterrupted = 130
+
+// errInterrupted is the cancellation cause recorded when SIGINT arrives
+var errInterrupted = errors.New("interrupted")
+
+// interruptContext returns the context governing the whole invocation, which
+// the first SIGINT cancels. A second SIGINT falls back to the default
+// behavior and kills the process
+func interruptContext() (context.Context, context.CancelFunc) {
+	_, ctx, stop := batchInterruptContexts(0)
+	return ctx, stop
+}
+
+// batchInterruptContexts returns the contexts of a run of several transfers:
+// launch, which the first SIGINT cancels so that no further transfer starts,
+// and transfers, which governs the transfers themselves and is cancelled
+// grace later, letting the one in flight finish first. A second SIGINT
+// cancels transfers at once, and a third falls back to the default behavior
+// and kills the process. With no grace both end with the first SIGINT, and
+// the second kills the process
+func batchInterruptContexts(grace time.Duration) (launch context.Context, transfers context.Context, stop context.CancelFunc) {
+	launch, cancelLaunch := context.WithCancelCause(context.Background())
+	transfers, cancelTransfers := context.WithCancelCause(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	go func() {
+		if _, ok := <-signals; !ok {
+			return
+		}
+		cancelLaunch(errInterrupted)
+		if grace > 0 {
+			select {
+			case _, ok := <-signals:
+				if !ok {
+					return
+				}
+			case <-time.After(grace):
+			case <-transfers.Done():
+			}
+		}
+		signal.Stop(signals)
+		cancelTransfers(errInterrupted)
+	}()
+
+	return launch, transfers, func() {
+		signal.Stop(signals)
+		close(signals)
+		cancelLaunch(context.Canceled)
+		cancelTransfers(context.Canceled)
+	}
+}
+
+// attemptContext bounds a single transfer attempt by --max-time when one is set
+func attemptContext(parent context.Context, opts requestOptions) (context.Context, context.CancelFunc) {
+	if opts.MaxTime > 0 {
+		return context.WithTimeout(parent, seconds(opts.MaxTime))
+	}
+	return context.WithCancel(parent)
+}
+
+// transferError turns an error caused by the transfer context ending, through
+// --max-time or Ctrl-C, into a report of how far the transfer got; other
+// errors are returned unchanged
+func transferError(ctx context.Context, err error, stats *transferStats) error {
+	var exitErr *exitError
+	if errors.As(err, &exitErr) || ctx.Err() == nil {
+		return err
+	}
+	elapsed := out.duration(time.Since(stats.Start))
+	switch cause := context.Cause(ctx); {
+	case cause == errInterrupted:
+		return &exitError{
+			code: exitInterrupted,
+			err:  fmt.Errorf("Interrupted after %s with %s received", elapsed, out.size(stats.SizeDownload)),
+		}
+	case errors.As(cause, &exitErr):
+		return cause
+	}
+	return &exitError{
+		code: exitOperationTimedOut,
+		err:  fmt.Errorf("Operation timed out after %s with %s received", elapsed, out.size(stats.SizeDownload)),
+	}
+}
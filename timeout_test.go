@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTransferCount(t *testing.T) {
+	tests := []struct {
+		name string
+		opts requestOptions
+		want int
+	}{
+		{name: "plain", opts: requestOptions{URLs: []string{"a", "b"}}, want: 2},
+		{name: "glob", opts: requestOptions{URLs: []string{"http://x/[1-3]", "http://x/{a,b}"}}, want: 5},
+		{name: "glob off", opts: requestOptions{URLs: []string{"http://x/[1-3]"}, GlobOff: true}, want: 1},
+		{name: "invalid glob", opts: requestOptions{URLs: []string{"http://x/[1-"}}, want: 1},
+	}
+
+	for _, tt := range tests {
+		if got := tt.opts.transferCount(); got != tt.want {
+			t.Errorf("%s: transferCount() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBatchInterrupt(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		signals    int
+		wantStdout string
+		wantStderr string
+	}{
+		{
+			name:       "in-flight transfer finishes",
+			wantStdout: "slow",
+			wantStderr: "Interrupted: 1 of 3 transfers completed, 0 failed, 2 not started",
+		},
+		{
+			name:       "no grace",
+			args:       []string{"--interrupt-grace", "0"},
+			wantStderr: "Interrupted: 0 of 3 transfers completed, 1 failed, 2 not started",
+		},
+		{
+			name:       "second Ctrl-C",
+			signals:    1,
+			wantStderr: "Interrupted: 0 of 3 transfers completed, 1 failed, 2 not started",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			arrived := make(chan struct{}, 1)
+			server := newTestServer(t, func(w http.ResponseWriter, r *http.Request, body string) {
+				if r.URL.Path == "/slow" {
+					arrived <- struct{}{}
+					time.Sleep(500 * time.Millisecond)
+				}
+				w.Write([]byte(strings.TrimPrefix(r.URL.Path, "/")))
+			})
+
+			args := append([]string{"-s", "-S"}, tt.args...)
+			cmd := exec.Command(os.Args[0], append(args, server.URL+"/slow", server.URL+"/fast", server.URL+"/fast")...)
+			cmd.Env = append(os.Environ(), "CCCURL_TEST_MAIN=1", "HOME="+t.TempDir(), "NO_COLOR=1")
+			var stdout, stderr bytes.Buffer
+			cmd.Stdout, cmd.Stderr = &stdout, &stderr
+			if err := cmd.Start(); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case <-arrived:
+			case <-time.After(10 * time.Second):
+				cmd.Process.Kill()
+				t.Fatal("the first request never arrived")
+			}
+			cmd.Process.Signal(os.Interrupt)
+			for range tt.signals {
+				time.Sleep(100 * time.Millisecond)
+				cmd.Process.Signal(os.Interrupt)
+			}
+
+			var exitErr *exec.ExitError
+			if err := cmd.Wait(); !errors.As(err, &exitErr) || exitErr.ExitCode() != exitInterrupted {
+				t.Fatalf("exit = %v, want status %d, stderr:\n%s", err, exitInterrupted, stderr.String())
+			}
+			if stdout.String() != tt.wantStdout {
+				t.Errorf("stdout = %q, want %q", stdout.String(), tt.wantStdout)
+			}
+			if !strings.Contains(stderr.String(), tt.wantStderr) {
+				t.Errorf("stderr = %q, want it to contain %q", stderr.String(), tt.wantStderr)
+			}
+			if n := len(server.received()); n != 1 {
+				t.Errorf("%d requests, want only the first", n)
+			}
+		})
+	}
+}
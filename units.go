@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// size formats a byte count for messages: binary units such as 3.8 MiB, or
+// the exact count with --machine
+func (c console) size(n int64) string {
+	if c.Machine {
+		return fmt.Sprintf("%d bytes", n)
+	}
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value, prefix := float64(n)/unit, 0
+	for value >= unit && prefix < 4 {
+		value /= unit
+		prefix++
+	}
+	return fmt.Sprintf("%.1f %ciB", value, "KMGTP"[prefix])
+}
+
+// speed formats a rate in bytes per second for messages
+func (c console) speed(bytesPerSec int64) string {
+	if c.Machine {
+		return fmt.Sprintf("%d bytes/sec", bytesPerSec)
+	}
+	return c.size(bytesPerSec) + "/s"
+}
+
+// duration formats a duration for messages: milliseconds below a second,
+// seconds below a minute and minutes beyond, or whole milliseconds with --machine
+func (c console) duration(d time.Duration) string {
+	switch {
+	case c.Machine:
+		return fmt.Sprintf("%d milliseconds", d.Milliseconds())
+	case d < time.Second:
+		return fmt.Sprintf("%d ms", d.Milliseconds())
+	case d < time.Minute:
+		return fmt.Sprintf("%.2f s", d.Seconds())
+	}
+	return d.Round(time.Second).String()
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// fileUpload is a -T body streamed from a regular file
+type fileUpload struct {
+	path        string
+	size        int64
+	offset      int64  // where a resumed upload starts, 0 to send the whole file
+	contentType string // sniffed from the file name or content
+}
+
+// Size returns the number of bytes sent: the size the file had when the
+// transfer started, less the part already uploaded when resuming
+func (f *fileUpload) Size() int64 {
+	return f.size - f.offset
+}
+
+// ContentType returns the type sniffed from the file, or "" when it is unknown
+func (f *fileUpload) ContentType() string {
+	return f.contentType
+}
+
+// Open opens the file for one request, positioned at the offset
+func (f *fileUpload) Open() (io.ReadCloser, error) {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading upload file: %v", err)
+	}
+	if _, err := file.Seek(f.offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("error reading upload file: %v", err)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(file, f.Size()), file}, nil
+}
+
+// streamUpload is a body read from stdin or a pipe whose length is only
+// known once it ends. It is sent with chunked encoding and can be sent only
+// once, since what was read is gone
+type streamUpload struct {
+	r           io.Reader
+	contentType string
+	opened      atomic.Bool
+}
+
+// Size returns -1, the length is unknown until the stream ends
+func (s *streamUpload) Size() int64 {
+	return -1
+}
+
+// ContentType returns the type of the data, "" for -T since a stream cannot be sniffed up front
+func (s *streamUpload) ContentType() string {
+	return s.contentType
+}
+
+// Open returns the stream the first time and an error afterwards
+func (s *streamUpload) Open() (io.ReadCloser, error) {
+	if s.opened.Swap(true) {
+		return nil, errors.New("error: the upload from stdin was already sent and cannot be sent again")
+	}
+	return io.NopCloser(s.r), nil
+}
+
+// bufferedUpload is a -T body read from stdin or a pipe in full before
+// sending, so that it can be signed and sent more than once
+type bufferedUpload struct {
+	data []byte
+}
+
+// Size returns the length of the data read
+func (b *bufferedUpload) Size() int64 {
+	return int64(len(b.data))
+}
+
+// ContentType returns "", a stream is not sniffed
+func (b *bufferedUpload) ContentType() string {
+	return ""
+}
+
+// Open returns a reader over the data from its start
+func (b *bufferedUpload) Open() (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(b.data)), nil
+}
+
+// newUpload returns the body for -T: a file streamed with its Content-Length,
+// or stdin for "-". Anything that is not a regular file, such as a named
+// pipe, is streamed like stdin, unless the options need the whole body
+// before sending or may send it again; it is then read in full up front
+func newUpload(path string, opts *requestOptions) (uploadBody, error) {
+	if path == "-" {
+		return newStreamUpload(os.Stdin, opts)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading upload file: %v", err)
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("error: cannot upload %s, it is a directory", path)
+	}
+	if !info.Mode().IsRegular() {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading upload file: %v", err)
+		}
+		return newStreamUpload(file, opts)
+	}
+	contentType, err := sniffFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &fileUpload{path: path, size: info.Size(), contentType: contentType}, nil
+}
+
+// newStreamUpload returns the body for a -T stream: streamed as it arrives,
+// or read in full when the options need that
+func newStreamUpload(r io.Reader, opts *requestOptions) (uploadBody, error) {
+	if !opts.needsWholeBody() {
+		return &streamUpload{r: r}, nil
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading upload file: %v", err)
+	}
+	return &bufferedUpload{data: data}, nil
+}
+
+// sniffFile returns the media type of a file from its name or the first
+// bytes of its content
+func sniffFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("error reading upload file: %v", err)
+	}
+	defer file.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", fmt.Errorf("error reading upload file: %v", err)
+	}
+	return sniffContentType(path, head[:n]), nil
+}
+
+// uploadURL appends the name of the uploaded file to a URL whose path ends in
+// a slash, so that -T file http://host/dir/ stores it as /dir/file like curl
+func uploadURL(rawURL string, path string) (string, error) {
+	if path == "-" {
+		return rawURL, nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("Error parsing URL: %v", err)
+	}
+	if u.Path != "" && !strings.HasSuffix(u.Path, "/") {
+		return rawURL, nil
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + filepath.Base(path)
+	return u.String(), nil
+}
+
+// chunkedBody frames a body of unknown length with chunked transfer encoding
+// as it is read
+func chunkedBody(body io.Reader) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		cw := httputil.NewChunkedWriter(pw)
+		if _, err := io.Copy(cw, body); err != nil {
+			pw.CloseWithError(fmt.Errorf("error reading request body: %v", err))
+			return
+		}
+		cw.Close()
+		// No trailers follow the last chunk
+		io.WriteString(pw, "\r\n")
+		pw.Close()
+	}()
+	return pr
+}
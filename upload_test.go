@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// challengeHandler answers the first request with 401 and the given
+// WWW-Authenticate challenge, and any request carrying scheme credentials with 200
+func challengeHandler(scheme string, challenge string) func(w http.ResponseWriter, r *http.Request, body string) {
+	return func(w http.ResponseWriter, r *http.Request, body string) {
+		auth := r.Header.Get("Authorization")
+		switch {
+		case scheme == "NTLM" && ntlmMessageType(auth) == 1:
+			// The negotiate message; the challenge follows on the same connection
+			w.Header().Set("WWW-Authenticate", challenge)
+			w.WriteHeader(401)
+		case strings.HasPrefix(auth, scheme+" "):
+			w.Write([]byte("ok"))
+		default:
+			w.Header().Set("WWW-Authenticate", challenge)
+			w.WriteHeader(401)
+		}
+	}
+}
+
+// ntlmMessageType returns the type of the NTLM message in an Authorization
+// value, or 0 when it carries none
+func ntlmMessageType(auth string) int {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(auth, "NTLM "))
+	if !strings.HasPrefix(auth, "NTLM ") || err != nil || len(raw) < 12 {
+		return 0
+	}
+	return int(raw[8])
+}
+
+func TestStdinUploadSentAgain(t *testing.T) {
+	const payload = "line one\nline two\n"
+	ntlmChallenge := ntlmTestChallenge([]byte("12345678"), nil)
+
+	tests := []struct {
+		name    string
+		args    []string
+		handler func(w http.ResponseWriter, r *http.Request, body string)
+	}{
+		{
+			name:    "aws-sigv4",
+			args:    []string{"--aws-sigv4", "aws:amz:us-east-1:s3", "-u", "AKID:secret"},
+			handler: func(w http.ResponseWriter, r *http.Request, body string) { w.Write([]byte("ok")) },
+		},
+		{
+			name:    "hmac-sign",
+			args:    []string{"--hmac-sign", "sha256:key:X-Signature: {signature}"},
+			handler: func(w http.ResponseWriter, r *http.Request, body string) { w.Write([]byte("ok")) },
+		},
+		{
+			name:    "digest",
+			args:    []string{"--digest", "-u", "user:pass"},
+			handler: challengeHandler("Digest", `Digest realm="test", nonce="abc", qop="auth"`),
+		},
+		{
+			name:    "ntlm",
+			args:    []string{"--ntlm", "-u", `DOMAIN\user:pass`},
+			handler: challengeHandler("NTLM", ntlmChallenge),
+		},
+		{
+			name:    "anyauth",
+			args:    []string{"--anyauth", "-u", "user:pass"},
+			handler: challengeHandler("Digest", `Digest realm="test", nonce="abc", qop="auth"`),
+		},
+		{
+			name: "retry",
+			args: []string{"--retry", "1"},
+			handler: func() func(w http.ResponseWriter, r *http.Request, body string) {
+				failed := false
+				return func(w http.ResponseWriter, r *http.Request, body string) {
+					if !failed {
+						failed = true
+						w.Header().Set("Retry-After", "0")
+						w.WriteHeader(503)
+						return
+					}
+					w.Write([]byte("ok"))
+				}
+			}(),
+		},
+		{
+			name: "307 redirect",
+			args: []string{"-L"},
+			handler: func(w http.ResponseWriter, r *http.Request, body string) {
+				if r.URL.Path != "/final" {
+					http.Redirect(w, r, "/final", http.StatusTemporaryRedirect)
+					return
+				}
+				w.Write([]byte("ok"))
+			},
+		},
+		{
+			name: "308 redirect",
+			args: []string{"-L"},
+			handler: func(w http.ResponseWriter, r *http.Request, body string) {
+				if r.URL.Path != "/final" {
+					http.Redirect(w, r, "/final", http.StatusPermanentRedirect)
+					return
+				}
+				w.Write([]byte("ok"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(t, tt.handler)
+			args := append([]string{"-s", "-S", "-T", "-"}, tt.args...)
+			result := runCLI(t, payload, append(args, server.URL+"/upload")...)
+			if result.code != 0 {
+				t.Fatalf("exit status %d, stderr:\n%s", result.code, result.stderr)
+			}
+			if result.stdout != "ok" {
+				t.Errorf("stdout = %q, want ok", result.stdout)
+			}
+			last := server.last(t)
+			if last.Method != "PUT" || last.Body != payload {
+				t.Errorf("final request %s with body %q, want PUT with %q", last.Method, last.Body, payload)
+			}
+			if last.ContentLength != int64(len(payload)) {
+				t.Errorf("final request Content-Length = %d, want %d", last.ContentLength, len(payload))
+			}
+		})
+	}
+}
+
+func TestStdinUploadStreamed(t *testing.T) {
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request, body string) { w.Write([]byte("ok")) })
+	result := runCLI(t, "streamed", "-s", "-S", "-T", "-", server.URL+"/upload")
+	if result.code != 0 {
+		t.Fatalf("exit status %d, stderr:\n%s", result.code, result.stderr)
+	}
+	last := server.last(t)
+	if last.Body != "streamed" || last.ContentLength != -1 {
+		t.Errorf("request body %q with Content-Length %d, want %q chunked", last.Body, last.ContentLength, "streamed")
+	}
+}
+
+func TestFIFOUploadSentAgain(t *testing.T) {
+	fifo := filepath.Join(t.TempDir(), "pipe")
+	if err := syscall.Mkfifo(fifo, 0o600); err != nil {
+		t.Skipf("cannot create a named pipe: %v", err)
+	}
+	go func() {
+		if w, err := os.OpenFile(fifo, os.O_WRONLY, 0); err == nil {
+			w.WriteString("from the pipe")
+			w.Close()
+		}
+	}()
+
+	server := newTestServer(t, challengeHandler("Digest", `Digest realm="test", nonce="abc", qop="auth"`))
+	done := make(chan cliResult)
+	go func() {
+		done <- runCLI(t, "", "-s", "-S", "--digest", "-u", "user:pass", "-T", fifo, server.URL+"/upload")
+	}()
+	select {
+	case result := <-done:
+		if result.code != 0 {
+			t.Fatalf("exit status %d, stderr:\n%s", result.code, result.stderr)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the upload from the named pipe did not finish")
+	}
+	if last := server.last(t); last.Body != "from the pipe" {
+		t.Errorf("final request body %q, want %q", last.Body, "from the pipe")
+	}
+}
+
+func TestBufferedUpload(t *testing.T) {
+	upload := &bufferedUpload{data: []byte("data")}
+	for i := 0; i < 2; i++ {
+		body, err := upload.Open()
+		if err != nil {
+			t.Fatalf("Open error = %v", err)
+		}
+		got := make([]byte, 8)
+		n, _ := body.Read(got)
+		if string(got[:n]) != "data" {
+			t.Errorf("read %d = %q, want data", i, got[:n])
+		}
+	}
+	if upload.Size() != 4 {
+		t.Errorf("Size() = %d, want 4", upload.Size())
+	}
+}
+
+// partialUploadServer stores PUT bodies, breaking off the first upload after
+// cut bytes. With keep, what that upload delivered is kept, HEAD reports its
+// length and a PUT with Content-Range appends to it
+type partialUploadServer struct {
+	mu       sync.Mutex
+	cut      int
+	keep     bool
+	stored   []byte
+	requests []string // method and Content-Range of each request
+}
+
+func (s *partialUploadServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	contentRange := r.Header.Get("Content-Range")
+	s.requests = append(s.requests, strings.TrimSpace(r.Method+" "+contentRange))
+	switch {
+	case r.Method == "HEAD":
+		if len(s.stored) == 0 {
+			w.WriteHeader(404)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(s.stored)))
+	case s.cut > 0:
+		part := make([]byte, s.cut)
+		n, _ := io.ReadFull(r.Body, part)
+		s.cut = 0
+		if s.keep {
+			s.stored = part[:n]
+		}
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	case contentRange != "":
+		var from, last, size int
+		fmt.Sscanf(contentRange, "bytes %d-%d/%d", &from, &last, &size)
+		if from != len(s.stored) {
+			w.WriteHeader(416)
+			return
+		}
+		rest, _ := io.ReadAll(r.Body)
+		s.stored = append(s.stored, rest...)
+		w.WriteHeader(201)
+	default:
+		s.stored, _ = io.ReadAll(r.Body)
+		w.WriteHeader(201)
+	}
+}
+
+func TestUploadResumedOnRetry(t *testing.T) {
+	payload := bytes.Repeat([]byte("0123456789abcdef"), 1<<14)
+	file := filepath.Join(t.TempDir(), "big.bin")
+	if err := os.WriteFile(file, payload, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	const cut = 100000
+	ranged := fmt.Sprintf("PUT bytes %d-%d/%d", cut, len(payload)-1, len(payload))
+
+	tests := []struct {
+		name         string
+		resume       bool
+		keep         bool
+		wantRequests []string
+	}{
+		{name: "resumed", resume: true, keep: true, wantRequests: []string{"PUT", "HEAD", ranged}},
+		{name: "nothing stored", resume: true, wantRequests: []string{"PUT", "HEAD", "PUT"}},
+		{name: "without --resume-upload", keep: true, wantRequests: []string{"PUT", "PUT"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &partialUploadServer{cut: cut, keep: tt.keep}
+			server := httptest.NewServer(handler)
+			t.Cleanup(server.Close)
+			args := []string{"-s", "-S", "--retry", "1", "--retry-all-errors", "--retry-delay", "0.01", "-T", file}
+			if tt.resume {
+				args = append(args, "--resume-upload")
+			}
+			result := runCLI(t, "", append(args, server.URL+"/big.bin")...)
+			if result.code != 0 {
+				t.Fatalf("exit status %d, stderr:\n%s", result.code, result.stderr)
+			}
+			handler.mu.Lock()
+			defer handler.mu.Unlock()
+			if !slices.Equal(handler.requests, tt.wantRequests) {
+				t.Errorf("requests = %q, want %q", handler.requests, tt.wantRequests)
+			}
+			if !bytes.Equal(handler.stored, payload) {
+				t.Errorf("stored %d bytes, want the %d of the file", len(handler.stored), len(payload))
+			}
+		})
+	}
+}
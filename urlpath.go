@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+// unsafeTargetChars are the printable ASCII characters that may not appear
+// as-is in a request target (RFC 3986 section 2), sent percent-encoded
+const unsafeTargetChars = "\"<>\\^`{|}"
+
+// requestTarget builds the path and query sent on the request line from a
+// parsed URL. They are taken as typed, so an encoded %2F stays encoded, with
+// the characters that cannot be sent as-is percent-encoded
+func requestTarget(u *url.URL) string {
+	path := u.RawPath
+	if path == "" {
+		path = u.EscapedPath()
+	}
+	path = encodeUnsafe(path)
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + encodeUnsafe(u.RawQuery)
+	}
+	return path
+}
+
+// encodeUnsafe percent-encodes spaces, control and non-ASCII bytes and the
+// other characters not allowed in a request target, along with any % that
+// does not start an escape. Valid escapes are kept
+func encodeUnsafe(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]):
+			b.WriteByte(c)
+		case c == '%', c <= ' ', c >= 0x7f, strings.IndexByte(unsafeTargetChars, c) >= 0:
+			b.WriteByte('%')
+			b.WriteByte("0123456789ABCDEF"[c>>4])
+			b.WriteByte("0123456789ABCDEF"[c&15])
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// isHex reports whether c is a hexadecimal digit
+func isHex(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+// resolveURLDots resolves the dot segments of the path of a URL, as a
+// browser does before sending it, leaving the rest of the URL untouched.
+// --path-as-is skips it to send /../ sequences to the server
+func resolveURLDots(rawURL string) string {
+	scheme := strings.Index(rawURL, "://")
+	if scheme < 0 {
+		return rawURL
+	}
+	authority := scheme + len("://")
+	start := strings.IndexAny(rawURL[authority:], "/?#")
+	if start < 0 || rawURL[authority+start] != '/' {
+		return rawURL
+	}
+	start += authority
+	end := len(rawURL)
+	if i := strings.IndexAny(rawURL[start:], "?#"); i >= 0 {
+		end = start + i
+	}
+	return rawURL[:start] + removeDotSegments(rawURL[start:end]) + rawURL[end:]
+}
+
+// removeDotSegments resolves the "." and ".." segments of a path with the
+// algorithm of RFC 3986 section 5.2.4, so /a/./b/../c becomes /a/c. A ".."
+// never climbs above the root
+func removeDotSegments(path string) string {
+	if !strings.Contains(path, ".") {
+		return path
+	}
+	var segments []string
+	for _, segment := range strings.Split(strings.TrimPrefix(path, "/"), "/") {
+		switch segment {
+		case ".":
+		case "..":
+			if len(segments) > 0 {
+				segments = segments[:len(segments)-1]
+			}
+		default:
+			segments = append(segments, segment)
+		}
+	}
+	// A trailing dot segment leaves the path ending in a slash
+	last := path[strings.LastIndexByte(path, '/')+1:]
+	resolved := "/" + strings.Join(segments, "/")
+	if (last == "." || last == "..") && !strings.HasSuffix(resolved, "/") {
+		resolved += "/"
+	}
+	return resolved
+}
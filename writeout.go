@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// writeOutVariables collects the transfer facts available to --write-out
+func writeOutVariables(opts requestOptions, resp *httpResponse, stats *transferStats, dest string) map[string]any {
+	seconds := stats.Total.Seconds()
+	speed := func(n int64) int64 {
+		if seconds == 0 {
+			return 0
+		}
+		return int64(float64(n) / seconds)
+	}
+
+	return map[string]any{
+		"content_type":       resp.header("Content-Type"),
+		"filename_effective": dest,
+		"http_code":          resp.StatusCode,
+		"http_version":       strings.TrimPrefix(resp.Proto, "HTTP/"),
+		"local_ip":           stats.LocalIP,
+		"local_port":         portNumber(stats.LocalPort),
+		"method":             opts.Method,
+		"num_connects":       stats.NumConnects,
+		"num_headers":        len(resp.Headers),
+		"num_redirects":      stats.NumRedirects,
+		"redirect_url":       redirectLocation(resp, stats),
+		"remote_ip":          stats.RemoteIP,
+		"remote_port":        portNumber(stats.RemotePort),
+		"response_code":      resp.StatusCode,
+		"size_download":      stats.SizeDownload,
+		"size_header":        stats.SizeHeader,
+		"size_request":       stats.SizeRequest,
+		"size_upload":        stats.SizeUpload,
+		"speed_download":     speed(stats.SizeDownload),
+		"speed_upload":       speed(stats.SizeUpload),
+		"time_connect":       stats.Connect.Seconds(),
+		"time_namelookup":    stats.NameLookup.Seconds(),
+		"time_pretransfer":   stats.PreTransfer.Seconds(),
+		"time_starttransfer": stats.StartTransfer.Seconds(),
+		"time_total":         seconds,
+		"url":                opts.URL,
+		"url_effective":      stats.URLEffective,
+	}
+}
+
+// redirectLocation returns the absolute URL a final redirect response points
+// to, which is only set when -L did not follow it
+func redirectLocation(resp *httpResponse, stats *transferStats) string {
+	location := resp.header("Location")
+	if location == "" || !isRedirect(resp.StatusCode) {
+		return ""
+	}
+	next, err := resolveRedirect(stats.URLEffective, location)
+	if err != nil {
+		return ""
+	}
+	return next
+}
+
+// portNumber converts a port string to a number so %{json} reports it as one
+func portNumber(port string) int {
+	n, _ := strconv.Atoi(port)
+	return n
+}
+
+// loadWriteOutFormat resolves the -w argument, reading the format from a file
+// with @file or from stdin with @-
+func loadWriteOutFormat(format string) (string, error) {
+	if !strings.HasPrefix(format, "@") {
+		return format, nil
+	}
+	var raw []byte
+	var err error
+	if format == "@-" {
+		raw, err = io.ReadAll(os.Stdin)
+	} else {
+		raw, err = os.ReadFile(format[1:])
+	}
+	if err != nil {
+		return "", fmt.Errorf("error reading write-out format: %v", err)
+	}
+	return string(raw), nil
+}
+
+// formatWriteOutValue renders a variable the way curl does: times in seconds
+// with microsecond precision, everything else as plain text
+func formatWriteOutValue(value any) string {
+	if f, ok := value.(float64); ok {
+		return fmt.Sprintf("%.6f", f)
+	}
+	return fmt.Sprint(value)
+}
+
+// expandWriteOut substitutes %{variable} and %header{name} references and
+// backslash escapes in a --write-out format string. %{json} expands to every
+// variable as a single JSON object
+func expandWriteOut(format string, vars map[string]any, resp *httpResponse) string {
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		switch {
+		case c == '%' && strings.HasPrefix(format[i:], "%%"):
+			b.WriteByte('%')
+			i++
+		case c == '%' && strings.HasPrefix(format[i:], "%{"):
+			end := strings.IndexByte(format[i:], '}')
+			if end < 0 {
+				b.WriteString(format[i:])
+				return b.String()
+			}
+			name := format[i+2 : i+end]
+			if name == "json" {
+				encoded, _ := json.Marshal(vars)
+				b.Write(encoded)
+			} else if value, ok := vars[name]; ok {
+				b.WriteString(formatWriteOutValue(value))
+			} else {
+				out.Errorln("warning: unknown --write-out variable:", name)
+			}
+			i += end
+		case c == '%' && strings.HasPrefix(format[i:], "%header{"):
+			end := strings.IndexByte(format[i:], '}')
+			if end < 0 {
+				b.WriteString(format[i:])
+				return b.String()
+			}
+			b.WriteString(resp.header(format[i+len("%header{") : i+end]))
+			i += end
+		case c == '\\' && i+1 < len(format):
+			switch format[i+1] {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case '\\':
+				b.WriteByte('\\')
+			default:
+				b.WriteByte(c)
+				continue
+			}
+			i++
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
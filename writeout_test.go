@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpandWriteOut(t *testing.T) {
+	vars := map[string]any{"http_code": 200, "time_total": 1.5, "url": "http://a/"}
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{format: "%{http_code}", want: "200"},
+		{format: "%{time_total}s", want: "1.500000s"},
+		{format: `%{url}\n\t\\\x`, want: "http://a/\n\t\\\\x"},
+		{format: "100%% %{http_code}", want: "100% 200"},
+		{format: "%{unknown}|", want: "|"},
+		{format: "%{http_code", want: "%{http_code"},
+	}
+
+	for _, tt := range tests {
+		if got := expandWriteOut(tt.format, vars, &httpResponse{}); got != tt.want {
+			t.Errorf("expandWriteOut(%q) = %q, want %q", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestWriteOutVariables(t *testing.T) {
+	resp := &httpResponse{Proto: "HTTP/1.1", StatusCode: 302, Headers: []headerField{{Name: "Location", Value: "/next"}}}
+	stats := &transferStats{Total: 2 * time.Second, SizeDownload: 100, URLEffective: "http://a/b/c", RemotePort: "8080"}
+	vars := writeOutVariables(requestOptions{Method: "GET", URL: "a/b/c"}, resp, stats, "c")
+
+	want := map[string]any{
+		"http_code":          302,
+		"http_version":       "1.1",
+		"redirect_url":       "http://a/next",
+		"remote_port":        8080,
+		"speed_download":     int64(50),
+		"filename_effective": "c",
+		"url":                "a/b/c",
+	}
+	for name, value := range want {
+		if vars[name] != value {
+			t.Errorf("%s = %#v, want %#v", name, vars[name], value)
+		}
+	}
+}
+
+func TestLoadWriteOutFormat(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "format.txt")
+	if err := os.WriteFile(file, []byte("%{http_code}\\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := loadWriteOutFormat("@" + file); err != nil || got != "%{http_code}\\n" {
+		t.Errorf("loadWriteOutFormat(@file) = %q, %v", got, err)
+	}
+	if got, _ := loadWriteOutFormat("plain"); got != "plain" {
+		t.Errorf("loadWriteOutFormat(plain) = %q", got)
+	}
+	if _, err := loadWriteOutFormat("@" + file + ".missing"); err == nil {
+		t.Error("loadWriteOutFormat of a missing file gave no error")
+	}
+}
+
+func TestWriteOutJSONAndHeaders(t *testing.T) {
+	resp := &httpResponse{Headers: []headerField{{Name: "X-Request-Id", Value: "abc"}, {Name: "x-request-id", Value: "second"}}}
+	vars := map[string]any{"http_code": 200, "url": "http://a/?q=<x>"}
+
+	got := expandWriteOut("%{json}", vars, resp)
+	var decoded map[string]any
+	if err := json.Unmarshal([]byte(got), &decoded); err != nil {
+		t.Fatalf("%%{json} = %q is not JSON: %v", got, err)
+	}
+	if decoded["http_code"] != float64(200) || decoded["url"] != "http://a/?q=<x>" {
+		t.Errorf("%%{json} = %q", got)
+	}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{format: "%header{x-request-id}", want: "abc"},
+		{format: "[%header{Missing}]", want: "[]"},
+		{format: "%header{X-Request-Id", want: "%header{X-Request-Id"},
+	}
+	for _, tt := range tests {
+		if got := expandWriteOut(tt.format, vars, resp); got != tt.want {
+			t.Errorf("expandWriteOut(%q) = %q, want %q", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestWriteOutAfterTransfer(t *testing.T) {
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request, body string) {
+		w.WriteHeader(201)
+		w.Write([]byte("body"))
+	})
+
+	result := runCLI(t, "", "-s", "-S", "-o", "/dev/null", "-w", `%{http_code} %{size_download} %{method}\n`, server.URL+"/")
+	if result.code != 0 {
+		t.Fatalf("exit status %d, stderr:\n%s", result.code, result.stderr)
+	}
+	if want := "201 4 GET\n"; result.stdout != want {
+		t.Errorf("stdout = %q, want %q", result.stdout, want)
+	}
+
+	result = runCLI(t, "", "-s", "-S", "-o", "/dev/null", "-w", "%{json}", server.URL+"/")
+	var vars map[string]any
+	if err := json.Unmarshal([]byte(result.stdout), &vars); err != nil {
+		t.Fatalf("%%{json} printed %q: %v", result.stdout, err)
+	}
+	if vars["http_code"] != float64(201) || vars["num_connects"] != float64(1) {
+		t.Errorf("%%{json} = %s", result.stdout)
+	}
+
+	result = runCLI(t, "", "-s", "-S", "-o", "/dev/null", "-w", "%header{content-length}", server.URL+"/")
+	if result.stdout != "4" {
+		t.Errorf("%%header{content-length} = %q, want 4", result.stdout)
+	}
+
+	result = runCLI(t, "", "-s", "-S", "-o", "/dev/null", "-w", "%{no_such_variable}", server.URL+"/")
+	if !strings.Contains(result.stderr, "unknown --write-out variable: no_such_variable") {
+		t.Errorf("stderr = %q, want a warning about the unknown variable", result.stderr)
+	}
+}